@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	DOWNLOAD_CONCURRENCY     = 3                      // group files downloaded at the same time
+	DOWNLOAD_BANDWIDTH_LIMIT = int64(0)               // bytes per second shared by all downloads, 0 for no limit
+	BANDWIDTH_LIMIT_CHUNK    = 100 * time.Millisecond // largest amount of data read at once when limited, keeps the rate smooth
+	MIN_BANDWIDTH_LIMIT      = int64(1024)            // bytes per second
+)
+
+// Paces reads so that all downloads together stay below a rate
+type BandwidthLimiter struct {
+	lock  sync.Mutex
+	limit int64     // bytes per second, 0 for no limit
+	next  time.Time // when the data read so far has been paid for
+}
+
+var downloadLimiter = &BandwidthLimiter{}
+
+func (l *BandwidthLimiter) SetLimit(limit int64) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if limit > 0 && limit < MIN_BANDWIDTH_LIMIT {
+		limit = MIN_BANDWIDTH_LIMIT
+	}
+	l.limit = limit
+}
+
+// The most bytes that should be read at once, 0 for no limit
+func (l *BandwidthLimiter) chunkSize() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return int(l.limit * int64(BANDWIDTH_LIMIT_CHUNK) / int64(time.Second))
+}
+
+// Waits until n bytes that were read fit into the limit
+func (l *BandwidthLimiter) Wait(ctx context.Context, n int) error {
+	l.lock.Lock()
+	if l.limit <= 0 || n <= 0 {
+		l.lock.Unlock()
+		return nil
+	}
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.limit))
+	wait := l.next.Sub(now)
+	l.lock.Unlock()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+type limitedReader struct {
+	ctx     context.Context
+	reader  io.Reader
+	limiter *BandwidthLimiter
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if chunk := r.limiter.chunkSize(); chunk > 0 && len(p) > chunk {
+		p = p[:chunk]
+	}
+	n, err := r.reader.Read(p)
+	if waitErr := r.limiter.Wait(r.ctx, n); waitErr != nil && err == nil {
+		err = waitErr
+	}
+	return n, err
+}
+
+func readIntParam(path string, fallback int64) int64 {
+	b, err := GetParam(path)
+	if err != nil || len(b) == 0 {
+		return fallback
+	}
+	var value int64
+	err = json.Unmarshal(b, &value)
+	if err != nil {
+		logwe(errors.Wrapf(err, "could not unmarshal %s", path))
+		return fallback
+	}
+	return value
+}
+
+// Reads the persistent download concurrency and bandwidth limit params, they
+// are read every time a download starts
+func LoadDownloadSettings() int {
+	concurrency := int(readIntParam(DOWNLOAD_PARALLEL_PERSIST, int64(DOWNLOAD_CONCURRENCY)))
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	limit := readIntParam(DOWNLOAD_RATE_PERSIST, DOWNLOAD_BANDWIDTH_LIMIT)
+	if limit < 0 {
+		limit = 0
+	}
+	downloadLimiter.SetLimit(limit)
+	UpdateDownloadProgress(func(p *DownloadProgress) {
+		p.Concurrency = concurrency
+		p.BandwidthLimit = limit
+	})
+	return concurrency
+}
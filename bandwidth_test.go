@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bradleyjkemp/cupaloy"
+)
+
+func TestBandwidthLimiter(t *testing.T) {
+	limiter := &BandwidthLimiter{}
+	results := ""
+	read := func(readers int, size int) time.Duration {
+		start := time.Now()
+		var wg sync.WaitGroup
+		for i := 0; i < readers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				reader := &limitedReader{ctx: context.Background(), reader: bytes.NewReader(make([]byte, size)), limiter: limiter}
+				_, _ = io.Copy(io.Discard, reader)
+			}()
+		}
+		wg.Wait()
+		return time.Since(start)
+	}
+
+	results += fmt.Sprintf("unlimited: %v\n", read(2, 1<<20) < 200*time.Millisecond)
+	// 40 KiB at 100 KiB/s take 0.4s whether they are read by one or by two downloads
+	limiter.SetLimit(100 << 10)
+	for _, readers := range []int{1, 2} {
+		took := read(readers, 40<<10/readers)
+		results += fmt.Sprintf("%d readers limited: %v\n", readers, took >= 300*time.Millisecond && took < 2*time.Second)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	limiter.SetLimit(MIN_BANDWIDTH_LIMIT)
+	_, err := io.Copy(io.Discard, &limitedReader{ctx: ctx, reader: bytes.NewReader(make([]byte, 10<<10)), limiter: limiter})
+	results += fmt.Sprintf("canceled: %v\n", err)
+
+	cupaloy.SnapshotT(t, results)
+}
+
+func TestDownloadBoundsConcurrency(t *testing.T) {
+	useTestDirs(t)
+	concurrency := DOWNLOAD_CONCURRENCY
+	sources := DOWNLOAD_SOURCES
+	defer func() { DOWNLOAD_CONCURRENCY, DOWNLOAD_SOURCES = concurrency, sources }()
+	DOWNLOAD_CONCURRENCY = 2
+
+	mirror := t.TempDir()
+	archiveBytes := int64(0)
+	for _, group := range []string{"38/-76", "38/-74", "40/-76", "40/-74"} {
+		lat, lon, _ := strings.Cut(group, "/")
+		name := fmt.Sprintf("offline/%s/%s.000000_%s.000000_%s.250000_%s.750000", group, lat, lon, lat, lon)
+		writeTestGroup(t, mirror, map[string]string{name: group})
+	}
+	err := WriteGroupManifests(mirror)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lock sync.Mutex
+	active, maxActive := 0, 0
+	files := http.FileServer(http.Dir(mirror))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".tar.gz") {
+			lock.Lock()
+			active++
+			if active > maxActive {
+				maxActive = active
+			}
+			lock.Unlock()
+			time.Sleep(50 * time.Millisecond)
+			defer func() {
+				lock.Lock()
+				active--
+				lock.Unlock()
+			}()
+		}
+		files.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	DOWNLOAD_SOURCES = []string{server.URL}
+
+	progress = DownloadProgress{LocationDetails: map[string]*DownloadLocationDetail{"TEST": {}}}
+	err = DownloadBounds(context.Background(), Bounds{MinLat: 38, MinLon: -76, MaxLat: 42, MaxLon: -72}, "TEST", map[string]bool{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, group := range []string{"38/-76", "38/-74", "40/-76", "40/-74"} {
+		manifest, err := FetchManifest(context.Background(), fmt.Sprintf("%s/offline/%s%s", server.URL, group, MANIFEST_SUFFIX))
+		if err != nil {
+			t.Fatal(err)
+		}
+		archiveBytes += manifest.Archive.Size
+	}
+
+	results := fmt.Sprintf("max parallel downloads: %d\n", maxActive)
+	results += fmt.Sprintf("downloaded files: %d location: %d\n", progress.DownloadedFiles, progress.LocationDetails["TEST"].DownloadedFiles)
+	results += fmt.Sprintf("downloaded all bytes: %v active: %d\n", progress.DownloadedBytes == archiveBytes, progress.ActiveDownloads)
+	results += fmt.Sprintf("concurrency: %d partial files: %d\n", progress.Concurrency, len(progress.PartialFiles))
+
+	cupaloy.SnapshotT(t, results)
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+var DEM_CACHE_TILES = 64 // how many elevation tiles to keep in memory while generating
+
+// A grid of elevation samples. Rows run from north to south and columns from
+// west to east, north and west are the coordinates of the first sample.
+type demTile struct {
+	north   float64
+	west    float64
+	latStep float64
+	lonStep float64
+	width   int
+	height  int
+	data    []float32
+	noData  float32
+}
+
+func (t *demTile) at(x int, y int) (float32, bool) {
+	v := t.data[y*t.width+x]
+	if v == t.noData || v == -32768 || math.IsNaN(float64(v)) {
+		return 0, false
+	}
+	return v, true
+}
+
+// Bilinear interpolation of the elevation at a position
+func (t *demTile) sample(lat float64, lon float64) (float64, bool) {
+	x := (lon - t.west) / t.lonStep
+	y := (t.north - lat) / t.latStep
+	if x < 0 || y < 0 || x > float64(t.width-1) || y > float64(t.height-1) {
+		return 0, false
+	}
+	x0 := int(math.Floor(x))
+	y0 := int(math.Floor(y))
+	x1 := x0 + 1
+	y1 := y0 + 1
+	if x1 > t.width-1 {
+		x1 = t.width - 1
+	}
+	if y1 > t.height-1 {
+		y1 = t.height - 1
+	}
+	fx := x - float64(x0)
+	fy := y - float64(y0)
+
+	v00, ok00 := t.at(x0, y0)
+	v10, ok10 := t.at(x1, y0)
+	v01, ok01 := t.at(x0, y1)
+	v11, ok11 := t.at(x1, y1)
+	if !ok00 || !ok10 || !ok01 || !ok11 {
+		return 0, false
+	}
+	top := float64(v00)*(1-fx) + float64(v10)*fx
+	bottom := float64(v01)*(1-fx) + float64(v11)*fx
+	return top*(1-fy) + bottom*fy, true
+}
+
+type geoTiffFile struct {
+	path   string
+	north  float64
+	west   float64
+	south  float64
+	east   float64
+	header geoTiffHeader
+}
+
+// Samples elevations from a directory of SRTM .hgt tiles and/or GeoTIFF files
+type DEM struct {
+	dir      string
+	geoTiffs []geoTiffFile
+	tiles    map[string]*demTile
+	order    []string
+}
+
+func OpenDEM(dir string) (*DEM, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read elevation directory")
+	}
+	dem := &DEM{
+		dir:   dir,
+		tiles: map[string]*demTile{},
+	}
+	for _, entry := range entries {
+		name := strings.ToLower(entry.Name())
+		if !strings.HasSuffix(name, ".tif") && !strings.HasSuffix(name, ".tiff") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		header, err := readGeoTiffHeader(path)
+		if err != nil {
+			logwe(errors.Wrapf(err, "skipping elevation file %s", path))
+			continue
+		}
+		dem.geoTiffs = append(dem.geoTiffs, geoTiffFile{
+			path:   path,
+			north:  header.tile.north,
+			west:   header.tile.west,
+			south:  header.tile.north - float64(header.tile.height-1)*header.tile.latStep,
+			east:   header.tile.west + float64(header.tile.width-1)*header.tile.lonStep,
+			header: header,
+		})
+	}
+	log.Info().Str("dir", dir).Int("geotiffs", len(dem.geoTiffs)).Msg("Opened elevation data")
+	return dem, nil
+}
+
+func hgtName(lat float64, lon float64) string {
+	latDir := "N"
+	if lat < 0 {
+		latDir = "S"
+	}
+	lonDir := "E"
+	if lon < 0 {
+		lonDir = "W"
+	}
+	return fmt.Sprintf("%s%02d%s%03d.hgt", latDir, int(math.Abs(lat)), lonDir, int(math.Abs(lon)))
+}
+
+func (d *DEM) cache(key string, tile *demTile) {
+	if len(d.order) >= DEM_CACHE_TILES {
+		delete(d.tiles, d.order[0])
+		d.order = d.order[1:]
+	}
+	d.tiles[key] = tile
+	d.order = append(d.order, key)
+}
+
+func (d *DEM) hgtTile(lat float64, lon float64) *demTile {
+	name := hgtName(math.Floor(lat), math.Floor(lon))
+	if tile, ok := d.tiles[name]; ok {
+		return tile
+	}
+	tile, err := readHgt(filepath.Join(d.dir, name), math.Floor(lat), math.Floor(lon))
+	if err != nil && !os.IsNotExist(errors.Cause(err)) {
+		logwe(errors.Wrapf(err, "could not read elevation tile %s", name))
+	}
+	// also cache misses so missing tiles are only looked up once
+	d.cache(name, tile)
+	return tile
+}
+
+// Returns the elevation in meters at a position and whether there was data for it
+func (d *DEM) Elevation(lat float64, lon float64) (float64, bool) {
+	if tile := d.hgtTile(lat, lon); tile != nil {
+		if elevation, ok := tile.sample(lat, lon); ok {
+			return elevation, true
+		}
+	}
+	for _, gt := range d.geoTiffs {
+		if lat > gt.north || lat < gt.south || lon < gt.west || lon > gt.east {
+			continue
+		}
+		tile, ok := d.tiles[gt.path]
+		if !ok {
+			var err error
+			tile, err = readGeoTiff(gt.path, gt.header)
+			logwe(errors.Wrapf(err, "could not read elevation file %s", gt.path))
+			d.cache(gt.path, tile)
+		}
+		if tile == nil {
+			continue
+		}
+		if elevation, ok := tile.sample(lat, lon); ok {
+			return elevation, true
+		}
+	}
+	return 0, false
+}
+
+// Reads an SRTM .hgt tile. These are square grids of big endian int16 samples
+// covering one degree where the edges are shared with the neighbouring tiles.
+func readHgt(path string, lat float64, lon float64) (*demTile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read hgt file")
+	}
+	size := int(math.Sqrt(float64(len(data) / 2)))
+	if size < 2 || size*size*2 != len(data) {
+		return nil, errors.Errorf("unexpected hgt file size %d", len(data))
+	}
+	tile := &demTile{
+		north:   lat + 1,
+		west:    lon,
+		latStep: 1 / float64(size-1),
+		lonStep: 1 / float64(size-1),
+		width:   size,
+		height:  size,
+		data:    make([]float32, size*size),
+		noData:  -32768,
+	}
+	for i := range tile.data {
+		tile.data[i] = float32(int16(binary.BigEndian.Uint16(data[i*2:])))
+	}
+	return tile, nil
+}
+
+type geoTiffHeader struct {
+	order         binary.ByteOrder
+	tile          demTile
+	bitsPerSample int
+	sampleFormat  int
+	stripOffsets  []float64
+	stripCounts   []float64
+}
+
+// Only uncompressed, single band, stripped GeoTIFFs with int16 or float32
+// samples are supported, which is what most DEM tools can export.
+func readGeoTiffHeader(path string) (geoTiffHeader, error) {
+	header := geoTiffHeader{sampleFormat: 1}
+	f, err := os.Open(path)
+	if err != nil {
+		return header, errors.Wrap(err, "could not open geotiff")
+	}
+	defer f.Close()
+
+	buf := make([]byte, 8)
+	if _, err := f.ReadAt(buf, 0); err != nil {
+		return header, errors.Wrap(err, "could not read geotiff header")
+	}
+	switch string(buf[:2]) {
+	case "II":
+		header.order = binary.LittleEndian
+	case "MM":
+		header.order = binary.BigEndian
+	default:
+		return header, errors.New("not a tiff file")
+	}
+	if header.order.Uint16(buf[2:]) != 42 {
+		return header, errors.New("unsupported tiff version")
+	}
+	ifd := int64(header.order.Uint32(buf[4:]))
+
+	countBuf := make([]byte, 2)
+	if _, err := f.ReadAt(countBuf, ifd); err != nil {
+		return header, errors.Wrap(err, "could not read tiff directory")
+	}
+	count := int(header.order.Uint16(countBuf))
+	entries := make([]byte, count*12)
+	if _, err := f.ReadAt(entries, ifd+2); err != nil {
+		return header, errors.Wrap(err, "could not read tiff directory entries")
+	}
+
+	var scale, tiepoint []float64
+	compression := 1
+	samplesPerPixel := 1
+	header.tile.noData = -32768
+	for i := 0; i < count; i++ {
+		entry := entries[i*12 : i*12+12]
+		tag := header.order.Uint16(entry)
+		if tag == 42113 {
+			noData, err := readTiffASCII(f, header.order, entry)
+			if err == nil {
+				if v, err := strconv.ParseFloat(strings.TrimSpace(noData), 32); err == nil {
+					header.tile.noData = float32(v)
+				}
+			}
+			continue
+		}
+		values, err := readTiffValues(f, header.order, entry)
+		if err != nil || len(values) == 0 {
+			continue
+		}
+		switch tag {
+		case 256:
+			header.tile.width = int(values[0])
+		case 257:
+			header.tile.height = int(values[0])
+		case 258:
+			header.bitsPerSample = int(values[0])
+		case 259:
+			compression = int(values[0])
+		case 273:
+			header.stripOffsets = values
+		case 277:
+			samplesPerPixel = int(values[0])
+		case 279:
+			header.stripCounts = values
+		case 339:
+			header.sampleFormat = int(values[0])
+		case 33550:
+			scale = values
+		case 33922:
+			tiepoint = values
+		}
+	}
+
+	if compression != 1 || samplesPerPixel != 1 {
+		return header, errors.New("only uncompressed single band geotiffs are supported")
+	}
+	if len(header.stripOffsets) == 0 || len(header.stripOffsets) != len(header.stripCounts) {
+		return header, errors.New("only stripped geotiffs are supported")
+	}
+	if !(header.bitsPerSample == 16 && header.sampleFormat != 3) && !(header.bitsPerSample == 32 && header.sampleFormat == 3) {
+		return header, errors.New("only int16 and float32 samples are supported")
+	}
+	if len(scale) < 2 || len(tiepoint) < 6 || header.tile.width < 2 || header.tile.height < 2 {
+		return header, errors.New("missing geotiff georeferencing")
+	}
+	// samples are areas, the tie point is the corner of the first one
+	header.tile.lonStep = scale[0]
+	header.tile.latStep = scale[1]
+	header.tile.west = tiepoint[3] - tiepoint[0]*scale[0] + scale[0]/2
+	header.tile.north = tiepoint[4] + tiepoint[1]*scale[1] - scale[1]/2
+	return header, nil
+}
+
+func readGeoTiff(path string, header geoTiffHeader) (*demTile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not open geotiff")
+	}
+	defer f.Close()
+
+	tile := header.tile
+	tile.data = make([]float32, 0, tile.width*tile.height)
+	sampleSize := header.bitsPerSample / 8
+	for i, offset := range header.stripOffsets {
+		strip := make([]byte, int(header.stripCounts[i]))
+		if _, err := f.ReadAt(strip, int64(offset)); err != nil && err != io.EOF {
+			return nil, errors.Wrap(err, "could not read geotiff strip")
+		}
+		for j := 0; j+sampleSize <= len(strip) && len(tile.data) < cap(tile.data); j += sampleSize {
+			if sampleSize == 2 {
+				tile.data = append(tile.data, float32(int16(header.order.Uint16(strip[j:]))))
+			} else {
+				tile.data = append(tile.data, math.Float32frombits(header.order.Uint32(strip[j:])))
+			}
+		}
+	}
+	if len(tile.data) != tile.width*tile.height {
+		return nil, errors.New("geotiff is missing samples")
+	}
+	return &tile, nil
+}
+
+var tiffTypeSizes = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 11: 4, 12: 8}
+
+func readTiffData(f *os.File, order binary.ByteOrder, entry []byte) ([]byte, uint16, int, error) {
+	typ := order.Uint16(entry[2:])
+	count := int(order.Uint32(entry[4:]))
+	size, ok := tiffTypeSizes[typ]
+	if !ok {
+		return nil, typ, count, errors.Errorf("unsupported tiff type %d", typ)
+	}
+	if size*count <= 4 {
+		return entry[8 : 8+size*count], typ, count, nil
+	}
+	data := make([]byte, size*count)
+	_, err := f.ReadAt(data, int64(order.Uint32(entry[8:])))
+	return data, typ, count, errors.Wrap(err, "could not read tiff values")
+}
+
+func readTiffValues(f *os.File, order binary.ByteOrder, entry []byte) ([]float64, error) {
+	data, typ, count, err := readTiffData(f, order, entry)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]float64, count)
+	for i := range values {
+		switch typ {
+		case 1, 2:
+			values[i] = float64(data[i])
+		case 3:
+			values[i] = float64(order.Uint16(data[i*2:]))
+		case 4:
+			values[i] = float64(order.Uint32(data[i*4:]))
+		case 11:
+			values[i] = float64(math.Float32frombits(order.Uint32(data[i*4:])))
+		case 12:
+			values[i] = math.Float64frombits(order.Uint64(data[i*8:]))
+		}
+	}
+	return values, nil
+}
+
+func readTiffASCII(f *os.File, order binary.ByteOrder, entry []byte) (string, error) {
+	data, _, _, err := readTiffData(f, order, entry)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\x00"), nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bradleyjkemp/cupaloy"
+)
+
+func TestDEMElevation(t *testing.T) {
+	dir := t.TempDir()
+	// 3x3 samples covering N50E016, rising 10 meters per sample to the east
+	data := make([]byte, 3*3*2)
+	for row := 0; row < 3; row++ {
+		for col := 0; col < 3; col++ {
+			binary.BigEndian.PutUint16(data[(row*3+col)*2:], uint16(100+10*col))
+		}
+	}
+	err := os.WriteFile(filepath.Join(dir, "N50E016.hgt"), data, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dem, err := OpenDEM(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	center, _ := dem.Elevation(50.5, 16.5)
+	quarter, _ := dem.Elevation(50.5, 16.25)
+	_, missing := dem.Elevation(51.5, 16.5)
+
+	cupaloy.SnapshotT(t, "Should be 110", center, "Should be 105", quarter, "Should have no data", missing)
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"archive/tar"
 	"compress/gzip"
+	"context"
 	_ "embed"
 	"encoding/json"
 	"fmt"
@@ -10,7 +11,14 @@ import (
 	"math"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
@@ -37,29 +45,165 @@ var (
 	_           = json.Unmarshal(statesBoundingBoxesJson, &STATE_BOXES)
 )
 
-func DownloadFile(url string, filepath string) (err error) {
+var (
+	DOWNLOAD_RETRIES           = 5               // attempts after the first failed one before a file is skipped
+	DOWNLOAD_RETRY_DELAY       = 2 * time.Second // delay before the first retry, doubled after every failed attempt
+	DOWNLOAD_MAX_RETRY_DELAY   = time.Minute     // upper bound of the retry delay
+	DOWNLOAD_IDLE_TIMEOUT      = 2 * time.Minute // how long an attempt may receive no data before it is retried
+	DOWNLOAD_PROGRESS_INTERVAL = time.Second     // how often the progress of a partial file is written
+)
+
+// A download error that retrying will not fix
+type permanentDownloadError struct {
+	error
+}
+
+// Downloads a file, resuming from the data already in filepath with a Range
+// request. Failed attempts and attempts that receive no data for
+// DOWNLOAD_IDLE_TIMEOUT are retried with an exponential backoff until
+// DOWNLOAD_RETRIES run out, the partial file is kept so a later download
+// continues where this one stopped. A partial file is only
+// resumed from the url it was started from and, with If-Range, only while the
+// file there is unchanged.
+func DownloadFile(ctx context.Context, url string, filepath string) (err error) {
 	log.Info().Msgf("Downloading: %s\n", url)
-	// Create the file
-	out, err := os.Create(filepath)
+	delay := DOWNLOAD_RETRY_DELAY
+	for attempt := 0; ; attempt++ {
+		// the timeout is measured from the last data received, so that large
+		// files can take as long as they need under a bandwidth limit
+		attemptCtx, cancel := context.WithCancel(ctx)
+		idle := time.AfterFunc(DOWNLOAD_IDLE_TIMEOUT, cancel)
+		err = downloadAttempt(attemptCtx, url, filepath, attempt, idle)
+		stalled := !idle.Stop()
+		cancel()
+		if err == nil {
+			removePartialSource(filepath)
+			return nil
+		}
+		if ctx.Err() != nil {
+			return errors.Wrap(ctx.Err(), "download stopped")
+		}
+		if stalled {
+			err = errors.Wrapf(err, "download received no data for %s", DOWNLOAD_IDLE_TIMEOUT)
+		}
+		var permanent permanentDownloadError
+		if errors.As(err, &permanent) || attempt >= DOWNLOAD_RETRIES {
+			return err
+		}
+		log.Warn().Err(err).Str("url", url).Int("attempt", attempt+1).Dur("delay", delay).Msg("Download failed, retrying")
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "download stopped")
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > DOWNLOAD_MAX_RETRY_DELAY {
+			delay = DOWNLOAD_MAX_RETRY_DELAY
+		}
+	}
+}
+
+// Downloads the rest of a file once, receiving data resets the idle timer
+func downloadAttempt(ctx context.Context, url string, filepath string, attempt int, idle *time.Timer) error {
+	out, err := os.OpenFile(filepath, os.O_CREATE|os.O_WRONLY, 0o644)
 	if err != nil {
-		return errors.Wrap(err, "could not create file for download")
+		return permanentDownloadError{errors.Wrap(err, "could not create file for download")}
 	}
 	defer out.Close()
+	offset, err := out.Seek(0, io.SeekEnd)
+	if err != nil {
+		return errors.Wrap(err, "could not seek to the end of the partial download")
+	}
+	source := readPartialSource(filepath)
+	if offset > 0 && source.URL != url {
+		// the partial file was started from another source, which may serve
+		// another release of the file
+		log.Info().Str("url", url).Str("partial_url", source.URL).Msg("Not resuming a partial download of another source")
+		err = out.Truncate(0)
+		if err != nil {
+			return errors.Wrap(err, "could not truncate partial download")
+		}
+		offset, err = out.Seek(0, io.SeekStart)
+		if err != nil {
+			return errors.Wrap(err, "could not seek to the start of the download")
+		}
+	}
 
-	// Get the data
-	resp, err := http.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return permanentDownloadError{errors.Wrap(err, "could not create download request")}
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		// the server sends the whole file instead of the range if it changed
+		if validator := source.validator(); len(validator) > 0 {
+			req.Header.Set("If-Range", validator)
+		}
+	}
+	client, err := sourceClient(url)
+	if err != nil {
+		return permanentDownloadError{err}
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return errors.Wrap(err, "could not download the file data")
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusPartialContent {
+		err = writePartialSource(filepath, partialSource{URL: url, ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")})
+		if err != nil {
+			return permanentDownloadError{err}
+		}
+	}
 
-	// Check server response
-	if resp.StatusCode != http.StatusOK {
+	total := resp.ContentLength
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+		var start, end, size int64
+		_, err = fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &size)
+		if err != nil || start != offset {
+			return restartDownload(out, "download received an unexpected content range")
+		}
+		total = size
+		log.Info().Str("url", url).Int64("offset", offset).Msg("Resuming download")
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		var size int64
+		_, err = fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes */%d", &size)
+		if err == nil && size == offset {
+			return nil // the partial file was already complete
+		}
+		return restartDownload(out, "download could not be resumed")
+	case resp.StatusCode == http.StatusOK:
+		// the server sent the whole file
+		if offset > 0 {
+			err = out.Truncate(0)
+			if err != nil {
+				return errors.Wrap(err, "could not truncate partial download")
+			}
+			_, err = out.Seek(0, io.SeekStart)
+			if err != nil {
+				return errors.Wrap(err, "could not seek to the start of the download")
+			}
+			offset = 0
+		}
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests:
+		return permanentDownloadError{errors.Errorf("download received bad status: %s", resp.Status)}
+	default:
 		return errors.Errorf("download received bad status: %s", resp.Status)
 	}
+	if total < 0 {
+		// the file transport of local sources only sets the header
+		total, err = strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+		if err != nil || total < 0 {
+			total = 0
+		}
+	}
 
-	// Writer the body to file
-	_, err = io.Copy(out, resp.Body)
+	// Write the body to file
+	partial := PartialDownload{File: filepath, Bytes: offset, TotalBytes: total, Attempt: attempt + 1}
+	reader := &progressReader{reader: &limitedReader{ctx: ctx, reader: resp.Body, limiter: downloadLimiter}, partial: &partial, idle: idle}
+	_, err = io.Copy(out, reader)
+	reader.report()
 	if err != nil {
 		return errors.Wrap(err, "could not write download data to file")
 	}
@@ -67,10 +211,97 @@ func DownloadFile(url string, filepath string) (err error) {
 	if err != nil {
 		return errors.Wrap(err, "could not fsync downloaded file")
 	}
-
+	if partial.TotalBytes > 0 && partial.Bytes != partial.TotalBytes {
+		return errors.Errorf("download ended after %d of %d bytes", partial.Bytes, partial.TotalBytes)
+	}
 	return nil
 }
 
+// Where a partial download came from, kept next to it
+type partialSource struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag"`
+	LastModified string `json:"last_modified"`
+}
+
+// The If-Range value of a partial download, weak etags can not be used for ranges
+func (s partialSource) validator() string {
+	if len(s.ETag) > 0 && !strings.HasPrefix(s.ETag, "W/") {
+		return s.ETag
+	}
+	return s.LastModified
+}
+
+func partialSourceName(file string) string {
+	return file + ".source"
+}
+
+func readPartialSource(file string) partialSource {
+	source := partialSource{}
+	data, err := os.ReadFile(partialSourceName(file))
+	if err == nil {
+		logwe(errors.Wrap(json.Unmarshal(data, &source), "could not unmarshal partial download source"))
+	}
+	return source
+}
+
+func writePartialSource(file string, source partialSource) error {
+	data, err := json.Marshal(source)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal partial download source")
+	}
+	return errors.Wrap(os.WriteFile(partialSourceName(file), data, 0o644), "could not write partial download source")
+}
+
+func removePartialSource(file string) {
+	err := os.Remove(partialSourceName(file))
+	if err != nil && !os.IsNotExist(err) {
+		logde(errors.Wrap(err, "could not remove partial download source"))
+	}
+}
+
+// Throws away a partial download that can not be continued, the next attempt starts from the beginning
+func restartDownload(out *os.File, reason string) error {
+	err := out.Truncate(0)
+	if err != nil {
+		return errors.Wrap(err, "could not truncate partial download")
+	}
+	return errors.New(reason + ", starting over")
+}
+
+// Counts the bytes of a download and writes them to the progress param
+type progressReader struct {
+	reader     io.Reader
+	partial    *PartialDownload
+	unreported int64
+	lastWrite  time.Time
+	idle       *time.Timer // reset whenever data is received
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 && r.idle != nil {
+		r.idle.Reset(DOWNLOAD_IDLE_TIMEOUT)
+	}
+	r.partial.Bytes += int64(n)
+	r.unreported += int64(n)
+	if time.Since(r.lastWrite) >= DOWNLOAD_PROGRESS_INTERVAL {
+		r.lastWrite = time.Now()
+		r.report()
+	}
+	return n, err
+}
+
+// Adds the bytes read since the last report to the download progress
+func (r *progressReader) report() {
+	partial, bytes := *r.partial, r.unreported
+	r.unreported = 0
+	UpdateDownloadProgress(func(p *DownloadProgress) {
+		p.DownloadedBytes += bytes
+		setPartialDownload(p, partial)
+	})
+}
+
 type Bounds struct {
 	MinLat float64 `json:"min_lat"`
 	MinLon float64 `json:"min_lon"`
@@ -88,6 +319,22 @@ type DownloadProgress struct {
 	DownloadedFiles     int                                `json:"downloaded_files"`
 	LocationsToDownload []string                           `json:"locations_to_download"`
 	LocationDetails     map[string]*DownloadLocationDetail `json:"location_details"`
+	PartialFiles        []PartialDownload                  `json:"partial_files"`
+	RejectedEntries     []RejectedEntry                    `json:"rejected_entries"`
+	DownloadedBytes     int64                              `json:"downloaded_bytes"` // bytes received by all downloads
+	ActiveDownloads     int                                `json:"active_downloads"`
+	Concurrency         int                                `json:"concurrency"`
+	BandwidthLimit      int64                              `json:"bandwidth_limit"` // bytes per second, 0 for no limit
+	Jobs                []DownloadJob                      `json:"jobs"`
+	Paused              bool                               `json:"paused"`
+}
+
+// A file that is being downloaded or was left incomplete to be resumed later
+type PartialDownload struct {
+	File       string `json:"file"`
+	Bytes      int64  `json:"bytes"`
+	TotalBytes int64  `json:"total_bytes"` // 0 when the server did not send the size
+	Attempt    int    `json:"attempt"`
 }
 
 type DownloadLocationDetail struct {
@@ -95,68 +342,104 @@ type DownloadLocationDetail struct {
 	DownloadedFiles int `json:"location_downloaded_files"`
 }
 
-var progress DownloadProgress
+func newDownloadProgress() DownloadProgress {
+	return DownloadProgress{
+		LocationsToDownload: []string{},
+		LocationDetails:     map[string]*DownloadLocationDetail{},
+		PartialFiles:        []PartialDownload{},
+		RejectedEntries:     []RejectedEntry{},
+		Jobs:                []DownloadJob{},
+	}
+}
+
+var (
+	progress     = newDownloadProgress()
+	progressLock sync.Mutex // several downloads update the progress at once
+)
+
+// Changes the download progress and writes it to the progress param
+func UpdateDownloadProgress(update func(p *DownloadProgress)) {
+	progressLock.Lock()
+	defer progressLock.Unlock()
+	update(&progress)
+
+	progressData, err := json.Marshal(progress)
+	if err != nil {
+		logde(errors.Wrap(err, "could not marshal download progress"))
+	}
+
+	err = PutParam(DOWNLOAD_PROGRESS, progressData)
+	if err != nil {
+		logwe(errors.Wrap(err, "could not write download progress"))
+	}
+}
+
+func WriteDownloadProgress() {
+	UpdateDownloadProgress(func(p *DownloadProgress) {})
+}
+
+func setPartialDownload(p *DownloadProgress, partial PartialDownload) {
+	for i := range p.PartialFiles {
+		if p.PartialFiles[i].File == partial.File {
+			p.PartialFiles[i] = partial
+			return
+		}
+	}
+	p.PartialFiles = append(p.PartialFiles, partial)
+}
+
+// Adds or updates a partial file in the download progress
+func SetPartialDownload(partial PartialDownload) {
+	UpdateDownloadProgress(func(p *DownloadProgress) {
+		setPartialDownload(p, partial)
+	})
+}
+
+// Removes a completed file from the partial files of the download progress
+func RemovePartialDownload(file string) {
+	progressLock.Lock()
+	defer progressLock.Unlock()
+	for i := range progress.PartialFiles {
+		if progress.PartialFiles[i].File == file {
+			progress.PartialFiles = append(progress.PartialFiles[:i], progress.PartialFiles[i+1:]...)
+			return
+		}
+	}
+}
 
-func AddLocationDetailsToProgress(locationNames []string, locationType string) {
+func AddLocationDetailsToProgress(p *DownloadProgress, locationNames []string, locationType string) {
 	for _, locationName := range locationNames {
-		if _, ok := progress.LocationDetails[locationName]; !ok {
-			progress.LocationDetails[locationName] = &DownloadLocationDetail{
+		if _, ok := p.LocationDetails[locationName]; !ok {
+			p.LocationDetails[locationName] = &DownloadLocationDetail{
 				TotalFiles: countTotalFiles([]string{locationName}, locationType),
 			}
 		}
 	}
 }
 
+// Applies download controls and queues the downloads requested through the
+// download params, the download worker runs them without blocking the main
+// loop. The params are emptied as they are read, so a request written during
+// a download is queued by the next loop.
 func DownloadIfTriggered() {
-	progress = DownloadProgress{
-		LocationsToDownload: []string{},
-		LocationDetails:     map[string]*DownloadLocationDetail{},
+	b, err := TakeParam(DOWNLOAD_CONTROL)
+	logwe(err)
+	if err == nil && len(b) != 0 {
+		logwe(errors.Wrap(downloadQueue.Control(b), "could not apply download control"))
 	}
 
-	b, err := GetParam(DOWNLOAD_LOCATIONS)
+	b, err = TakeParam(DOWNLOAD_LOCATIONS)
 	logwe(err)
 	if err == nil && len(b) != 0 {
 		var locations DownloadLocations
 		err = json.Unmarshal(b, &locations)
 		logwe(err)
-
-		progress.LocationsToDownload = append(locations.Nations, locations.States...)
-		progress.TotalFiles = countTotalFiles(locations.Nations, "nation") + countTotalFiles(locations.States, "state")
-
-		AddLocationDetailsToProgress(locations.Nations, "nation")
-		AddLocationDetailsToProgress(locations.States, "state")
-
 		if err == nil {
-			for _, location := range locations.Nations {
-				lData, ok := NATION_BOXES[location]
-				if ok {
-					log.Info().Msgf("downloading nation: %s", NATION_BOXES[location].FullName)
-					err = DownloadBounds(lData.BoundingBox, location)
-					if err != nil {
-						logie(err)
-					}
-				} else {
-					log.Warn().Msgf("no bounding box data for nation code: %s", location)
-				}
-			}
-			for _, location := range locations.States {
-				lData, ok := STATE_BOXES[location]
-				if ok {
-					log.Info().Msgf("downloading state: %s", STATE_BOXES[location].FullName)
-					err = DownloadBounds(lData.BoundingBox, location)
-					if err != nil {
-						logie(err)
-					}
-				} else {
-					log.Warn().Msgf("no bounding box data for state code: %s", location)
-				}
-			}
+			downloadQueue.Add(DownloadJob{Locations: locations})
 		}
 	}
-	err = PutParam(DOWNLOAD_LOCATIONS, []byte{})
-	logwe(err)
 
-	b, err = GetParam(DOWNLOAD_BOUNDS)
+	b, err = TakeParam(DOWNLOAD_BOUNDS)
 	logwe(err)
 	if err == nil && len(b) != 0 {
 		var bounds Bounds
@@ -164,14 +447,110 @@ func DownloadIfTriggered() {
 		logde(err)
 
 		if err == nil {
-			err = DownloadBounds(bounds, "CUSTOM")
+			downloadQueue.Add(DownloadJob{Bounds: &bounds})
+		}
+	}
+}
+
+// Downloads the locations and bounds of a job one after another until ctx is
+// done. completed holds the groups the job already installed, they are
+// skipped and the ones installed now are added. Returns the errors of the
+// locations that could not be downloaded.
+func RunDownloadJob(ctx context.Context, job DownloadJob, completed map[string]bool) []string {
+	jobErrors := []string{}
+	err := CheckDiskBudget(ctx, DownloadSources(), jobGroups(job, completed), LoadDownloadSettings())
+	if err != nil {
+		if ctx.Err() == nil {
+			logwe(err)
+			jobErrors = append(jobErrors, fmt.Sprintf("not enough disk budget: %v", err))
+		}
+		return jobErrors
+	}
+	download := func(bounds Bounds, location string, key string) {
+		err := DownloadBounds(ctx, bounds, location, completed)
+		if err != nil && ctx.Err() == nil {
 			logie(err)
-			if err == nil {
-				err = PutParam(DOWNLOAD_BOUNDS, []byte{})
-				logwe(err)
+			jobErrors = append(jobErrors, fmt.Sprintf("%s: %v", location, err))
+		}
+		// remembered so that deleting a neighbour keeps the groups they share
+		if len(key) > 0 {
+			logwe(errors.Wrap(RecordGroupLocation(boundsGroups(bounds), key, completed), "could not record group location"))
+		}
+	}
+	for _, location := range job.Locations.Nations {
+		lData, ok := NATION_BOXES[location]
+		if ok {
+			log.Info().Msgf("downloading nation: %s", NATION_BOXES[location].FullName)
+			download(lData.BoundingBox, location, LocationKey("nation", location))
+		} else {
+			log.Warn().Msgf("no bounding box data for nation code: %s", location)
+			jobErrors = append(jobErrors, fmt.Sprintf("%s: no bounding box data for nation code", location))
+		}
+	}
+	for _, location := range job.Locations.States {
+		lData, ok := STATE_BOXES[location]
+		if ok {
+			log.Info().Msgf("downloading state: %s", STATE_BOXES[location].FullName)
+			download(lData.BoundingBox, location, LocationKey("state", location))
+		} else {
+			log.Warn().Msgf("no bounding box data for state code: %s", location)
+			jobErrors = append(jobErrors, fmt.Sprintf("%s: no bounding box data for state code", location))
+		}
+	}
+	if job.Bounds != nil {
+		download(*job.Bounds, "CUSTOM", "")
+	}
+	if len(job.Groups) > 0 {
+		groups := []GroupArea{}
+		for _, name := range job.Groups {
+			group, err := ParseGroupArea(name)
+			if err != nil {
+				jobErrors = append(jobErrors, err.Error())
+				continue
 			}
+			groups = append(groups, group)
+		}
+		err := DownloadGroups(ctx, groups, "UPDATE", completed)
+		if err != nil && ctx.Err() == nil {
+			logie(err)
+			jobErrors = append(jobErrors, fmt.Sprintf("UPDATE: %v", err))
+		}
+	}
+	return jobErrors
+}
+
+// The groups of a job that are not in completed, unknown locations and
+// invalid group names are left out
+func jobGroups(job DownloadJob, completed map[string]bool) []GroupArea {
+	areas := []GroupArea{}
+	for _, location := range job.Locations.Nations {
+		if lData, ok := NATION_BOXES[location]; ok {
+			areas = append(areas, boundsGroups(lData.BoundingBox)...)
+		}
+	}
+	for _, location := range job.Locations.States {
+		if lData, ok := STATE_BOXES[location]; ok {
+			areas = append(areas, boundsGroups(lData.BoundingBox)...)
+		}
+	}
+	if job.Bounds != nil {
+		areas = append(areas, boundsGroups(*job.Bounds)...)
+	}
+	for _, name := range job.Groups {
+		if group, err := ParseGroupArea(name); err == nil {
+			areas = append(areas, group)
 		}
 	}
+	groups := []GroupArea{}
+	seen := map[string]bool{}
+	for _, group := range areas {
+		if completed[group.String()] || seen[group.String()] {
+			continue
+		}
+		seen[group.String()] = true
+		groups = append(groups, group)
+	}
+	return groups
 }
 
 func adjustedBounds(bounds Bounds) (int, int, int, int) {
@@ -189,92 +568,381 @@ func adjustedBounds(bounds Bounds) (int, int, int, int) {
 	return minLat, minLon, maxLat, maxLon
 }
 
-func DownloadBounds(bounds Bounds, locationName string) (err error) {
-	log.Info().Msgf("Downloading Bounds: %f, %f, %f, %f\n", bounds.MinLat, bounds.MinLon, bounds.MaxLat, bounds.MaxLon)
+// A 2x2 degree group named after its south west corner, such as 38/-76
+type GroupArea struct {
+	Lat int
+	Lon int
+}
 
+func (g GroupArea) String() string {
+	return fmt.Sprintf("%d/%d", g.Lat, g.Lon)
+}
+
+func ParseGroupArea(name string) (GroupArea, error) {
+	group := GroupArea{}
+	_, err := fmt.Sscanf(name, "%d/%d", &group.Lat, &group.Lon)
+	if err != nil || group.String() != name || group.Lat%GROUP_AREA_BOX_DEGREES != 0 || group.Lon%GROUP_AREA_BOX_DEGREES != 0 {
+		return group, errors.Errorf("invalid group %q", name)
+	}
+	return group, nil
+}
+
+// The groups that cover bounds
+func boundsGroups(bounds Bounds) []GroupArea {
 	// clip given bounds to file areas
 	minLat, minLon, maxLat, maxLon := adjustedBounds(bounds)
-	progress.LocationDetails[locationName].TotalFiles = countFilesForBounds(bounds)
-
+	groups := []GroupArea{}
 	for i := minLat; i < maxLat; i += GROUP_AREA_BOX_DEGREES {
 		for j := minLon; j < maxLon; j += GROUP_AREA_BOX_DEGREES {
-			filename := fmt.Sprintf("offline/%d/%d.tar.gz", i, j)
-			url := fmt.Sprintf("https://map-data.pfeifer.dev/%s", filename)
-			outputName := filepath.Join(GetBaseOpPath(), "tmp", filename)
-			err := os.MkdirAll(filepath.Dir(outputName), 0o775)
-			logde(errors.Wrap(err, "failed to make output directory"))
-			err = DownloadFile(url, outputName)
-			if err != nil {
-				logwe(errors.Wrap(err, "failed to download file, continuing to next"))
-				continue
+			groups = append(groups, GroupArea{Lat: i, Lon: j})
+		}
+	}
+	return groups
+}
+
+// Downloads the groups of bounds that are not in completed and adds the
+// installed ones to it. Stops starting new groups once ctx is done.
+func DownloadBounds(ctx context.Context, bounds Bounds, locationName string, completed map[string]bool) error {
+	log.Info().Msgf("Downloading Bounds: %f, %f, %f, %f\n", bounds.MinLat, bounds.MinLon, bounds.MaxLat, bounds.MaxLon)
+	err := DownloadGroups(ctx, boundsGroups(bounds), locationName, completed)
+	if ctx.Err() != nil {
+		log.Info().Msgf("Stopped Downloading Bounds: %f, %f, %f, %f\n", bounds.MinLat, bounds.MinLon, bounds.MaxLat, bounds.MaxLon)
+		return err
+	}
+	log.Info().Msgf("Finished Downloading Bounds: %f, %f, %f, %f\n", bounds.MinLat, bounds.MinLon, bounds.MaxLat, bounds.MaxLon)
+	return err
+}
+
+// Downloads the groups that are not in completed and adds the installed ones
+// to it. Stops starting new groups once ctx is done.
+func DownloadGroups(ctx context.Context, groups []GroupArea, locationName string, completed map[string]bool) (err error) {
+	UpdateDownloadProgress(func(p *DownloadProgress) {
+		detail, ok := p.LocationDetails[locationName]
+		if !ok {
+			detail = &DownloadLocationDetail{}
+			p.LocationDetails[locationName] = detail
+		}
+		detail.TotalFiles = len(groups)
+	})
+	sources := DownloadSources()
+	concurrency := LoadDownloadSettings()
+
+	// show the files left incomplete by an earlier download
+	for _, group := range groups {
+		outputName := downloadFileName(group.Lat, group.Lon)
+		if info, err := os.Stat(outputName); err == nil && info.Size() > 0 {
+			SetPartialDownload(PartialDownload{File: outputName, Bytes: info.Size()})
+		}
+	}
+
+	// up to concurrency groups are downloaded at once
+	var wg sync.WaitGroup
+	var resultsLock sync.Mutex
+	installed := []string{}
+	groupErrors := []string{}
+	slots := make(chan struct{}, concurrency)
+	for _, group := range groups {
+		if ctx.Err() != nil {
+			break
+		}
+		if completed[group.String()] {
+			continue
+		}
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(group GroupArea) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			UpdateDownloadProgress(func(p *DownloadProgress) { p.ActiveDownloads++ })
+			downloaded, err := DownloadGroup(ctx, sources, group.Lat, group.Lon)
+			resultsLock.Lock()
+			if err == nil && downloaded {
+				installed = append(installed, group.String())
+			} else if err != nil && ctx.Err() == nil {
+				logwe(errors.Wrap(err, "could not download group, continuing to next"))
+				groupErrors = append(groupErrors, fmt.Sprintf("%s: %v", group, err))
 			}
-			file, err := os.Open(outputName)
-			logde(errors.Wrap(err, "failed to open downloaded file"))
-			reader, err := gzip.NewReader(file)
-			logde(errors.Wrap(err, "failed to read downloaded gzip"))
-			tr := tar.NewReader(reader)
-			for {
-				header, err := tr.Next()
-				if err != nil {
-					break
+			resultsLock.Unlock()
+			UpdateDownloadProgress(func(p *DownloadProgress) {
+				p.ActiveDownloads--
+				if downloaded {
+					p.DownloadedFiles++
+					p.LocationDetails[locationName].DownloadedFiles++
 				}
+			})
+		}(group)
+	}
+	wg.Wait()
+	for _, group := range installed {
+		completed[group] = true
+	}
+	// partial files of the groups that failed are kept so that the next
+	// download resumes them, like the ones of paused and cancelled jobs
+	for _, group := range groups {
+		if completed[group.String()] {
+			removeDownloadFiles(group)
+		}
+	}
 
-				// if the header is nil, just skip it (not sure how this happens)
-				if header == nil {
-					continue
-				}
-				// the target location where the dir/file should be created
-				target := filepath.Join(GetBaseOpPath(), header.Name)
-				// check the file type
-				switch header.Typeflag {
-
-				// if its a dir and it doesn't exist create it
-				case tar.TypeDir:
-					if _, err := os.Stat(target); err != nil {
-						err := os.MkdirAll(target, 0o755)
-						logde(errors.Wrap(err, "could not create directory from zip"))
-					}
-
-				// if it's a file create it
-				case tar.TypeReg:
-					f, err := os.OpenFile(target, os.O_CREATE|os.O_RDWR, os.FileMode(header.Mode))
-					logde(errors.Wrap(err, "could not open file target for unzipped file"))
-
-					_, err = io.Copy(f, tr)
-					logde(errors.Wrap(err, "could not write unzipped data to target file"))
-
-					err = f.Sync()
-					logde(errors.Wrap(err, "could not fsync unzipped target file"))
-					f.Close()
-				}
+	if ctx.Err() != nil {
+		return errors.Wrap(ctx.Err(), "download stopped")
+	}
+	if len(groupErrors) > 0 {
+		sort.Strings(groupErrors)
+		return errors.Errorf("could not download %d groups: %s", len(groupErrors), strings.Join(groupErrors, "; "))
+	}
+	return nil
+}
+
+// Downloads a 2x2 degree group from the first source that has a copy matching
+// its manifest and installs it. A source that fails is skipped for the next
+// one, a partial file left by it is not resumed from another source. A source
+// that publishes no manifest is installed unverified unless manifests are
+// required. Returns whether the group was downloaded and installed.
+func DownloadGroup(ctx context.Context, sources []string, lat int, lon int) (bool, error) {
+	outputName := downloadFileName(lat, lon)
+	err := os.MkdirAll(filepath.Dir(outputName), 0o775)
+	logde(errors.Wrap(err, "failed to make output directory"))
+
+	group := GroupArea{Lat: lat, Lon: lon}.String()
+	release := func() {}
+	defer func() { release() }()
+	err = errors.New("no map data sources")
+	for _, source := range sources {
+		if ctx.Err() != nil {
+			return false, errors.Wrap(ctx.Err(), "download stopped")
+		}
+		url := downloadURL(source, lat, lon)
+		manifest, fetchErr := FetchManifest(ctx, manifestName(url))
+		unverified := errors.Is(fetchErr, ErrNoManifest) && !RequireManifests()
+		if fetchErr != nil && !unverified {
+			err = errors.Wrapf(fetchErr, "could not download manifest from %s", source)
+			logwe(err)
+			continue
+		}
+		if unverified {
+			log.Warn().Str("group", group).Str("source", source).Msg("Source publishes no manifest, installing the group unverified")
+		} else {
+			release()
+			var budgetErr error
+			release, budgetErr = ReserveDiskSpace(group, manifest)
+			if budgetErr != nil {
+				return false, errors.Wrap(budgetErr, "not enough disk budget")
 			}
-			err = reader.Close()
-			logde(errors.Wrap(err, "could not close gzip reader"))
-			err = file.Close()
-			logde(errors.Wrap(err, "could not close downloaded file"))
+		}
+		downloadErr := DownloadFile(ctx, url, outputName)
+		if downloadErr != nil {
+			err = errors.Wrapf(downloadErr, "could not download file from %s", source)
+			logwe(err)
+			continue
+		}
+		RemovePartialDownload(outputName)
+		if unverified {
+			// the size of the group is only known once its archive is here
+			var manifestErr error
+			manifest, manifestErr = ArchiveManifest(outputName)
+			if manifestErr != nil {
+				err = errors.Wrapf(manifestErr, "could not read file downloaded from %s", source)
+				logwe(err)
+				logde(errors.Wrap(os.Remove(outputName), "could not delete corrupt download"))
+				continue
+			}
+			release()
+			var budgetErr error
+			release, budgetErr = ReserveDiskSpace(group, manifest)
+			if budgetErr != nil {
+				logde(errors.Wrap(os.Remove(outputName), "could not delete downloaded gzip file"))
+				return false, errors.Wrap(budgetErr, "not enough disk budget")
+			}
+		}
+		verifyErr := VerifyArchive(outputName, manifest)
+		if verifyErr != nil {
+			err = errors.Wrapf(verifyErr, "file downloaded from %s does not match its manifest, keeping the installed tiles", source)
+			logwe(err)
+			// a corrupt or outdated file can not be resumed
+			logde(errors.Wrap(os.Remove(outputName), "could not delete corrupt download"))
+			continue
+		}
+		err = InstallGroup(outputName, group, manifest)
+		logde(errors.Wrap(os.Remove(outputName), "could not delete downloaded gzip file"))
+		if err == nil {
+			logwe(errors.Wrap(RecordInstalledGroup(group, source, manifest), "could not record installed group"))
+		}
+		return err == nil, errors.Wrap(err, "could not install downloaded file, keeping the installed tiles")
+	}
+	return false, err
+}
 
-			err = os.Remove(outputName)
-			logde(errors.Wrap(err, "could not delete downloaded gzip file"))
+var (
+	MAX_ARCHIVE_ENTRY_SIZE = int64(256 << 20) // bytes. largest tile extracted from a downloaded archive
+	MAX_ARCHIVE_SIZE       = int64(4 << 30)   // bytes. largest total size of the files extracted from a downloaded archive
+	ARCHIVE_TILE_PATTERN   = regexp.MustCompile(`^offline/(-?\d+)/(-?\d+)/-?\d+\.\d+_-?\d+\.\d+_-?\d+\.\d+_-?\d+\.\d+$`)
+)
+
+// An archive entry that was not extracted
+type RejectedEntry struct {
+	Archive string `json:"archive"`
+	Name    string `json:"name"`
+	Reason  string `json:"reason"`
+}
 
-			progress.DownloadedFiles++
-			progress.LocationDetails[locationName].DownloadedFiles++
+// Checks an archive entry name and returns the cleaned name, or why it is rejected
+func checkArchiveEntry(header *tar.Header, group string) (string, string) {
+	name := filepath.ToSlash(header.Name)
+	if filepath.IsAbs(header.Name) || strings.HasPrefix(name, "/") {
+		return name, "absolute path"
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return name, "path leaves the offline directory"
+		}
+	}
+	name = strings.TrimPrefix(path.Clean(name), "./")
+	switch header.Typeflag {
+	case tar.TypeDir:
+		// only the directories leading to the group
+		if name == "offline" || strings.HasPrefix("offline/"+group, name+"/") || name == "offline/"+group {
+			return name, ""
+		}
+		return name, "unexpected directory"
+	case tar.TypeReg:
+		match := ARCHIVE_TILE_PATTERN.FindStringSubmatch(name)
+		if match == nil {
+			return name, "not an offline data file"
+		}
+		if match[1]+"/"+match[2] != group {
+			return name, "file of another group"
+		}
+		if header.Size > MAX_ARCHIVE_ENTRY_SIZE {
+			return name, fmt.Sprintf("file is larger than %d bytes", MAX_ARCHIVE_ENTRY_SIZE)
+		}
+		return name, ""
+	case tar.TypeSymlink, tar.TypeLink:
+		return name, "links are not allowed"
+	}
+	return name, "unsupported entry type"
+}
 
-			progressData, err := json.Marshal(progress)
+// Extracts the tiles of a group archive such as 38/-76 into dest. Entries
+// outside of the group's offline/<lat>/<lon>/<bounds> files are skipped and
+// returned, an archive that grows past MAX_ARCHIVE_SIZE is not extracted
+// any further.
+func ExtractArchive(archivePath string, dest string, group string) ([]RejectedEntry, error) {
+	rejected := []RejectedEntry{}
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return rejected, errors.Wrap(err, "failed to open downloaded file")
+	}
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return rejected, errors.Wrap(err, "failed to read downloaded gzip")
+	}
+	defer reader.Close()
+	tr := tar.NewReader(reader)
+	total := int64(0)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return rejected, nil
+		}
+		if err != nil {
+			return rejected, errors.Wrap(err, "could not read downloaded tar")
+		}
+
+		// if the header is nil, just skip it (not sure how this happens)
+		if header == nil {
+			continue
+		}
+		name, reason := checkArchiveEntry(header, group)
+		if len(reason) > 0 {
+			log.Warn().Str("archive", archivePath).Str("name", header.Name).Str("reason", reason).Msg("Rejected archive entry")
+			rejected = append(rejected, RejectedEntry{Archive: filepath.Base(archivePath), Name: header.Name, Reason: reason})
+			continue
+		}
+		// the target location where the dir/file should be created
+		target := filepath.Join(dest, filepath.FromSlash(name))
+		if rel, err := filepath.Rel(dest, target); err != nil || strings.HasPrefix(rel, "..") {
+			return rejected, errors.Errorf("archive entry %s leaves the extraction directory", header.Name)
+		}
+		// check the file type
+		switch header.Typeflag {
+
+		// if its a dir and it doesn't exist create it
+		case tar.TypeDir:
+			err := os.MkdirAll(target, 0o755)
 			if err != nil {
-				logde(errors.Wrap(err, "could not marshal download progress"))
+				return rejected, errors.Wrap(err, "could not create directory from zip")
 			}
 
-			err = PutParam(DOWNLOAD_PROGRESS, progressData)
+		// if it's a file create it
+		case tar.TypeReg:
+			total += header.Size
+			if total > MAX_ARCHIVE_SIZE {
+				return rejected, errors.Errorf("archive extracts to more than %d bytes", MAX_ARCHIVE_SIZE)
+			}
+			err := os.MkdirAll(filepath.Dir(target), 0o755)
+			if err != nil {
+				return rejected, errors.Wrap(err, "could not create directory for unzipped file")
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
 			if err != nil {
-				logwe(errors.Wrap(err, "could not write download progress"))
+				return rejected, errors.Wrap(err, "could not open file target for unzipped file")
+			}
+
+			_, err = io.Copy(f, io.LimitReader(tr, header.Size))
+			if err == nil {
+				err = f.Sync()
+			}
+			f.Close()
+			if err != nil {
+				return rejected, errors.Wrap(err, "could not write unzipped data to target file")
 			}
 		}
 	}
-	err = os.RemoveAll(filepath.Join(GetBaseOpPath(), "tmp"))
-	logde(errors.Wrap(err, "could not remove temp download directory"))
+}
 
-	log.Info().Msgf("Finished Downloading Bounds: %f, %f, %f, %f\n", bounds.MinLat, bounds.MinLon, bounds.MaxLat, bounds.MaxLon)
-	return nil
+// Adds rejected archive entries to the download progress
+func AddRejectedEntries(rejected []RejectedEntry) {
+	if len(rejected) == 0 {
+		return
+	}
+	UpdateDownloadProgress(func(p *DownloadProgress) {
+		p.RejectedEntries = append(p.RejectedEntries, rejected...)
+	})
+}
+
+// Removes what is left in the download directory from a group and the
+// directories that became empty
+func removeDownloadFiles(group GroupArea) {
+	outputName := downloadFileName(group.Lat, group.Lon)
+	for _, name := range []string{outputName, partialSourceName(outputName)} {
+		err := os.Remove(name)
+		if err != nil && !os.IsNotExist(err) {
+			logde(errors.Wrap(err, "could not remove download file"))
+		}
+	}
+	for dir := filepath.Dir(outputName); dir != DOWNLOAD_DIR && strings.HasPrefix(dir, DOWNLOAD_DIR); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+}
+
+func groupArchiveName(lat int, lon int) string {
+	return fmt.Sprintf("offline/%d/%d.tar.gz", lat, lon)
+}
+
+// The url of the offline data of a 2x2 degree group at a source
+func downloadURL(source string, lat int, lon int) string {
+	return fmt.Sprintf("%s/%s", source, groupArchiveName(lat, lon))
+}
+
+// The file the offline data of a 2x2 degree group is downloaded to
+func downloadFileName(lat int, lon int) string {
+	return filepath.Join(DOWNLOAD_DIR, groupArchiveName(lat, lon))
 }
 
 func countFilesForBounds(bounds Bounds) int {
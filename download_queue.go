@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	JOB_QUEUED   = "queued"
+	JOB_RUNNING  = "running"
+	JOB_PAUSED   = "paused"
+	JOB_DONE     = "done"
+	JOB_FAILED   = "failed"
+	JOB_CANCELED = "canceled"
+
+	DOWNLOAD_JOB_HISTORY = 10 // finished jobs kept in the download progress
+)
+
+// A download requested through the OSMDownloadLocations or OSMDownloadBounds
+// param or queued by an automatic update
+type DownloadJob struct {
+	ID        int               `json:"id"`
+	State     string            `json:"state"`
+	Locations DownloadLocations `json:"locations"`
+	Bounds    *Bounds           `json:"bounds,omitempty"`
+	Groups    []string          `json:"groups,omitempty"` // groups such as 38/-76, set by automatic updates
+	Errors    []string          `json:"errors"`
+	completed map[string]bool   // groups installed by the job, skipped when it resumes after a pause
+}
+
+func (j *DownloadJob) finished() bool {
+	return j.State == JOB_DONE || j.State == JOB_FAILED || j.State == JOB_CANCELED
+}
+
+// A command written to the OSMDownloadControl param
+type DownloadControl struct {
+	Action string `json:"action"` // cancel, pause or resume
+	JobID  int    `json:"job_id"` // the job to cancel, every unfinished job when 0
+}
+
+// Jobs waiting for the download worker. The worker runs them one after
+// another in its own goroutine so that the main loop keeps matching and
+// publishing while maps download.
+type DownloadQueue struct {
+	lock    sync.Mutex
+	jobs    []*DownloadJob // unfinished and recently finished jobs in the order they were added
+	lastID  int
+	paused  bool
+	running *DownloadJob
+	cancel  context.CancelFunc // stops the running job
+	wake    chan struct{}
+}
+
+var downloadQueue = NewDownloadQueue()
+
+func NewDownloadQueue() *DownloadQueue {
+	return &DownloadQueue{wake: make(chan struct{}, 1)}
+}
+
+// Adds a job to the download progress and the end of the queue and returns
+// its id. The progress starts over when the worker was idle.
+func (q *DownloadQueue) Add(job DownloadJob) int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	idle := q.running == nil
+	for _, queued := range q.jobs {
+		idle = idle && queued.finished()
+	}
+	q.lastID++
+	job.ID = q.lastID
+	job.State = JOB_QUEUED
+	job.Errors = []string{}
+	job.completed = map[string]bool{}
+	q.jobs = append(q.jobs, &job)
+	// the worker can not take the job before it is in the progress
+	UpdateDownloadProgress(func(p *DownloadProgress) {
+		if idle {
+			*p = newDownloadProgress()
+		}
+		addJobToProgress(p, job)
+		p.Jobs = q.snapshot()
+		p.Paused = q.paused
+	})
+	q.signal()
+	log.Info().Int("job", job.ID).Msg("Queued download job")
+	return job.ID
+}
+
+func (q *DownloadQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func addJobToProgress(p *DownloadProgress, job DownloadJob) {
+	p.LocationsToDownload = append(p.LocationsToDownload, job.Locations.Nations...)
+	p.LocationsToDownload = append(p.LocationsToDownload, job.Locations.States...)
+	p.TotalFiles += countTotalFiles(job.Locations.Nations, "nation") + countTotalFiles(job.Locations.States, "state")
+	AddLocationDetailsToProgress(p, job.Locations.Nations, "nation")
+	AddLocationDetailsToProgress(p, job.Locations.States, "state")
+	if job.Bounds != nil {
+		files := countFilesForBounds(*job.Bounds)
+		p.TotalFiles += files
+		if _, ok := p.LocationDetails["CUSTOM"]; !ok {
+			p.LocationDetails["CUSTOM"] = &DownloadLocationDetail{TotalFiles: files}
+		}
+	}
+	if len(job.Groups) > 0 {
+		p.TotalFiles += len(job.Groups)
+		if _, ok := p.LocationDetails["UPDATE"]; !ok {
+			p.LocationDetails["UPDATE"] = &DownloadLocationDetail{TotalFiles: len(job.Groups)}
+		}
+	}
+}
+
+// Copies the jobs for the progress output, q.lock must be held
+func (q *DownloadQueue) snapshot() []DownloadJob {
+	jobs := []DownloadJob{}
+	for _, job := range q.jobs {
+		copied := *job
+		copied.Errors = append([]string{}, job.Errors...)
+		copied.completed = nil
+		jobs = append(jobs, copied)
+	}
+	return jobs
+}
+
+// Writes the job states to the progress, q.lock must be held
+func (q *DownloadQueue) publish() {
+	UpdateDownloadProgress(func(p *DownloadProgress) {
+		p.Jobs = q.snapshot()
+		p.Paused = q.paused
+	})
+}
+
+// Whether no job is queued or running
+func (q *DownloadQueue) Idle() bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.running != nil {
+		return false
+	}
+	for _, job := range q.jobs {
+		if !job.finished() {
+			return false
+		}
+	}
+	return true
+}
+
+// Stops a queued, paused or running job, or all of them for id 0. A
+// cancelled download keeps its partial files.
+func (q *DownloadQueue) Cancel(id int) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	found := false
+	for _, job := range q.jobs {
+		if (id != 0 && job.ID != id) || job.finished() {
+			continue
+		}
+		found = true
+		job.State = JOB_CANCELED
+		if job == q.running {
+			q.cancel()
+		}
+		log.Info().Int("job", job.ID).Msg("Canceled download job")
+	}
+	q.publish()
+	if !found && id != 0 {
+		return errors.Errorf("no unfinished download job with id %d", id)
+	}
+	return nil
+}
+
+// Stops the running job and keeps the worker from starting jobs until Resume.
+// The paused job continues where it stopped.
+func (q *DownloadQueue) Pause() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.paused = true
+	if q.running != nil && q.running.State == JOB_RUNNING {
+		q.running.State = JOB_PAUSED
+		q.cancel()
+	}
+	q.publish()
+	log.Info().Msg("Paused downloads")
+}
+
+func (q *DownloadQueue) Resume() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.paused = false
+	q.publish()
+	q.signal()
+	log.Info().Msg("Resumed downloads")
+}
+
+// Takes the first paused or queued job unless the queue is paused
+func (q *DownloadQueue) next(ctx context.Context) (*DownloadJob, context.Context) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.paused {
+		return nil, nil
+	}
+	for _, job := range q.jobs {
+		if job.State == JOB_QUEUED || job.State == JOB_PAUSED {
+			ctx, cancel := context.WithCancel(ctx)
+			job.State = JOB_RUNNING
+			q.running, q.cancel = job, cancel
+			q.publish()
+			return job, ctx
+		}
+	}
+	return nil, nil
+}
+
+func (q *DownloadQueue) finish(job *DownloadJob, jobErrors []string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.cancel()
+	q.running, q.cancel = nil, nil
+	job.Errors = append(job.Errors, jobErrors...)
+	if job.State == JOB_RUNNING {
+		job.State = JOB_DONE
+		if len(job.Errors) > 0 {
+			job.State = JOB_FAILED
+		}
+		log.Info().Int("job", job.ID).Str("state", job.State).Msg("Finished download job")
+	}
+
+	// forget the oldest finished jobs
+	finished := 0
+	for _, queued := range q.jobs {
+		if queued.finished() {
+			finished++
+		}
+	}
+	kept := []*DownloadJob{}
+	for _, queued := range q.jobs {
+		if queued.finished() && finished > DOWNLOAD_JOB_HISTORY {
+			finished--
+			continue
+		}
+		kept = append(kept, queued)
+	}
+	q.jobs = kept
+	q.publish()
+}
+
+// Runs the queued jobs, waiting for new ones when the queue is empty or
+// paused, until ctx is done. A job stopped by ctx is queued again.
+func (q *DownloadQueue) Run(ctx context.Context) {
+	for {
+		job, jobCtx := q.next(ctx)
+		if job == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-q.wake:
+			}
+			continue
+		}
+		jobErrors := q.run(jobCtx, job)
+		if ctx.Err() != nil {
+			q.requeue(job)
+			return
+		}
+		q.finish(job, jobErrors)
+	}
+}
+
+func (q *DownloadQueue) requeue(job *DownloadJob) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.cancel()
+	q.running, q.cancel = nil, nil
+	if job.State == JOB_RUNNING {
+		job.State = JOB_QUEUED
+	}
+	q.publish()
+}
+
+func (q *DownloadQueue) run(ctx context.Context, job *DownloadJob) (jobErrors []string) {
+	defer func() {
+		if err := recover(); err != nil {
+			e := errors.Errorf("panic occured in download worker: %v", err)
+			loge(e)
+			jobErrors = append(jobErrors, e.Error())
+		}
+	}()
+	// only the fields that never change are read without the lock
+	return RunDownloadJob(ctx, DownloadJob{Locations: job.Locations, Bounds: job.Bounds, Groups: job.Groups}, job.completed)
+}
+
+// Applies a command from the OSMDownloadControl param. The command is either
+// json or just the action, which applies to every job.
+func (q *DownloadQueue) Control(data []byte) error {
+	control := DownloadControl{Action: strings.TrimSpace(string(data))}
+	if strings.HasPrefix(control.Action, "{") {
+		control = DownloadControl{}
+		err := json.Unmarshal(data, &control)
+		if err != nil {
+			return errors.Wrap(err, "could not unmarshal download control")
+		}
+	}
+	switch control.Action {
+	case "cancel":
+		return q.Cancel(control.JobID)
+	case "pause":
+		q.Pause()
+	case "resume":
+		q.Resume()
+	default:
+		return errors.Errorf("unknown download control action %q", control.Action)
+	}
+	return nil
+}
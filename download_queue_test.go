@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bradleyjkemp/cupaloy"
+)
+
+func TestDownloadQueue(t *testing.T) {
+	base := useTestDirs(t)
+	sources := DOWNLOAD_SOURCES
+	defer func() { DOWNLOAD_SOURCES = sources }()
+	tileName := "offline/38/-76/38.000000_-76.000000_38.250000_-75.750000"
+	mirror := t.TempDir()
+	writeTestGroup(t, mirror, map[string]string{tileName: "queued release"})
+	err := WriteGroupManifests(mirror)
+	if err != nil {
+		t.Fatal(err)
+	}
+	DOWNLOAD_SOURCES = []string{mirror}
+
+	queue := NewDownloadQueue()
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		queue.Run(ctx)
+		close(stopped)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+	version := GroupsVersion()
+	results := fmt.Sprintf("idle before: %v\n", queue.Idle())
+	queue.Add(DownloadJob{Bounds: &Bounds{MinLat: 38.5, MinLon: -75.5, MaxLat: 39, MaxLon: -75}})
+	queue.Add(DownloadJob{Locations: DownloadLocations{States: []string{"XX"}}})
+	progressLock.Lock()
+	results += fmt.Sprintf("queued files: %d custom: %d\n", progress.TotalFiles, progress.LocationDetails["CUSTOM"].TotalFiles)
+	progressLock.Unlock()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !queue.Idle() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	data, _ := os.ReadFile(filepath.Join(base, tileName))
+	results += fmt.Sprintf("idle after: %v tile: %q\n", queue.Idle(), data)
+	results += fmt.Sprintf("groups version changed: %v\n", GroupsVersion() != version)
+	progressLock.Lock()
+	results += fmt.Sprintf("downloaded files: %d locations: %q\n", progress.DownloadedFiles, progress.LocationsToDownload)
+	progressLock.Unlock()
+
+	cupaloy.SnapshotT(t, results)
+}
+
+func TestDownloadQueueControl(t *testing.T) {
+	useTestDirs(t)
+	sources := DOWNLOAD_SOURCES
+	defer func() { DOWNLOAD_SOURCES = sources }()
+	mirror := t.TempDir()
+	writeTestGroup(t, mirror, map[string]string{"offline/38/-76/38.000000_-76.000000_38.250000_-75.750000": "release"})
+	err := WriteGroupManifests(mirror)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the first archive request hangs until the download is stopped
+	started := make(chan struct{})
+	var once sync.Once
+	files := http.FileServer(http.Dir(mirror))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		first := false
+		if strings.HasSuffix(r.URL.Path, ".tar.gz") {
+			once.Do(func() { first = true })
+		}
+		if first {
+			close(started)
+			<-r.Context().Done()
+			return
+		}
+		files.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	DOWNLOAD_SOURCES = []string{server.URL}
+
+	queue := NewDownloadQueue()
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		queue.Run(ctx)
+		close(stopped)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+	results := ""
+	states := func(step string) {
+		queue.lock.Lock()
+		results += step + ":"
+		for _, job := range queue.snapshot() {
+			results += fmt.Sprintf(" %d=%s%v", job.ID, job.State, job.Errors)
+		}
+		results += fmt.Sprintf(" paused=%v\n", queue.paused)
+		queue.lock.Unlock()
+	}
+	waitFor := func(done func() bool) {
+		deadline := time.Now().Add(10 * time.Second)
+		for !done() && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	bounds := Bounds{MinLat: 38.5, MinLon: -75.5, MaxLat: 39, MaxLon: -75}
+	queue.Add(DownloadJob{Bounds: &bounds})
+	<-started
+	states("running")
+	results += fmt.Sprintf("pause: %v\n", queue.Control([]byte("pause")))
+	waitFor(func() bool {
+		queue.lock.Lock()
+		defer queue.lock.Unlock()
+		return queue.running == nil
+	})
+	queue.Add(DownloadJob{Locations: DownloadLocations{States: []string{"DE"}}})
+	states("paused")
+	results += fmt.Sprintf("cancel 2: %v\n", queue.Control([]byte(`{"action": "cancel", "job_id": 2}`)))
+	results += fmt.Sprintf("cancel 99: %v\n", queue.Control([]byte(`{"action": "cancel", "job_id": 99}`)))
+	results += fmt.Sprintf("unknown: %v\n", queue.Control([]byte("stop")))
+	states("canceled")
+	results += fmt.Sprintf("resume: %v\n", queue.Control([]byte(`{"action": "resume"}`)))
+	waitFor(queue.Idle)
+	states("resumed")
+
+	cupaloy.SnapshotT(t, results)
+}
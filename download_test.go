@@ -0,0 +1,272 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bradleyjkemp/cupaloy"
+)
+
+func TestDownloadFileResume(t *testing.T) {
+	retryDelay := DOWNLOAD_RETRY_DELAY
+	defer func() { DOWNLOAD_RETRY_DELAY = retryDelay }()
+	DOWNLOAD_RETRY_DELAY = time.Millisecond
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+	requests := ""
+	dropped := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests += fmt.Sprintf("range=%q\n", r.Header.Get("Range"))
+		if !dropped {
+			// the connection drops part way through the first response
+			dropped = true
+			w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+			_, _ = w.Write(content[:len(content)/2])
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+			return
+		}
+		http.ServeContent(w, r, "map.tar.gz", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "map.tar.gz")
+	err := os.WriteFile(path, content[:1000], 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writePartialSource(path, partialSource{URL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = DownloadFile(context.Background(), server.URL, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests += fmt.Sprintf("complete=%v\n", bytes.Equal(data, content))
+
+	cupaloy.SnapshotT(t, requests)
+}
+
+func TestDownloadFileIdleTimeout(t *testing.T) {
+	retryDelay := DOWNLOAD_RETRY_DELAY
+	idleTimeout := DOWNLOAD_IDLE_TIMEOUT
+	defer func() {
+		DOWNLOAD_RETRY_DELAY = retryDelay
+		DOWNLOAD_IDLE_TIMEOUT = idleTimeout
+	}()
+	DOWNLOAD_RETRY_DELAY = time.Millisecond
+	DOWNLOAD_IDLE_TIMEOUT = 200 * time.Millisecond
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	requests := ""
+	stalled := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests += fmt.Sprintf("range=%q\n", r.Header.Get("Range"))
+		if !stalled {
+			// the first response stops sending data part way through
+			stalled = true
+			w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+			_, _ = w.Write(content[:len(content)/2])
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+		// the rest arrives slowly, taking longer than the idle timeout in total
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", len(content)/2, len(content)-1, len(content)))
+		w.Header().Set("Content-Length", fmt.Sprint(len(content)/2))
+		w.WriteHeader(http.StatusPartialContent)
+		rest := content[len(content)/2:]
+		for i := 0; i < 5; i++ {
+			time.Sleep(DOWNLOAD_IDLE_TIMEOUT / 4)
+			_, _ = w.Write(rest[i*len(rest)/5 : (i+1)*len(rest)/5])
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "map.tar.gz")
+	err := DownloadFile(context.Background(), server.URL, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests += fmt.Sprintf("complete=%v\n", bytes.Equal(data, content))
+
+	cupaloy.SnapshotT(t, requests)
+}
+
+func TestDownloadFilePartialSource(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	requests := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests += fmt.Sprintf("  range=%q if-range=%q\n", r.Header.Get("Range"), r.Header.Get("If-Range"))
+		w.Header().Set("ETag", `"v2"`)
+		http.ServeContent(w, r, "map.tar.gz", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	for _, partial := range []struct {
+		name   string
+		data   []byte
+		source partialSource
+	}{
+		{"another source", content[:1000], partialSource{URL: "https://other.example.com/map.tar.gz", ETag: `"v2"`}},
+		{"changed file", []byte("an older release"), partialSource{URL: server.URL, ETag: `"v1"`}},
+		{"weak etag", content[:1000], partialSource{URL: server.URL, ETag: `W/"v2"`}},
+		{"unchanged file", content[:1000], partialSource{URL: server.URL, ETag: `"v2"`}},
+		{"no source", content[:1000], partialSource{}},
+	} {
+		path := filepath.Join(t.TempDir(), "map.tar.gz")
+		err := os.WriteFile(path, partial.data, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(partial.source.URL) > 0 {
+			err = writePartialSource(path, partial.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		requests += partial.name + ":\n"
+		err = DownloadFile(context.Background(), server.URL, path)
+		data, _ := os.ReadFile(path)
+		_, sourceErr := os.Stat(partialSourceName(path))
+		requests += fmt.Sprintf("  err=%v complete=%v source removed=%v\n", err, bytes.Equal(data, content), os.IsNotExist(sourceErr))
+	}
+
+	cupaloy.SnapshotT(t, requests)
+}
+
+func writeTestArchive(t *testing.T, path string, headers []*tar.Header) {
+	archive, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+	gz := gzip.NewWriter(archive)
+	tw := tar.NewWriter(gz)
+	for _, header := range headers {
+		if header.Typeflag == tar.TypeReg {
+			header.Size = int64(len(header.Name))
+		}
+		err = tw.WriteHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			_, err = tw.Write([]byte(header.Name))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractArchive(t *testing.T) {
+	maxEntrySize, maxSize := MAX_ARCHIVE_ENTRY_SIZE, MAX_ARCHIVE_SIZE
+	defer func() { MAX_ARCHIVE_ENTRY_SIZE, MAX_ARCHIVE_SIZE = maxEntrySize, maxSize }()
+	MAX_ARCHIVE_ENTRY_SIZE = 60
+
+	archivePath := filepath.Join(t.TempDir(), "-76.tar.gz")
+	writeTestArchive(t, archivePath, []*tar.Header{
+		{Name: "offline/", Typeflag: tar.TypeDir, Mode: 0o777},
+		{Name: "offline/38/", Typeflag: tar.TypeDir, Mode: 0o777},
+		{Name: "offline/38/-76/", Typeflag: tar.TypeDir, Mode: 0o777},
+		{Name: "offline/38/-76/38.000000_-76.000000_38.250000_-75.750000", Typeflag: tar.TypeReg, Mode: 0o4777},
+		{Name: "./offline/38/-76/38.250000_-76.000000_38.500000_-75.750000", Typeflag: tar.TypeReg, Mode: 0o644},
+		{Name: "offline/99/", Typeflag: tar.TypeDir, Mode: 0o755},
+		{Name: "/etc/mapd", Typeflag: tar.TypeReg, Mode: 0o644},
+		{Name: "offline/38/-76/../../../../mapd", Typeflag: tar.TypeReg, Mode: 0o644},
+		{Name: "offline/38/-76/link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"},
+		{Name: "offline/38/-76/hard", Typeflag: tar.TypeLink, Linkname: "offline/38/-76/38.000000_-76.000000_38.250000_-75.750000"},
+		{Name: "offline/40/-76/40.000000_-76.000000_40.250000_-75.750000", Typeflag: tar.TypeReg, Mode: 0o644},
+		{Name: "offline/38/-76/notes.txt", Typeflag: tar.TypeReg, Mode: 0o644},
+		{Name: "offline/38/-76/38.500000_-76.000000_38.750000_-75.750000" + strings.Repeat("0", 10), Typeflag: tar.TypeReg, Mode: 0o644},
+	})
+
+	dest := t.TempDir()
+	rejected, err := ExtractArchive(archivePath, dest, "38/-76")
+	results := fmt.Sprintf("err=%v\n", err)
+	for _, entry := range rejected {
+		results += fmt.Sprintf("rejected %s: %s\n", entry.Name, entry.Reason)
+	}
+	err = filepath.Walk(dest, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == dest {
+			return err
+		}
+		rel, _ := filepath.Rel(dest, path)
+		results += fmt.Sprintf("extracted %s setuid=%v\n", filepath.ToSlash(rel), info.Mode()&os.ModeSetuid != 0)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an archive that extracts to more than the total size limit stops
+	MAX_ARCHIVE_SIZE = 100
+	_, err = ExtractArchive(archivePath, t.TempDir(), "38/-76")
+	results += fmt.Sprintf("total size: %v\n", err)
+
+	cupaloy.SnapshotT(t, results)
+}
+
+func TestDownloadGroupsKeepsOtherPartials(t *testing.T) {
+	useTestDirs(t)
+	sources := DOWNLOAD_SOURCES
+	defer func() { DOWNLOAD_SOURCES = sources }()
+	mirror := t.TempDir()
+	writeTestGroup(t, mirror, map[string]string{"offline/38/-76/38.000000_-76.000000_38.250000_-75.750000": "release"})
+	err := WriteGroupManifests(mirror)
+	if err != nil {
+		t.Fatal(err)
+	}
+	DOWNLOAD_SOURCES = []string{mirror}
+
+	// a partial download of a paused job
+	partial := downloadFileName(40, -76)
+	err = os.MkdirAll(filepath.Dir(partial), 0o775)
+	if err == nil {
+		err = os.WriteFile(partial, []byte("partial"), 0o644)
+	}
+	if err == nil {
+		err = writePartialSource(partial, partialSource{URL: "https://maps.example.com/offline/40/-76.tar.gz"})
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	completed := map[string]bool{}
+	err = DownloadGroups(context.Background(), []GroupArea{{Lat: 38, Lon: -76}}, "CUSTOM", completed)
+
+	results := fmt.Sprintf("err=%v completed=%v\n", err, completed)
+	for _, name := range []string{downloadFileName(38, -76), filepath.Dir(downloadFileName(38, -76)), partial, partialSourceName(partial)} {
+		_, statErr := os.Stat(name)
+		rel, _ := filepath.Rel(DOWNLOAD_DIR, name)
+		results += fmt.Sprintf("%s exists: %v\n", filepath.ToSlash(rel), statErr == nil)
+	}
+
+	cupaloy.SnapshotT(t, results)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+)
+
+var FEATURE_LOOKAHEAD = float64(MIN_WAY_DIST) // meters. how far along the predicted path to report features
+
+var featureTypeNames = map[FeatureType]string{
+	FeatureType_trafficCalming:   "traffic_calming",
+	FeatureType_stop:             "stop",
+	FeatureType_giveWay:          "give_way",
+	FeatureType_trafficSignals:   "traffic_signals",
+	FeatureType_levelCrossing:    "level_crossing",
+	FeatureType_crossing:         "crossing",
+	FeatureType_motorwayJunction: "motorway_junction",
+}
+
+type PathFeature struct {
+	Type      string  `json:"type"`
+	Value     string  `json:"value"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Distance  float64 `json:"distance"`
+	WayId     uint64  `json:"way_id"`
+}
+
+// Checks if a feature tagged with an OSM direction applies when travelling the way in the given direction
+func FeatureApplies(direction string, isForward bool) bool {
+	switch direction {
+	case "forward":
+		return isForward
+	case "backward":
+		return !isForward
+	}
+	return true
+}
+
+// Lists the tagged nodes along the predicted path within FEATURE_LOOKAHEAD, nearest first
+func GetPathFeatures(pos Position, currentWay CurrentWay, nextWays []NextWayResult) ([]PathFeature, error) {
+	directions := map[int64]bool{currentWay.Way.Id(): currentWay.OnWay.IsForward}
+	for _, nextWay := range nextWays {
+		directions[nextWay.Way.Id()] = nextWay.IsForward
+	}
+
+	var err error
+	pathFeatures := []PathFeature{}
+	WalkPathNodes(pos, currentWay, nextWays, func(way Way, index int, distance float64) {
+		if distance > FEATURE_LOOKAHEAD || !way.HasFeatures() {
+			return
+		}
+		features, e := way.Features()
+		if e != nil {
+			err = errors.Wrap(e, "could not read way features")
+			return
+		}
+		nodes, e := way.Nodes()
+		if e != nil {
+			err = errors.Wrap(e, "could not read way nodes")
+			return
+		}
+		for i := 0; i < features.Len(); i++ {
+			feature := features.At(i)
+			if int(feature.NodeIndex()) != index {
+				continue
+			}
+			direction, _ := feature.Direction()
+			if !FeatureApplies(direction, directions[way.Id()]) {
+				continue
+			}
+			value, _ := feature.Value()
+			node := nodes.At(index)
+			pathFeatures = append(pathFeatures, PathFeature{
+				Type:      featureTypeNames[feature.Type()],
+				Value:     value,
+				Latitude:  node.Latitude(),
+				Longitude: node.Longitude(),
+				Distance:  distance,
+				WayId:     uint64(way.Id()),
+			})
+		}
+	})
+	return pathFeatures, err
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bradleyjkemp/cupaloy"
+	"github.com/paulmach/osm"
+)
+
+func TestNodeFeatures(t *testing.T) {
+	results := ""
+	for _, tags := range []osm.Tags{
+		{{Key: "traffic_calming", Value: "bump"}},
+		{{Key: "traffic_calming", Value: "no"}, {Key: "highway", Value: "stop"}, {Key: "stop", Value: "all"}},
+		{{Key: "traffic_calming", Value: "table"}, {Key: "crossing", Value: "zebra"}},
+		{{Key: "highway", Value: "traffic_signals"}, {Key: "direction", Value: "backward"}, {Key: "traffic_signals:direction", Value: "forward"}},
+		{{Key: "highway", Value: "give_way"}, {Key: "direction", Value: "forward"}},
+		{{Key: "highway", Value: "motorway_junction"}, {Key: "ref", Value: "12A"}},
+		{{Key: "railway", Value: "level_crossing"}, {Key: "crossing:barrier", Value: "full"}, {Key: "highway", Value: "stop"}},
+		{{Key: "crossing", Value: "no"}},
+		{{Key: "highway", Value: "street_lamp"}},
+	} {
+		results += fmt.Sprintf("%v:", tags.Map())
+		for _, feature := range NodeFeatures(tags) {
+			results += fmt.Sprintf(" %s=%q direction=%q", featureTypeNames[feature.Type], feature.Value, feature.Direction)
+		}
+		results += "\n"
+	}
+
+	cupaloy.SnapshotT(t, results)
+}
+
+func TestWalkPathNodes(t *testing.T) {
+	// a way heading east that continues onto a way drawn from east to west
+	first := roadTestWay(10, false, TmpNode{Latitude: 0, Longitude: 0}, TmpNode{Latitude: 0, Longitude: 0.001}, TmpNode{Latitude: 0, Longitude: 0.002})
+	first.Features = []TmpFeature{{Type: FeatureType_trafficSignals, NodeIndex: 1, Direction: "forward"}, {Type: FeatureType_stop, NodeIndex: 1, Direction: "backward"}}
+	second := roadTestWay(11, false, TmpNode{Latitude: 0, Longitude: 0.004}, TmpNode{Latitude: 0, Longitude: 0.003}, TmpNode{Latitude: 0, Longitude: 0.002})
+	second.Features = []TmpFeature{{Type: FeatureType_giveWay, NodeIndex: 1, Direction: "backward"}, {Type: FeatureType_crossing, Value: "zebra", NodeIndex: 0}}
+	area := Area{MinLat: -0.01, MinLon: -0.01, MaxLat: 0.01, MaxLon: 0.02, Ways: []TmpWay{first, second}}
+	_, offline := NewOfflineMessage(area, nil, CoordinateEncoding_float64)
+
+	pos := Position{Latitude: 0, Longitude: 0.0005, Bearing: 90}
+	currentWay, err := GetCurrentWay(CurrentWay{}, nil, offline, pos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nextWays, err := NextWays(pos, currentWay, nil, offline, currentWay.OnWay.IsForward)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := ""
+	WalkPathNodes(pos, currentWay, nextWays, func(way Way, index int, distance float64) {
+		results += fmt.Sprintf("way=%d index=%d distance=%.1f\n", way.Id(), index, distance)
+	})
+	features, err := GetPathFeatures(pos, currentWay, nextWays)
+	results += fmt.Sprintf("features err=%v\n", err)
+	for _, feature := range features {
+		results += fmt.Sprintf("%s=%q way=%d distance=%.1f\n", feature.Type, feature.Value, feature.WayId, feature.Distance)
+	}
+
+	cupaloy.SnapshotT(t, results)
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/paulmach/osm"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	STATE_FILE           = "state.json"
+	STATE_NODES_FILE     = "nodes.gob"
+	STATE_AREAS_DIR      = "areas"
+	STATE_NODE_LOCATIONS = "nodes.idx"
+	STATE_WAY_BOUNDS     = "ways.idx"
+)
+
+// What a generation state directory was created with and which replication
+// sequence it has been updated to
+type GenerateState struct {
+	Options         GenerateOptions `json:"options"`
+	Sequence        int64           `json:"sequence"`
+	SourceTimestamp time.Time       `json:"source_timestamp"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+}
+
+func SaveGenerateState(dir string, state GenerateState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "could not marshal generation state")
+	}
+	tmp := filepath.Join(dir, STATE_FILE+".tmp")
+	err = os.WriteFile(tmp, data, 0o644)
+	if err != nil {
+		return errors.Wrap(err, "could not write generation state")
+	}
+	return errors.Wrap(os.Rename(tmp, filepath.Join(dir, STATE_FILE)), "could not replace generation state")
+}
+
+func LoadGenerateState(dir string) (GenerateState, error) {
+	state := GenerateState{}
+	data, err := os.ReadFile(filepath.Join(dir, STATE_FILE))
+	if err != nil {
+		return state, errors.Wrap(err, "could not read generation state, run a full generation with -state-dir first")
+	}
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return state, errors.Wrap(err, "could not parse generation state")
+	}
+	if len(state.Options.Filter.Clip) > 0 {
+		state.Options.Filter.clipBound = state.Options.Filter.Clip.Bound()
+	}
+	return state, nil
+}
+
+type generateNodesState struct {
+	Features map[osm.NodeID][]TmpFeature
+	Hazards  map[osm.NodeID][]TmpHazard
+	Cameras  map[osm.NodeID]*TmpSpeedCamera
+}
+
+// Saves the tagged node data, the node locations are already on disk
+func (g *GenerateNodes) Save(dir string) error {
+	tmp := filepath.Join(dir, STATE_NODES_FILE+".tmp")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return errors.Wrap(err, "could not create node state")
+	}
+	err = gob.NewEncoder(f).Encode(generateNodesState{Features: g.Features, Hazards: g.Hazards, Cameras: g.Cameras})
+	if err != nil {
+		f.Close()
+		return errors.Wrap(err, "could not encode node state")
+	}
+	err = f.Close()
+	if err != nil {
+		return errors.Wrap(err, "could not close node state")
+	}
+	return errors.Wrap(os.Rename(tmp, filepath.Join(dir, STATE_NODES_FILE)), "could not replace node state")
+}
+
+func LoadGenerateNodes(dir string, dem *DEM) (GenerateNodes, error) {
+	nodes := GenerateNodes{DEM: dem}
+	f, err := os.Open(filepath.Join(dir, STATE_NODES_FILE))
+	if err != nil {
+		return nodes, errors.Wrap(err, "could not open node state")
+	}
+	defer f.Close()
+	state := generateNodesState{}
+	err = gob.NewDecoder(f).Decode(&state)
+	if err != nil {
+		return nodes, errors.Wrap(err, "could not decode node state")
+	}
+	nodes.Features = state.Features
+	nodes.Hazards = state.Hazards
+	nodes.Cameras = state.Cameras
+	if nodes.Features == nil {
+		nodes.Features = map[osm.NodeID][]TmpFeature{}
+	}
+	if nodes.Hazards == nil {
+		nodes.Hazards = map[osm.NodeID][]TmpHazard{}
+	}
+	if nodes.Cameras == nil {
+		nodes.Cameras = map[osm.NodeID]*TmpSpeedCamera{}
+	}
+	nodes.Locations, err = OpenNodeLocations(filepath.Join(dir, STATE_NODE_LOCATIONS), false)
+	return nodes, err
+}
+
+type ChangeAction struct {
+	Delete bool
+	Data   *osm.OSM
+}
+
+// Reads an osmChange file, optionally gzip compressed, keeping the order of its actions
+func ReadChange(path string) ([]ChangeAction, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not open change file")
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not decompress change file")
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	actions := []ChangeAction{}
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "could not parse change file")
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "create", "modify", "delete":
+			data := &osm.OSM{}
+			err = decoder.DecodeElement(data, &start)
+			if err != nil {
+				return nil, errors.Wrap(err, "could not parse change action")
+			}
+			actions = append(actions, ChangeAction{Delete: start.Name.Local == "delete", Data: data})
+		}
+	}
+	return actions, nil
+}
+
+// The newest element timestamp of a change, used as the source timestamp of rewritten areas
+func LatestChangeTimestamp(actions []ChangeAction) time.Time {
+	latest := time.Time{}
+	for _, action := range actions {
+		for _, node := range action.Data.Nodes {
+			if node.Timestamp.After(latest) {
+				latest = node.Timestamp
+			}
+		}
+		for _, way := range action.Data.Ways {
+			if way.Timestamp.After(latest) {
+				latest = way.Timestamp
+			}
+		}
+		for _, relation := range action.Data.Relations {
+			if relation.Timestamp.After(latest) {
+				latest = relation.Timestamp
+			}
+		}
+	}
+	return latest
+}
+
+func containsNode(ids []osm.NodeID, changed map[osm.NodeID]bool) bool {
+	for _, id := range ids {
+		if changed[id] {
+			return true
+		}
+	}
+	return false
+}
+
+// Applies an osmChange file to a generation state and rewrites only the areas
+// whose ways were created, modified or deleted or whose nodes changed. The
+// report, if a path is given, only covers the rewritten areas and changed ways.
+func ApplyChanges(stateDir string, changePath string, sequence int64, reportPath string) {
+	log.Info().Str("changes", changePath).Msg("Applying Changes")
+	EnsureOfflineMapsDirectories()
+	state, err := LoadGenerateState(stateDir)
+	check(err)
+	options := state.Options
+	filter := options.Filter
+
+	var dem *DEM
+	if len(options.DEMDir) > 0 {
+		dem, err = OpenDEM(options.DEMDir)
+		check(errors.Wrap(err, "could not open elevation data"))
+	}
+	nodes, err := LoadGenerateNodes(stateDir, dem)
+	check(err)
+	defer nodes.Locations.Close()
+	wayBounds, err := OpenWayBounds(filepath.Join(stateDir, STATE_WAY_BOUNDS), false)
+	check(err)
+	defer wayBounds.Close()
+	spill := NewAreaSpill(filepath.Join(stateDir, STATE_AREAS_DIR))
+
+	actions, err := ReadChange(changePath)
+	check(err)
+
+	affected := map[int]bool{}
+	markAreas := func(minLat float64, minLon float64, maxLat float64, maxLon float64) {
+		for _, i := range OverlappingAreaIndexes(minLat, minLon, maxLat, maxLon) {
+			if InGenerationBounds(AREAS[i], options.MinLat, options.MinLon, options.MaxLat, options.MaxLon) {
+				affected[i] = true
+			}
+		}
+	}
+
+	// Nodes: update the location index and remember where changed nodes were
+	// so the ways using them can be found
+	changedNodes := map[osm.NodeID]bool{}
+	lookupAreas := map[int]bool{}
+	for _, action := range actions {
+		for _, node := range action.Data.Nodes {
+			changedNodes[node.ID] = true
+			lat, lon, located := nodes.Locations.Get(node.ID)
+			if located {
+				for _, i := range OverlappingAreaIndexes(lat, lon, lat, lon) {
+					lookupAreas[i] = true
+				}
+			}
+			if camera, ok := nodes.Cameras[node.ID]; ok || node.Tags.Find("highway") == "speed_camera" {
+				if ok && camera.HasLocation {
+					markAreas(camera.Latitude, camera.Longitude, camera.Latitude, camera.Longitude)
+				} else if located {
+					markAreas(lat, lon, lat, lon)
+				}
+				// deleted nodes only carry their id
+				if !action.Delete {
+					markAreas(node.Lat, node.Lon, node.Lat, node.Lon)
+				}
+			}
+			if action.Delete {
+				nodes.Locations.Delete(node.ID)
+				delete(nodes.Features, node.ID)
+				delete(nodes.Hazards, node.ID)
+				delete(nodes.Cameras, node.ID)
+				continue
+			}
+			check(nodes.AddNode(node, filter))
+		}
+		for _, relation := range action.Data.Relations {
+			// the previous version of the relation may have enforced other devices
+			for _, id := range ClearEnforcement(nodes.Cameras, relation.ID) {
+				if lat, lon, ok := nodes.Locations.Get(id); ok {
+					markAreas(lat, lon, lat, lon)
+				}
+			}
+			if action.Delete {
+				continue
+			}
+			for _, id := range ApplyEnforcement(nodes.Cameras, relation) {
+				if lat, lon, ok := nodes.Locations.Get(id); ok {
+					markAreas(lat, lon, lat, lon)
+				}
+			}
+		}
+	}
+
+	// Ways: collect the new versions of changed ways and of unchanged ways using changed nodes
+	replaced := map[int64]*TmpWay{}
+	removed := map[int64]bool{}
+	for _, action := range actions {
+		for _, way := range action.Data.Ways {
+			id := int64(way.ID)
+			if minLat, minLon, maxLat, maxLon, ok := wayBounds.Get(id); ok {
+				markAreas(minLat, minLon, maxLat, maxLon)
+			}
+			if action.Delete || !filter.AllowsTags(way.Tags) || len(way.Nodes) < 2 {
+				delete(replaced, id)
+				removed[id] = true
+				wayBounds.Delete(id)
+				continue
+			}
+			tmpWay := NewTmpWay(way)
+			replaced[id] = &tmpWay
+			delete(removed, id)
+		}
+	}
+	for i := range lookupAreas {
+		ways, err := spill.Read(i)
+		check(errors.Wrap(err, "could not read spilled ways"))
+		for _, way := range ways {
+			if _, ok := replaced[way.Id]; ok || removed[way.Id] || !containsNode(way.NodeIds, changedNodes) {
+				continue
+			}
+			markAreas(way.MinLat, way.MinLon, way.MaxLat, way.MaxLon)
+			way := way
+			replaced[way.Id] = &way
+		}
+	}
+	for id, way := range replaced {
+		if !nodes.ResolveWay(way) || !filter.ContainsAny(way.Nodes) {
+			delete(replaced, id)
+			removed[id] = true
+			wayBounds.Delete(id)
+			continue
+		}
+		check(wayBounds.Set(*way))
+		markAreas(way.MinLat, way.MinLon, way.MaxLat, way.MaxLon)
+	}
+
+	// the replaced ways are written in id order so that a change always produces the same tiles
+	replacedIds := make([]int64, 0, len(replaced))
+	for id := range replaced {
+		replacedIds = append(replacedIds, id)
+	}
+	sort.Slice(replacedIds, func(i, j int) bool { return replacedIds[i] < replacedIds[j] })
+	areaIndexes := []int{}
+	for i := range affected {
+		areaIndexes = append(areaIndexes, i)
+	}
+	sort.Ints(areaIndexes)
+	for _, i := range areaIndexes {
+		area := AREAS[i]
+		ways, err := spill.Read(i)
+		check(errors.Wrap(err, "could not read spilled ways"))
+		kept := make([]TmpWay, 0, len(ways))
+		for _, way := range ways {
+			if _, ok := replaced[way.Id]; !ok && !removed[way.Id] {
+				kept = append(kept, way)
+			}
+		}
+		for _, id := range replacedIds {
+			way := replaced[id]
+			if Overlapping(way.MinLat, way.MinLon, way.MaxLat, way.MaxLon, area.MinLat-OVERLAP_BOX_DEGREES, area.MinLon-OVERLAP_BOX_DEGREES, area.MaxLat+OVERLAP_BOX_DEGREES, area.MaxLon+OVERLAP_BOX_DEGREES) {
+				kept = append(kept, *way)
+			}
+		}
+		check(spill.Replace(i, kept))
+	}
+
+	log.Info().Int("ways", len(replaced)).Int("deleted", len(removed)).Msg("Changed Ways")
+	if sequence > 0 {
+		state.Sequence = sequence
+	}
+	if timestamp := LatestChangeTimestamp(actions); timestamp.After(state.SourceTimestamp) {
+		state.SourceTimestamp = timestamp
+	}
+	source := OfflineSource{Timestamp: state.SourceTimestamp, Sequence: state.Sequence}
+	tiles := WriteAreas(spill, areaIndexes, nodes.SpeedCameras(), source, options.Quantize, true)
+
+	check(nodes.Save(stateDir))
+	state.UpdatedAt = time.Now().UTC()
+	check(SaveGenerateState(stateDir, state))
+	if len(reportPath) > 0 {
+		overrides := NewOverrideTracker()
+		for _, way := range replaced {
+			overrides.Add(*way)
+		}
+		check(WriteGenerateReport(reportPath, GenerateReport{
+			GeneratedAt: state.UpdatedAt,
+			Input:       changePath,
+			Sequence:    state.Sequence,
+			Incremental: true,
+			Tiles:       tiles,
+			Overrides:   overrides.Report(false),
+		}))
+		log.Info().Str("report", reportPath).Msg("Wrote Generation Report")
+	}
+	log.Info().Int64("sequence", state.Sequence).Msg("Done Applying Changes")
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"capnproto.org/go/capnp/v3"
+	"github.com/bradleyjkemp/cupaloy"
+	"github.com/paulmach/osm"
+)
+
+// Builds a generation state the way GenerateOffline does from a pbf with the given elements
+func generateTestState(t *testing.T, dir string, elements []osm.Object) {
+	filter, err := NewWayFilter("", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := GenerateOptions{MinLat: -90, MinLon: -180, MaxLat: 90, MaxLon: 180, Filter: filter, StateDir: dir}
+	err = os.MkdirAll(filepath.Join(dir, STATE_AREAS_DIR), 0o775)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spill := NewAreaSpill(filepath.Join(dir, STATE_AREAS_DIR))
+	locations, err := OpenNodeLocations(filepath.Join(dir, STATE_NODE_LOCATIONS), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer locations.Close()
+	wayBounds, err := OpenWayBounds(filepath.Join(dir, STATE_WAY_BOUNDS), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wayBounds.Close()
+	nodes := GenerateNodes{
+		Locations: locations,
+		Features:  map[osm.NodeID][]TmpFeature{},
+		Hazards:   map[osm.NodeID][]TmpHazard{},
+		Cameras:   map[osm.NodeID]*TmpSpeedCamera{},
+	}
+	for _, element := range elements {
+		switch o := element.(type) {
+		case *osm.Node:
+			err = nodes.AddNode(o, filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+		case *osm.Relation:
+			ApplyEnforcement(nodes.Cameras, o)
+		}
+	}
+	for _, element := range elements {
+		way, ok := element.(*osm.Way)
+		if !ok {
+			continue
+		}
+		tmpWay := NewTmpWay(way)
+		if !nodes.ResolveWay(&tmpWay) {
+			t.Fatalf("could not resolve way %d", way.ID)
+		}
+		err = wayBounds.Set(tmpWay)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, i := range OverlappingAreaIndexes(tmpWay.MinLat, tmpWay.MinLon, tmpWay.MaxLat, tmpWay.MaxLon) {
+			err = spill.Add(i, tmpWay)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	err = spill.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = nodes.Save(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = SaveGenerateState(dir, GenerateState{Options: options, Sequence: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readTestTile(t *testing.T, path string) (Area, []TmpSpeedCamera) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = DecodeOfflineData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := capnp.UnmarshalPacked(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offline, err := ReadRootOffline(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	area, cameras, err := ReadArea(offline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return area, cameras
+}
+
+func testTags(tags ...string) osm.Tags {
+	result := osm.Tags{}
+	for i := 0; i+1 < len(tags); i += 2 {
+		result = append(result, osm.Tag{Key: tags[i], Value: tags[i+1]})
+	}
+	return result
+}
+
+func TestApplyChanges(t *testing.T) {
+	base := useTestDirs(t)
+	stateDir := filepath.Join(base, "state")
+	node := func(id osm.NodeID, lat float64, lon float64, tags ...string) *osm.Node {
+		return &osm.Node{ID: id, Lat: lat, Lon: lon, Tags: testTags(tags...)}
+	}
+	way := func(id osm.WayID, name string, ids ...osm.NodeID) *osm.Way {
+		w := &osm.Way{ID: id, Tags: testTags("highway", "primary", "name", name)}
+		for _, id := range ids {
+			w.Nodes = append(w.Nodes, osm.WayNode{ID: id})
+		}
+		return w
+	}
+	enforcement := func(id osm.RelationID, device osm.NodeID, maxSpeed string) *osm.Relation {
+		return &osm.Relation{ID: id, Tags: testTags("type", "enforcement", "enforcement", "maxspeed", "maxspeed", maxSpeed), Members: osm.Members{
+			{Type: osm.TypeNode, Ref: int64(device), Role: "device"},
+		}}
+	}
+	generateTestState(t, stateDir, []osm.Object{
+		node(1, 38.1, -75.9),
+		node(2, 38.1, -75.89, "highway", "speed_camera", "maxspeed", "50", "direction", "E"),
+		node(3, 38.1, -75.88),
+		node(4, 38.11, -75.88),
+		node(5, 38.12, -75.88),
+		node(6, 38.12, -75.87),
+		node(7, 38.13, -75.87),
+		node(8, 38.14, -75.8, "highway", "speed_camera", "maxspeed", "70"),
+		way(1, "Main St", 1, 2, 3),
+		way(2, "Side St", 3, 4, 5),
+		way(3, "Back St", 5, 6, 7),
+		way(4, "Old Rd", 6, 7),
+		enforcement(100, 2, "40"),
+		enforcement(101, 4, "30"),
+	})
+
+	changePath := filepath.Join(base, "change.osc")
+	err := os.WriteFile(changePath, []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<osmChange version="0.6">
+  <modify>
+    <node id="3" version="2" timestamp="2024-01-02T00:00:00Z" lat="38.1005" lon="-75.88"/>
+    <way id="2" version="2" timestamp="2024-01-02T00:00:00Z">
+      <nd ref="3"/>
+      <nd ref="4"/>
+      <nd ref="5"/>
+      <tag k="highway" v="residential"/>
+      <tag k="name" v="Side Street"/>
+    </way>
+  </modify>
+  <delete>
+    <node id="6" version="2" timestamp="2024-01-02T00:00:00Z"/>
+    <node id="8" version="2" timestamp="2024-01-02T00:00:00Z"/>
+    <way id="4" version="2" timestamp="2024-01-02T00:00:00Z"/>
+    <relation id="100" version="2" timestamp="2024-01-02T00:00:00Z"/>
+    <relation id="101" version="2" timestamp="2024-01-02T00:00:00Z"/>
+  </delete>
+  <create>
+    <node id="9" version="1" timestamp="2024-01-03T00:00:00Z" lat="38.105" lon="-75.88">
+      <tag k="highway" v="speed_camera"/>
+      <tag k="maxspeed" v="60"/>
+    </node>
+  </create>
+</osmChange>
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ApplyChanges(stateDir, changePath, 2, "")
+
+	results := ""
+	tiles := []string{}
+	_ = filepath.WalkDir(BOUNDS_DIR, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			rel, _ := filepath.Rel(base, path)
+			tiles = append(tiles, rel)
+		}
+		return nil
+	})
+	results += fmt.Sprintf("rewritten tiles: %v\n", tiles)
+	for _, tile := range tiles {
+		area, cameras := readTestTile(t, filepath.Join(base, tile))
+		results += tile + ":\n"
+		for _, way := range area.Ways {
+			results += fmt.Sprintf("  way %d %q %d nodes\n", way.Id, way.Name, len(way.Nodes))
+		}
+		sort.Slice(cameras, func(i, j int) bool { return cameras[i].Latitude < cameras[j].Latitude })
+		for _, camera := range cameras {
+			results += fmt.Sprintf("  camera %.3f,%.3f %s %.2f bearing=%.0f/%v\n", camera.Latitude, camera.Longitude, camera.Enforcement, camera.MaxSpeed, camera.Bearing, camera.HasBearing)
+		}
+	}
+
+	spill := NewAreaSpill(filepath.Join(stateDir, STATE_AREAS_DIR))
+	results += "spilled areas:\n"
+	for _, i := range OverlappingAreaIndexes(38.1, -75.9, 38.14, -75.8) {
+		ways, err := spill.Read(i)
+		names := []string{}
+		for _, way := range ways {
+			names = append(names, fmt.Sprintf("%d/%q/%d nodes", way.Id, way.Name, len(way.Nodes)))
+		}
+		sort.Strings(names)
+		results += fmt.Sprintf("  %.2f,%.2f err=%v: %s\n", AREAS[i].MinLat, AREAS[i].MinLon, err, strings.Join(names, " "))
+	}
+
+	nodes, err := LoadGenerateNodes(stateDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []osm.NodeID{3, 6, 9} {
+		lat, lon, ok := nodes.Locations.Get(id)
+		results += fmt.Sprintf("node %d: %.4f,%.4f/%v\n", id, lat, lon, ok)
+	}
+	nodes.Locations.Close()
+	ids := []int{}
+	for id := range nodes.Cameras {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		camera := nodes.Cameras[osm.NodeID(id)]
+		results += fmt.Sprintf("camera %d: %s %.2f %q relation=%d tagged=%v\n", id, camera.Enforcement, camera.MaxSpeed, camera.Direction, camera.Relation, camera.Tagged)
+	}
+
+	wayBounds, err := OpenWayBounds(filepath.Join(stateDir, STATE_WAY_BOUNDS), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wayBounds.Close()
+	for id := int64(1); id <= 4; id++ {
+		minLat, minLon, maxLat, maxLon, ok := wayBounds.Get(id)
+		results += fmt.Sprintf("way bounds %d: %.4f,%.4f,%.4f,%.4f/%v\n", id, minLat, minLon, maxLat, maxLon, ok)
+	}
+	state, err := LoadGenerateState(stateDir)
+	results += fmt.Sprintf("sequence=%d source=%s err=%v\n", state.Sequence, state.SourceTimestamp.Format("2006-01-02"), err)
+
+	cupaloy.SnapshotT(t, results)
+}
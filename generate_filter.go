@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/planar"
+	"github.com/paulmach/osm"
+	"github.com/pkg/errors"
+)
+
+// Restricts which ways are generated. An empty filter keeps every way.
+type WayFilter struct {
+	Highways  map[string]bool
+	Clip      orb.MultiPolygon
+	clipBound orb.Bound
+}
+
+// Creates a filter from a comma separated list of highway values, a
+// minLon,minLat,maxLon,maxLat bounding box and the path of a GeoJSON file with
+// Polygon or MultiPolygon geometries. Empty arguments are not applied.
+func NewWayFilter(highways string, bbox string, polygonPath string) (WayFilter, error) {
+	filter := WayFilter{Highways: map[string]bool{}}
+	for _, highway := range strings.Split(highways, ",") {
+		if highway = strings.TrimSpace(highway); len(highway) > 0 {
+			filter.Highways[highway] = true
+		}
+	}
+
+	if len(bbox) > 0 {
+		parts := strings.Split(bbox, ",")
+		if len(parts) != 4 {
+			return filter, errors.New("bbox must be minLon,minLat,maxLon,maxLat")
+		}
+		values := make([]float64, 4)
+		for i, part := range parts {
+			v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+			if err != nil {
+				return filter, errors.Wrap(err, "could not parse bbox")
+			}
+			values[i] = v
+		}
+		bound := orb.Bound{Min: orb.Point{values[0], values[1]}, Max: orb.Point{values[2], values[3]}}
+		filter.Clip = append(filter.Clip, bound.ToPolygon())
+	}
+
+	if len(polygonPath) > 0 {
+		data, err := os.ReadFile(polygonPath)
+		if err != nil {
+			return filter, errors.Wrap(err, "could not read clip polygon file")
+		}
+		polygons, err := ParseClipGeoJSON(data)
+		if err != nil {
+			return filter, err
+		}
+		filter.Clip = append(filter.Clip, polygons...)
+	}
+
+	if len(filter.Clip) > 0 {
+		filter.clipBound = filter.Clip.Bound()
+	}
+	return filter, nil
+}
+
+// Collects the polygons of a GeoJSON FeatureCollection, Feature or Geometry
+func ParseClipGeoJSON(data []byte) (orb.MultiPolygon, error) {
+	var object struct {
+		Type string `json:"type"`
+	}
+	err := json.Unmarshal(data, &object)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not parse clip polygon file")
+	}
+
+	geometries := []orb.Geometry{}
+	switch object.Type {
+	case "FeatureCollection":
+		fc, err := geojson.UnmarshalFeatureCollection(data)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not parse clip feature collection")
+		}
+		for _, feature := range fc.Features {
+			geometries = append(geometries, feature.Geometry)
+		}
+	case "Feature":
+		feature, err := geojson.UnmarshalFeature(data)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not parse clip feature")
+		}
+		geometries = append(geometries, feature.Geometry)
+	default:
+		geometry, err := geojson.UnmarshalGeometry(data)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not parse clip geometry")
+		}
+		geometries = append(geometries, geometry.Geometry())
+	}
+
+	polygons := orb.MultiPolygon{}
+	for _, geometry := range geometries {
+		switch g := geometry.(type) {
+		case orb.Polygon:
+			polygons = append(polygons, g)
+		case orb.MultiPolygon:
+			polygons = append(polygons, g...)
+		}
+	}
+	if len(polygons) == 0 {
+		return nil, errors.New("clip polygon file has no polygons")
+	}
+	return polygons, nil
+}
+
+func (f WayFilter) AllowsTags(tags osm.Tags) bool {
+	return len(f.Highways) == 0 || f.Highways[tags.Find("highway")]
+}
+
+func (f WayFilter) Contains(lat float64, lon float64) bool {
+	if len(f.Clip) == 0 {
+		return true
+	}
+	point := orb.Point{lon, lat}
+	return f.clipBound.Contains(point) && planar.MultiPolygonContains(f.Clip, point)
+}
+
+// Checks if any node of a way is inside the clip area so that ways crossing
+// its border are kept whole
+func (f WayFilter) ContainsAny(nodes []TmpNode) bool {
+	for _, n := range nodes {
+		if f.Contains(n.Latitude, n.Longitude) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bradleyjkemp/cupaloy"
+	"github.com/paulmach/osm"
+)
+
+func TestWayFilter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clip.geojson")
+	// a triangle south east of the bbox
+	err := os.WriteFile(path, []byte(`{"type":"Polygon","coordinates":[[[10,0],[12,0],[10,2],[10,0]]]}`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := ""
+	for _, args := range [][3]string{
+		{"", "", ""},
+		{" primary, residential ,,", "", ""},
+		{"", "0,0,1,1", ""},
+		{"", "0,0,1,1", path},
+		{"", "0,0,1", ""},
+		{"", "0,0,1,north", ""},
+		{"", "", "missing_clip.geojson"},
+	} {
+		filter, err := NewWayFilter(args[0], args[1], args[2])
+		results += fmt.Sprintf("highways=%q bbox=%q polygon=%v: err=%v\n", args[0], args[1], len(args[2]) > 0, err)
+		if err != nil {
+			continue
+		}
+		results += "  tags:"
+		for _, highway := range []string{"primary", "residential", "footway", ""} {
+			results += fmt.Sprintf(" %q=%v", highway, filter.AllowsTags(osm.Tags{{Key: "highway", Value: highway}}))
+		}
+		results += "\n  points:"
+		for _, point := range [][2]float64{{0.5, 0.5}, {1.5, 1.5}, {0.5, 10.5}, {1.5, 11.5}, {-0.5, 10.5}} {
+			results += fmt.Sprintf(" %v=%v", point, filter.Contains(point[0], point[1]))
+		}
+		crossing := []TmpNode{{Latitude: 2, Longitude: 2}, {Latitude: 0.5, Longitude: 0.5}}
+		outside := []TmpNode{{Latitude: 2, Longitude: 2}, {Latitude: 3, Longitude: 3}}
+		results += fmt.Sprintf("\n  crossing way=%v outside way=%v\n", filter.ContainsAny(crossing), filter.ContainsAny(outside))
+	}
+
+	cupaloy.SnapshotT(t, results)
+}
+
+func TestParseClipGeoJSON(t *testing.T) {
+	results := ""
+	for _, data := range []string{
+		`{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,0]]]}`,
+		`{"type":"MultiPolygon","coordinates":[[[[0,0],[1,0],[1,1],[0,0]]],[[[5,5],[6,5],[6,6],[5,5]]]]}`,
+		`{"type":"Feature","properties":{},"geometry":{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,0]]]}}`,
+		`{"type":"FeatureCollection","features":[` +
+			`{"type":"Feature","properties":{},"geometry":{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,0]]]}},` +
+			`{"type":"Feature","properties":{},"geometry":{"type":"Point","coordinates":[3,3]}},` +
+			`{"type":"Feature","properties":{},"geometry":{"type":"MultiPolygon","coordinates":[[[[5,5],[6,5],[6,6],[5,5]]]]}}]}`,
+		`{"type":"LineString","coordinates":[[0,0],[1,1]]}`,
+		`{"type":"FeatureCollection","features":[]}`,
+		`{"type":`,
+	} {
+		polygons, err := ParseClipGeoJSON([]byte(data))
+		results += fmt.Sprintf("%s\n  polygons=%d err=%v\n", data, len(polygons), err)
+		for _, polygon := range polygons {
+			results += fmt.Sprintf("  bound=%v\n", polygon.Bound())
+		}
+	}
+
+	cupaloy.SnapshotT(t, results)
+}
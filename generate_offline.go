@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"math"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strconv"
+	"sync"
+	"time"
 
 	"capnproto.org/go/capnp/v3"
 	"github.com/paulmach/osm"
@@ -18,12 +21,21 @@ import (
 type TmpNode struct {
 	Latitude  float64
 	Longitude float64
+	Elevation float32
 }
+type TmpFeature struct {
+	Type      FeatureType
+	Value     string
+	NodeIndex uint32
+	Direction string
+}
+
 type TmpWay struct {
 	Id                        int64
 	Name                      string
 	Ref                       string
 	Hazard                    string
+	Junction                  string
 	MaxSpeed                  float64
 	MaxSpeedForward           float64
 	MaxSpeedBackward          float64
@@ -37,7 +49,18 @@ type TmpWay struct {
 	MaxLat                    float64
 	MaxLon                    float64
 	OneWay                    bool
+	HasElevation              bool
 	Nodes                     []TmpNode
+	Features                  []TmpFeature
+	Hazards                   []TmpHazard
+	LanesForward              TmpLanes
+	LanesBackward             TmpLanes
+	Tunnel                    bool
+	Bridge                    bool
+	Layer                     int8
+	Surface                   string
+	Smoothness                string
+	NodeIds                   []osm.NodeID // not written to offline data, used to refresh the way when its nodes change
 }
 
 type Area struct {
@@ -756,196 +779,606 @@ func GenerateAreas() []Area {
 	return areas
 }
 
-func GenerateOffline(minGenLat int, minGenLon int, maxGenLat int, maxGenLon int, generateEmptyFiles bool) {
+// Features of a node that matter for the speed along a way. A node gets at most
+// one traffic calming feature and one control feature.
+func NodeFeatures(tags osm.Tags) []TmpFeature {
+	features := []TmpFeature{}
+	direction := tags.Find("direction")
+	if v := tags.Find("traffic_calming"); len(v) > 0 && v != "no" {
+		features = append(features, TmpFeature{Type: FeatureType_trafficCalming, Value: v, Direction: direction})
+	}
+	highway := tags.Find("highway")
+	switch {
+	case tags.Find("railway") == "level_crossing":
+		features = append(features, TmpFeature{Type: FeatureType_levelCrossing, Value: tags.Find("crossing:barrier"), Direction: direction})
+	case highway == "traffic_signals":
+		if d := tags.Find("traffic_signals:direction"); len(d) > 0 {
+			direction = d
+		}
+		features = append(features, TmpFeature{Type: FeatureType_trafficSignals, Value: tags.Find("traffic_signals"), Direction: direction})
+	case highway == "stop":
+		features = append(features, TmpFeature{Type: FeatureType_stop, Value: tags.Find("stop"), Direction: direction})
+	case highway == "give_way":
+		features = append(features, TmpFeature{Type: FeatureType_giveWay, Direction: direction})
+	case highway == "motorway_junction":
+		features = append(features, TmpFeature{Type: FeatureType_motorwayJunction, Value: tags.Find("ref")})
+	case len(tags.Find("crossing")) > 0 && tags.Find("crossing") != "no":
+		features = append(features, TmpFeature{Type: FeatureType_crossing, Value: tags.Find("crossing"), Direction: direction})
+	}
+	return features
+}
+
+// Converts the tags of an osm way. The geometry is filled in by ResolveWay.
+func NewTmpWay(way *osm.Way) TmpWay {
+	tags := way.TagMap()
+	lanes, _ := strconv.ParseUint(tags["lanes"], 10, 8)
+	roundabout := tags["junction"] == "roundabout" || tags["junction"] == "circular"
+	tmpWay := TmpWay{
+		Id:                        int64(way.ID),
+		Name:                      tags["name"],
+		Ref:                       tags["ref"],
+		Hazard:                    tags["hazard"],
+		Junction:                  tags["junction"],
+		MaxSpeed:                  ParseMaxSpeed(tags["maxspeed"]),
+		MaxSpeedAdvisory:          ParseMaxSpeed(tags["maxspeed:advisory"]),
+		MaxSpeedPractical:         ParseMaxSpeed(tags["maxspeed:practical"]),
+		MaxSpeedPracticalForward:  ParseMaxSpeed(tags["maxspeed:practical:forward"]),
+		MaxSpeedPracticalBackward: ParseMaxSpeed(tags["maxspeed:practical:backward"]),
+		MaxSpeedForward:           ParseMaxSpeed(tags["maxspeed:forward"]),
+		MaxSpeedBackward:          ParseMaxSpeed(tags["maxspeed:backward"]),
+		Lanes:                     uint8(lanes),
+		OneWay:                    tags["oneway"] == "yes" || (roundabout && tags["oneway"] != "no"), // roundabouts imply oneway
+		Tunnel:                    len(tags["tunnel"]) > 0 && tags["tunnel"] != "no",
+		Bridge:                    len(tags["bridge"]) > 0 && tags["bridge"] != "no",
+		Layer:                     ParseLayer(tags["layer"]),
+		Surface:                   tags["surface"],
+		Smoothness:                tags["smoothness"],
+		Hazards:                   ParseHazards(way.Tags),
+		NodeIds:                   make([]osm.NodeID, len(way.Nodes)),
+	}
+	for i, n := range way.Nodes {
+		tmpWay.NodeIds[i] = n.ID
+	}
+	tmpWay.LanesForward, tmpWay.LanesBackward = NewWayLanes(tags, tmpWay.OneWay)
+
+	// Apply override if it exists for all speed values
+	if override, exists := maxSpeedOverrides[tmpWay.Id]; exists {
+		overrideInMS := 0.277778 * override // Convert to m/s
+		tmpWay.MaxSpeedPractical = overrideInMS
+
+		// Apply override to directional practical speeds
+		if tmpWay.MaxSpeedPracticalForward > 0 {
+			tmpWay.MaxSpeedPracticalForward = overrideInMS
+		}
+		if tmpWay.MaxSpeedPracticalBackward > 0 {
+			tmpWay.MaxSpeedPracticalBackward = overrideInMS
+		}
+
+		// Apply override to directional speeds if they exist
+		if tmpWay.MaxSpeedForward > 0 {
+			tmpWay.MaxSpeedForward = overrideInMS
+		}
+		if tmpWay.MaxSpeedBackward > 0 {
+			tmpWay.MaxSpeedBackward = overrideInMS
+		}
+	}
+	return tmpWay
+}
+
+// Node data that ways are resolved against
+type GenerateNodes struct {
+	Locations *NodeLocations
+	Features  map[osm.NodeID][]TmpFeature
+	Hazards   map[osm.NodeID][]TmpHazard
+	Cameras   map[osm.NodeID]*TmpSpeedCamera
+	DEM       *DEM
+}
+
+// Indexes the location of a node and records its features, hazards and speed camera
+func (g *GenerateNodes) AddNode(node *osm.Node, filter WayFilter) error {
+	delete(g.Features, node.ID)
+	delete(g.Hazards, node.ID)
+	// cameras of enforcement relations stay until the relation changes
+	enforced, isEnforced := g.Cameras[node.ID]
+	if isEnforced && enforced.Relation == 0 {
+		delete(g.Cameras, node.ID)
+		isEnforced = false
+	}
+	tagged := false
+	if len(node.Tags) > 0 {
+		if features := NodeFeatures(node.Tags); len(features) > 0 {
+			g.Features[node.ID] = features
+		}
+		if hazards := ParseHazards(node.Tags); len(hazards) > 0 {
+			g.Hazards[node.ID] = hazards
+		}
+		tagged = node.Tags.Find("highway") == "speed_camera" && filter.Contains(node.Lat, node.Lon)
+	}
+	switch {
+	case tagged && isEnforced:
+		camera := SpeedCameraFromNode(node)
+		if enforced.MaxSpeed == enforced.TaggedMaxSpeed {
+			enforced.MaxSpeed = camera.MaxSpeed
+		}
+		if enforced.Direction == enforced.TaggedDirection {
+			enforced.Direction = camera.Direction
+		}
+		enforced.Latitude, enforced.Longitude, enforced.HasLocation = camera.Latitude, camera.Longitude, true
+		enforced.Tagged, enforced.TaggedMaxSpeed, enforced.TaggedDirection = true, camera.TaggedMaxSpeed, camera.TaggedDirection
+	case tagged:
+		camera := SpeedCameraFromNode(node)
+		g.Cameras[node.ID] = &camera
+	case isEnforced:
+		// the device is located through the node locations
+		enforced.Latitude, enforced.Longitude, enforced.HasLocation = 0, 0, false
+		enforced.Tagged, enforced.TaggedMaxSpeed, enforced.TaggedDirection = false, 0, ""
+	}
+	return g.Locations.Set(node.ID, node.Lat, node.Lon)
+}
+
+// Fills in the node locations, bounds, elevations and node features and
+// hazards of a way. Nodes missing from an extract are dropped. Returns false if
+// fewer than two nodes could be located.
+func (g *GenerateNodes) ResolveWay(way *TmpWay) bool {
+	way.Nodes = make([]TmpNode, 0, len(way.NodeIds))
+	way.Features = nil
+	wayHazards := []TmpHazard{}
+	for _, hazard := range way.Hazards {
+		if !hazard.OnNode {
+			wayHazards = append(wayHazards, hazard)
+		}
+	}
+	way.Hazards = wayHazards
+
+	way.MinLat = float64(90)
+	way.MinLon = float64(180)
+	way.MaxLat = float64(-90)
+	way.MaxLon = float64(-180)
+	ids := make([]osm.NodeID, 0, len(way.NodeIds))
+	for _, id := range way.NodeIds {
+		lat, lon, ok := g.Locations.Get(id)
+		if !ok {
+			continue
+		}
+		i := len(way.Nodes)
+		way.Nodes = append(way.Nodes, TmpNode{Latitude: lat, Longitude: lon})
+		ids = append(ids, id)
+		way.MinLat = math.Min(way.MinLat, lat)
+		way.MinLon = math.Min(way.MinLon, lon)
+		way.MaxLat = math.Max(way.MaxLat, lat)
+		way.MaxLon = math.Max(way.MaxLon, lon)
+		for _, feature := range g.Features[id] {
+			feature.NodeIndex = uint32(i)
+			way.Features = append(way.Features, feature)
+		}
+		for _, hazard := range g.Hazards[id] {
+			hazard.OnNode = true
+			hazard.NodeIndex = uint32(i)
+			way.Hazards = append(way.Hazards, hazard)
+		}
+	}
+	if len(way.Nodes) < 2 {
+		return false
+	}
+	for i, id := range ids {
+		if camera, ok := g.Cameras[id]; ok {
+			SetCameraWayBearing(camera, way.Nodes, i)
+		}
+	}
+	way.HasElevation = false
+	if g.DEM != nil {
+		way.HasElevation = true
+		for i, n := range way.Nodes {
+			elevation, ok := g.DEM.Elevation(n.Latitude, n.Longitude)
+			way.HasElevation = way.HasElevation && ok
+			way.Nodes[i].Elevation = float32(elevation)
+		}
+	}
+	return true
+}
+
+// Resolves the speed cameras against the node location index
+func (g *GenerateNodes) SpeedCameras() []TmpSpeedCamera {
+	cameraLocations := map[osm.NodeID]TmpNode{}
+	for id, camera := range g.Cameras {
+		for _, nodeId := range []osm.NodeID{id, camera.FromNode, camera.ToNode} {
+			if lat, lon, ok := g.Locations.Get(nodeId); ok && nodeId != 0 {
+				cameraLocations[nodeId] = TmpNode{Latitude: lat, Longitude: lon}
+			}
+		}
+	}
+	return ResolveSpeedCameras(g.Cameras, cameraLocations)
+}
+
+// Checks if an area is inside the requested generation bounds
+func InGenerationBounds(area Area, minGenLat int, minGenLon int, maxGenLat int, maxGenLon int) bool {
+	return !(area.MinLat < float64(minGenLat)-OVERLAP_BOX_DEGREES || area.MinLon < float64(minGenLon)-OVERLAP_BOX_DEGREES || area.MaxLat > float64(maxGenLat)+OVERLAP_BOX_DEGREES || area.MaxLon > float64(maxGenLon)+OVERLAP_BOX_DEGREES)
+}
+
+// Builds the offline data of an area without its metadata
+func NewOfflineMessage(area Area, cameras []TmpSpeedCamera, encoding CoordinateEncoding) (*capnp.Message, Offline) {
+	arena := capnp.MultiSegment([][]byte{})
+	msg, seg, err := capnp.NewMessage(arena)
+	check(errors.Wrap(err, "could not create capnp arena for offline data"))
+	rootOffline, err := NewRootOffline(seg)
+	check(errors.Wrap(err, "could not create capnp offline root"))
+
+	ways, err := rootOffline.NewWays(int32(len(area.Ways)))
+	check(errors.Wrap(err, "could not create ways in offline data"))
+	rootOffline.SetMinLat(area.MinLat)
+	rootOffline.SetMinLon(area.MinLon)
+	rootOffline.SetMaxLat(area.MaxLat)
+	rootOffline.SetMaxLon(area.MaxLon)
+	rootOffline.SetOverlap(OVERLAP_BOX_DEGREES)
+	rootOffline.SetCoordinateEncoding(encoding)
+	for i, way := range area.Ways {
+		w := ways.At(i)
+		w.SetId(way.Id)
+		err := w.SetName(way.Name)
+		check(errors.Wrap(err, "could not set way name"))
+		err = w.SetRef(way.Ref)
+		check(errors.Wrap(err, "could not set way ref"))
+		err = w.SetHazard(way.Hazard)
+		check(errors.Wrap(err, "could not set way hazard"))
+		err = w.SetJunction(way.Junction)
+		check(errors.Wrap(err, "could not set way junction"))
+		w.SetMaxSpeed(way.MaxSpeed)
+		w.SetMaxSpeedForward(way.MaxSpeedForward)
+		w.SetMaxSpeedBackward(way.MaxSpeedBackward)
+		w.SetAdvisorySpeed(way.MaxSpeedAdvisory)
+		w.SetMaxSpeedPractical(way.MaxSpeedPractical)
+		w.SetMaxSpeedPracticalForward(way.MaxSpeedPracticalForward)
+		w.SetMaxSpeedPracticalBackward(way.MaxSpeedPracticalBackward)
+		w.SetMaxSpeedForward(way.MaxSpeedForward)
+		w.SetMaxSpeedBackward(way.MaxSpeedBackward)
+		w.SetLanes(way.Lanes)
+		w.SetOneWay(way.OneWay)
+		w.SetHasElevation(way.HasElevation)
+		w.SetTunnel(way.Tunnel)
+		w.SetBridge(way.Bridge)
+		w.SetLayer(way.Layer)
+		err = w.SetSurface(way.Surface)
+		check(errors.Wrap(err, "could not set way surface"))
+		err = w.SetSmoothness(way.Smoothness)
+		check(errors.Wrap(err, "could not set way smoothness"))
+		if encoding == CoordinateEncoding_delta1e7 {
+			// the bounding box is left out and recomputed from the nodes when decoding
+			err = SetNodeDeltas(w, way, area.MinLat, area.MinLon)
+			check(err)
+		} else {
+			w.SetMinLat(way.MinLat)
+			w.SetMinLon(way.MinLon)
+			w.SetMaxLat(way.MaxLat)
+			w.SetMaxLon(way.MaxLon)
+			nodes, err := w.NewNodes(int32(len(way.Nodes)))
+			check(errors.Wrap(err, "could not create way nodes"))
+			for j, node := range way.Nodes {
+				n := nodes.At(j)
+				n.SetLatitude(node.Latitude)
+				n.SetLongitude(node.Longitude)
+				n.SetElevation(node.Elevation)
+			}
+		}
+		features, err := w.NewFeatures(int32(len(way.Features)))
+		check(errors.Wrap(err, "could not create way features"))
+		for j, feature := range way.Features {
+			f := features.At(j)
+			f.SetType(feature.Type)
+			f.SetNodeIndex(feature.NodeIndex)
+			err = f.SetValue(feature.Value)
+			check(errors.Wrap(err, "could not set feature value"))
+			err = f.SetDirection(feature.Direction)
+			check(errors.Wrap(err, "could not set feature direction"))
+		}
+		lanesForward, err := w.NewLanesForward()
+		check(errors.Wrap(err, "could not create way forward lanes"))
+		check(SetLanes(lanesForward, way.LanesForward))
+		lanesBackward, err := w.NewLanesBackward()
+		check(errors.Wrap(err, "could not create way backward lanes"))
+		check(SetLanes(lanesBackward, way.LanesBackward))
+		hazards, err := w.NewHazards(int32(len(way.Hazards)))
+		check(errors.Wrap(err, "could not create way hazards"))
+		for j, hazard := range way.Hazards {
+			h := hazards.At(j)
+			h.SetType(hazard.Type)
+			h.SetOnNode(hazard.OnNode)
+			h.SetNodeIndex(hazard.NodeIndex)
+			err = h.SetValue(hazard.Value)
+			check(errors.Wrap(err, "could not set hazard value"))
+			err = h.SetDirection(hazard.Direction)
+			check(errors.Wrap(err, "could not set hazard direction"))
+		}
+	}
+	speedCameras, err := rootOffline.NewSpeedCameras(int32(len(cameras)))
+	check(errors.Wrap(err, "could not create speed cameras in offline data"))
+	for i, camera := range cameras {
+		c := speedCameras.At(i)
+		c.SetId(camera.Id)
+		c.SetLatitude(camera.Latitude)
+		c.SetLongitude(camera.Longitude)
+		c.SetMaxSpeed(camera.MaxSpeed)
+		c.SetBearing(camera.Bearing)
+		c.SetHasBearing(camera.HasBearing)
+		c.SetZoneEndLatitude(camera.ZoneEndLatitude)
+		c.SetZoneEndLongitude(camera.ZoneEndLongitude)
+		err = c.SetEnforcement(camera.Enforcement)
+		check(errors.Wrap(err, "could not set speed camera enforcement"))
+	}
+	return msg, rootOffline
+}
+
+// Encodes the offline data of an area with the metadata of its source
+func MarshalArea(area Area, cameras []TmpSpeedCamera, source OfflineSource, encoding CoordinateEncoding) []byte {
+	msg, rootOffline := NewOfflineMessage(area, cameras, encoding)
+	err := SetOfflineMetadata(rootOffline, source)
+	check(errors.Wrap(err, "could not set offline metadata"))
+	data, err := msg.MarshalPacked()
+	check(errors.Wrap(err, "could not marshal offline data"))
+	return data
+}
+
+// Writes the offline data file of a single area and reports its coverage. For
+// quantized files the report also has the size the file would have had without.
+func WriteArea(area Area, cameras []TmpSpeedCamera, source OfflineSource, quantize bool) TileReport {
+	encoding := CoordinateEncoding_float64
+	if quantize {
+		encoding = CoordinateEncoding_delta1e7
+	}
+	data := MarshalArea(area, cameras, source, encoding)
+	err := CreateBoundsDir(area.MinLat, area.MinLon, area.MaxLat, area.MaxLon)
+	check(errors.Wrap(err, "could not create directory for bounds file"))
+	fileName := GenerateBoundsFileName(area.MinLat, area.MinLon, area.MaxLat, area.MaxLon)
+	err = os.WriteFile(fileName, data, 0o644)
+	check(errors.Wrap(err, "could not write offline data to file"))
+	report := NewTileReport(area, fileName, len(data))
+	if quantize {
+		report.UnquantizedBytes = len(MarshalArea(area, cameras, source, CoordinateEncoding_float64))
+	}
+	return report
+}
+
+type GenerateOptions struct {
+	Input              string // path of the pbf to generate from
+	MinLat             int
+	MinLon             int
+	MaxLat             int
+	MaxLon             int
+	GenerateEmptyFiles bool
+	DEMDir             string // directory of elevation data, empty to skip elevations
+	Filter             WayFilter
+	StateDir           string // keeps the data needed to apply osm changes later, empty to discard it
+	Sequence           int64  // replication sequence number of the input
+	Report             string // path to write the JSON generation report to
+	Quantize           bool   // stores node coordinates as 1e-7 degree deltas instead of floats
+}
+
+// Writes the offline data files of the given areas in parallel from their
+// spilled ways. The tile reports are in the order of areaIndexes.
+func WriteAreas(spill *AreaSpill, areaIndexes []int, speedCameras []TmpSpeedCamera, source OfflineSource, quantize bool, keepSpill bool) []TileReport {
+	areaCameras := map[int][]TmpSpeedCamera{}
+	for _, camera := range speedCameras {
+		for _, i := range OverlappingAreaIndexes(camera.Latitude, camera.Longitude, camera.Latitude, camera.Longitude) {
+			areaCameras[i] = append(areaCameras[i], camera)
+		}
+	}
+
+	log.Info().Int("areas", len(areaIndexes)).Msg("Writing Areas")
+	reports := make([]TileReport, len(areaIndexes))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.GOMAXPROCS(-1); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				i := areaIndexes[job]
+				area := AREAS[i]
+				ways, err := spill.Read(i)
+				check(errors.Wrap(err, "could not read spilled ways"))
+				area.Ways = ways
+				reports[job] = WriteArea(area, areaCameras[i], source, quantize)
+				if !keepSpill {
+					check(spill.Remove(i))
+				}
+			}
+		}()
+	}
+	for job := range areaIndexes {
+		jobs <- job
+	}
+	close(jobs)
+	wg.Wait()
+
+	f, err := os.Open(BOUNDS_DIR)
+	check(errors.Wrap(err, "could not open bounds directory"))
+	err = f.Sync()
+	check(errors.Wrap(err, "could not fsync bounds directory"))
+	err = f.Close()
+	check(errors.Wrap(err, "could not close bounds directory"))
+
+	if quantize {
+		size, unquantizedSize := 0, 0
+		for _, report := range reports {
+			size += report.Bytes
+			unquantizedSize += report.UnquantizedBytes
+		}
+		log.Info().Int("bytes", size).Int("unquantized_bytes", unquantizedSize).Int("saved_bytes", unquantizedSize-size).Msg("Quantized Coordinates")
+	}
+	return reports
+}
+
+func GenerateOffline(options GenerateOptions) {
 	log.Info().Msg("Generating Offline Map")
 	EnsureOfflineMapsDirectories()
-	file, err := os.Open("./map.osm.pbf")
+	minGenLat := options.MinLat
+	minGenLon := options.MinLon
+	maxGenLat := options.MaxLat
+	maxGenLon := options.MaxLon
+	filter := options.Filter
+
+	var dem *DEM
+	if len(options.DEMDir) > 0 {
+		var err error
+		dem, err = OpenDEM(options.DEMDir)
+		check(errors.Wrap(err, "could not open elevation data"))
+	}
+	file, err := os.Open(options.Input)
 	check(errors.Wrap(err, "could not open map pbf file"))
 	defer file.Close()
 
-	// The third parameter is the number of parallel decoders to use.
-	scanner := osmpbf.New(context.Background(), file, runtime.GOMAXPROCS(-1))
-	scanner.SkipRelations = true
-	defer scanner.Close()
-
-	scannedWays := []TmpWay{}
-	areas := GenerateAreas()
+	stateDir := options.StateDir
+	if len(stateDir) == 0 {
+		stateDir, err = os.MkdirTemp(GetBaseOpPath(), "generate-")
+		check(errors.Wrap(err, "could not create spill directory"))
+		defer os.RemoveAll(stateDir)
+	} else {
+		err = os.RemoveAll(filepath.Join(stateDir, STATE_AREAS_DIR))
+		check(errors.Wrap(err, "could not clear generation state"))
+	}
+	err = os.MkdirAll(filepath.Join(stateDir, STATE_AREAS_DIR), 0o775)
+	check(errors.Wrap(err, "could not create spill directory"))
+	spill := NewAreaSpill(filepath.Join(stateDir, STATE_AREAS_DIR))
+	locations, err := OpenNodeLocations(filepath.Join(stateDir, STATE_NODE_LOCATIONS), true)
+	check(err)
+	defer locations.Close()
+	var wayBounds *WayBounds
+	if len(options.StateDir) > 0 {
+		wayBounds, err = OpenWayBounds(filepath.Join(stateDir, STATE_WAY_BOUNDS), true)
+		check(err)
+		defer wayBounds.Close()
+	}
+	nodes := GenerateNodes{
+		Locations: locations,
+		Features:  map[osm.NodeID][]TmpFeature{},
+		Hazards:   map[osm.NodeID][]TmpHazard{},
+		Cameras:   map[osm.NodeID]*TmpSpeedCamera{},
+		DEM:       dem,
+	}
+	overrides := NewOverrideTracker()
 	index := 0
 	allMinLat := float64(90)
 	allMinLon := float64(180)
 	allMaxLat := float64(-90)
 	allMaxLon := float64(-180)
 
+	// The first pass indexes node locations so that way geometry can be
+	// resolved without preprocessing the pbf with osmium add-locations-to-ways.
+	log.Info().Msg("Scanning Nodes")
+	// The third parameter is the number of parallel decoders to use.
+	scanner := osmpbf.New(context.Background(), file, runtime.GOMAXPROCS(-1))
+	scanner.SkipWays = true
+	source := OfflineSource{Sequence: options.Sequence}
+	header, err := scanner.Header()
+	check(errors.Wrap(err, "could not read map pbf header"))
+	source.Timestamp = header.ReplicationTimestamp
+	if source.Sequence == 0 {
+		source.Sequence = int64(header.ReplicationSeqNum)
+	}
+	for scanner.Scan() {
+		switch o := scanner.Object().(type) {
+		case *osm.Node:
+			check(nodes.AddNode(o, filter))
+		case *osm.Relation:
+			// enforcement relations are applied before the ways so that the
+			// ways through their devices resolve forward and backward directions
+			ApplyEnforcement(nodes.Cameras, o)
+		}
+	}
+	check(errors.Wrap(scanner.Err(), "could not scan map pbf file for nodes"))
+	scanner.Close()
+
 	log.Info().Msg("Scanning Ways")
+	_, err = file.Seek(0, 0)
+	check(errors.Wrap(err, "could not rewind map pbf file"))
+	scanner = osmpbf.New(context.Background(), file, runtime.GOMAXPROCS(-1))
+	scanner.SkipNodes = true
+	scanner.SkipRelations = true
+	defer scanner.Close()
 	for scanner.Scan() {
 		var way *osm.Way
 		switch o := scanner.Object(); o.(type) {
 		case *osm.Way:
 			way = o.(*osm.Way)
+			if !filter.AllowsTags(way.Tags) {
+				way = nil
+			}
 		default:
 			way = nil
 		}
 		if way != nil && len(way.Nodes) > 1 {
-			tags := way.TagMap()
-			lanes, _ := strconv.ParseUint(tags["lanes"], 10, 8)
-			tmpWay := TmpWay{
-				Id:                        int64(way.ID),
-				Nodes:                     make([]TmpNode, len(way.Nodes)),
-				Name:                      tags["name"],
-				Ref:                       tags["ref"],
-				Hazard:                    tags["hazard"],
-				MaxSpeed:                  ParseMaxSpeed(tags["maxspeed"]),
-				MaxSpeedAdvisory:          ParseMaxSpeed(tags["maxspeed:advisory"]),
-				MaxSpeedPractical:         ParseMaxSpeed(tags["maxspeed:practical"]),
-				MaxSpeedPracticalForward:  ParseMaxSpeed(tags["maxspeed:practical:forward"]),
-				MaxSpeedPracticalBackward: ParseMaxSpeed(tags["maxspeed:practical:backward"]),
-				MaxSpeedForward:           ParseMaxSpeed(tags["maxspeed:forward"]),
-				MaxSpeedBackward:          ParseMaxSpeed(tags["maxspeed:backward"]),
-				Lanes:                     uint8(lanes),
-				OneWay:                    tags["oneway"] == "yes",
+			tmpWay := NewTmpWay(way)
+			if !nodes.ResolveWay(&tmpWay) || !filter.ContainsAny(tmpWay.Nodes) {
+				overrides.Outside(tmpWay.Id)
+				continue
 			}
 			index++
-
-			// Apply override if it exists for all speed values
-			if override, exists := maxSpeedOverrides[tmpWay.Id]; exists {
-				overrideInMS := 0.277778 * override // Convert to m/s
-				tmpWay.MaxSpeedPractical = overrideInMS
-
-				// Apply override to directional practical speeds
-				if tmpWay.MaxSpeedPracticalForward > 0 {
-					tmpWay.MaxSpeedPracticalForward = overrideInMS
-				}
-				if tmpWay.MaxSpeedPracticalBackward > 0 {
-					tmpWay.MaxSpeedPracticalBackward = overrideInMS
-				}
-
-				// Apply override to directional speeds if they exist
-				if tmpWay.MaxSpeedForward > 0 {
-					tmpWay.MaxSpeedForward = overrideInMS
-				}
-				if tmpWay.MaxSpeedBackward > 0 {
-					tmpWay.MaxSpeedBackward = overrideInMS
-				}
+			if tmpWay.MinLat < allMinLat {
+				allMinLat = tmpWay.MinLat
 			}
-
-			minLat := float64(90)
-			minLon := float64(180)
-			maxLat := float64(-90)
-			maxLon := float64(-180)
-			for i, n := range way.Nodes {
-				if n.Lat < minLat {
-					minLat = n.Lat
-				}
-				if n.Lon < minLon {
-					minLon = n.Lon
-				}
-				if n.Lat > maxLat {
-					maxLat = n.Lat
-				}
-				if n.Lon > maxLon {
-					maxLon = n.Lon
-				}
-				tmpWay.Nodes[i].Latitude = n.Lat
-				tmpWay.Nodes[i].Longitude = n.Lon
+			if tmpWay.MinLon < allMinLon {
+				allMinLon = tmpWay.MinLon
 			}
-			tmpWay.MinLat = minLat
-			tmpWay.MinLon = minLon
-			tmpWay.MaxLat = maxLat
-			tmpWay.MaxLon = maxLon
-			if minLat < allMinLat {
-				allMinLat = minLat
+			if tmpWay.MaxLat > allMaxLat {
+				allMaxLat = tmpWay.MaxLat
 			}
-			if minLon < allMinLon {
-				allMinLon = minLon
+			if tmpWay.MaxLon > allMaxLon {
+				allMaxLon = tmpWay.MaxLon
 			}
-			if maxLat > allMaxLat {
-				allMaxLat = maxLat
+			if wayBounds != nil {
+				check(wayBounds.Set(tmpWay))
+			}
+			inBox := false
+			for _, i := range OverlappingAreaIndexes(tmpWay.MinLat, tmpWay.MinLon, tmpWay.MaxLat, tmpWay.MaxLon) {
+				if InGenerationBounds(AREAS[i], minGenLat, minGenLon, maxGenLat, maxGenLon) {
+					check(errors.Wrap(spill.Add(i, tmpWay), "could not spill way"))
+					inBox = true
+				}
 			}
-			if maxLon > allMaxLon {
-				allMaxLon = maxLon
+			if inBox {
+				overrides.Add(tmpWay)
+			} else {
+				overrides.Outside(tmpWay.Id)
 			}
-			scannedWays = append(scannedWays, tmpWay)
 		}
 	}
 
-	log.Info().Msg("Finding Bounds")
-	for _, area := range areas {
-		if area.MinLat < float64(minGenLat)-OVERLAP_BOX_DEGREES || area.MinLon < float64(minGenLon)-OVERLAP_BOX_DEGREES || area.MaxLat > float64(maxGenLat)+OVERLAP_BOX_DEGREES || area.MaxLon > float64(maxGenLon)+OVERLAP_BOX_DEGREES {
-			continue
-		}
-
-		haveWays := Overlapping(allMinLat, allMinLon, allMaxLat, allMaxLon, area.MinLat-OVERLAP_BOX_DEGREES, area.MinLon-OVERLAP_BOX_DEGREES, area.MaxLat+OVERLAP_BOX_DEGREES, area.MaxLon+OVERLAP_BOX_DEGREES)
-		if !haveWays && !generateEmptyFiles {
-			continue
-		}
-
-		arena := capnp.MultiSegment([][]byte{})
-		msg, seg, err := capnp.NewMessage(arena)
-		check(errors.Wrap(err, "could not create capnp arena for offline data"))
-		rootOffline, err := NewRootOffline(seg)
-		check(errors.Wrap(err, "could not create capnp offline root"))
+	check(errors.Wrap(scanner.Err(), "could not scan map pbf file for ways"))
+	speedCameras := nodes.SpeedCameras()
 
-		for _, way := range scannedWays {
-			overlaps := Overlapping(way.MinLat, way.MinLon, way.MaxLat, way.MaxLon, area.MinLat-OVERLAP_BOX_DEGREES, area.MinLon-OVERLAP_BOX_DEGREES, area.MaxLat+OVERLAP_BOX_DEGREES, area.MaxLon+OVERLAP_BOX_DEGREES)
-			if overlaps {
-				area.Ways = append(area.Ways, way)
+	log.Info().Msg("Finding Bounds")
+	check(errors.Wrap(spill.Flush(), "could not flush spilled ways"))
+	areaIndexes := []int{}
+	for row := 0; row < AREA_ROWS; row++ {
+		for col := 0; col < AREA_COLUMNS; col++ {
+			i := row*AREA_COLUMNS + col
+			area := AREAS[i]
+			if !InGenerationBounds(area, minGenLat, minGenLon, maxGenLat, maxGenLon) {
+				continue
 			}
-		}
-
-		log.Info().Msg("Writing Area")
-		ways, err := rootOffline.NewWays(int32(len(area.Ways)))
-		check(errors.Wrap(err, "could not create ways in offline data"))
-		rootOffline.SetMinLat(area.MinLat)
-		rootOffline.SetMinLon(area.MinLon)
-		rootOffline.SetMaxLat(area.MaxLat)
-		rootOffline.SetMaxLon(area.MaxLon)
-		rootOffline.SetOverlap(OVERLAP_BOX_DEGREES)
-		for i, way := range area.Ways {
-			w := ways.At(i)
-			w.SetId(way.Id)
-			w.SetMinLat(way.MinLat)
-			w.SetMinLon(way.MinLon)
-			w.SetMaxLat(way.MaxLat)
-			w.SetMaxLon(way.MaxLon)
-			err := w.SetName(way.Name)
-			check(errors.Wrap(err, "could not set way name"))
-			err = w.SetRef(way.Ref)
-			check(errors.Wrap(err, "could not set way ref"))
-			err = w.SetHazard(way.Hazard)
-			check(errors.Wrap(err, "could not set way hazard"))
-			w.SetMaxSpeed(way.MaxSpeed)
-			w.SetMaxSpeedForward(way.MaxSpeedForward)
-			w.SetMaxSpeedBackward(way.MaxSpeedBackward)
-			w.SetAdvisorySpeed(way.MaxSpeedAdvisory)
-			w.SetMaxSpeedPractical(way.MaxSpeedPractical)
-			w.SetMaxSpeedPracticalForward(way.MaxSpeedPracticalForward)
-			w.SetMaxSpeedPracticalBackward(way.MaxSpeedPracticalBackward)
-			w.SetMaxSpeedForward(way.MaxSpeedForward)
-			w.SetMaxSpeedBackward(way.MaxSpeedBackward)
-			w.SetLanes(way.Lanes)
-			w.SetOneWay(way.OneWay)
-			nodes, err := w.NewNodes(int32(len(way.Nodes)))
-			check(errors.Wrap(err, "could not create way nodes"))
-			for j, node := range way.Nodes {
-				n := nodes.At(j)
-				n.SetLatitude(node.Latitude)
-				n.SetLongitude(node.Longitude)
+			haveWays := spill.Count(i) > 0 || Overlapping(allMinLat, allMinLon, allMaxLat, allMaxLon, area.MinLat-OVERLAP_BOX_DEGREES, area.MinLon-OVERLAP_BOX_DEGREES, area.MaxLat+OVERLAP_BOX_DEGREES, area.MaxLon+OVERLAP_BOX_DEGREES)
+			if !haveWays && !options.GenerateEmptyFiles {
+				continue
 			}
+			areaIndexes = append(areaIndexes, i)
 		}
+	}
 
-		data, err := msg.MarshalPacked()
-		check(errors.Wrap(err, "could not marshal offline data"))
-		err = CreateBoundsDir(area.MinLat, area.MinLon, area.MaxLat, area.MaxLon)
-		check(errors.Wrap(err, "could not create directory for bounds file"))
-		err = os.WriteFile(GenerateBoundsFileName(area.MinLat, area.MinLon, area.MaxLat, area.MaxLon), data, 0o644)
-		check(errors.Wrap(err, "could not write offline data to file"))
+	tiles := WriteAreas(spill, areaIndexes, speedCameras, source, options.Quantize, len(options.StateDir) > 0)
+	if len(options.Report) > 0 {
+		check(WriteGenerateReport(options.Report, GenerateReport{
+			GeneratedAt: time.Now().UTC(),
+			Input:       options.Input,
+			Sequence:    source.Sequence,
+			Tiles:       tiles,
+			Overrides:   overrides.Report(true),
+		}))
+		log.Info().Str("report", options.Report).Msg("Wrote Generation Report")
+	}
+
+	if len(options.StateDir) > 0 {
+		check(nodes.Save(stateDir))
+		check(SaveGenerateState(stateDir, GenerateState{Options: options, Sequence: source.Sequence, SourceTimestamp: source.Timestamp, UpdatedAt: time.Now().UTC()}))
 	}
-	f, err := os.Open(BOUNDS_DIR)
-	check(errors.Wrap(err, "could not open bounds directory"))
-	err = f.Sync()
-	check(errors.Wrap(err, "could not fsync bounds directory"))
-	err = f.Close()
-	check(errors.Wrap(err, "could not close bounds directory"))
 
 	log.Info().Msg("Done Generating Offline Map")
 }
@@ -956,15 +1389,16 @@ func PointInBox(ax float64, ay float64, bxMin float64, byMin float64, bxMax floa
 
 var AREAS = GenerateAreas()
 
-func FindWaysAroundLocation(lat float64, lon float64) ([]byte, error) {
+// Opens the offline data file of the area around a location, nil if there is none
+func FindTileAroundLocation(lat float64, lon float64) (*OfflineTile, error) {
 	for _, area := range AREAS {
 		inBox := PointInBox(lat, lon, area.MinLat, area.MinLon, area.MaxLat, area.MaxLon)
 		if inBox {
 			boundsName := GenerateBoundsFileName(area.MinLat, area.MinLon, area.MaxLat, area.MaxLon)
 			log.Info().Str("filename", boundsName).Msg("Loading bounds file")
-			data, err := os.ReadFile(boundsName)
-			return data, errors.Wrap(err, "could not read current offline data file")
+			tile, err := OpenOfflineTile(boundsName)
+			return tile, errors.Wrap(err, "could not load current offline data file")
 		}
 	}
-	return []uint8{}, nil
+	return nil, nil
 }
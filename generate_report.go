@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Coverage of a single written offline data file. Shares are the fraction of
+// the tile's ways that have the tag, from 0 to 1.
+type TileReport struct {
+	File                     string  `json:"file"`
+	MinLat                   float64 `json:"min_lat"`
+	MinLon                   float64 `json:"min_lon"`
+	MaxLat                   float64 `json:"max_lat"`
+	MaxLon                   float64 `json:"max_lon"`
+	Ways                     int     `json:"ways"`
+	Nodes                    int     `json:"nodes"`
+	Bytes                    int     `json:"bytes"`
+	UnquantizedBytes         int     `json:"unquantized_bytes"` // size with float coordinates, equal to bytes unless quantized
+	MaxSpeedShare            float64 `json:"maxspeed_share"`
+	DirectionalMaxSpeedShare float64 `json:"directional_maxspeed_share"`
+	PracticalMaxSpeedShare   float64 `json:"practical_maxspeed_share"`
+	LanesShare               float64 `json:"lanes_share"`
+	AdvisoryShare            float64 `json:"advisory_share"`
+}
+
+type AppliedOverride struct {
+	WayId    int64   `json:"way_id"`
+	Name     string  `json:"name"`
+	MaxSpeed float64 `json:"maxspeed"` // km/h
+}
+
+type OverridesReport struct {
+	Applied   []AppliedOverride `json:"applied"`
+	Unmatched []int64           `json:"unmatched"` // override way ids that were not in the input
+}
+
+type GenerateReport struct {
+	GeneratedAt time.Time       `json:"generated_at"`
+	Input       string          `json:"input"`
+	Sequence    int64           `json:"sequence"`
+	Incremental bool            `json:"incremental"` // only the tiles rewritten by applying changes are listed
+	Tiles       []TileReport    `json:"tiles"`
+	Overrides   OverridesReport `json:"overrides"`
+}
+
+func NewTileReport(area Area, file string, size int) TileReport {
+	report := TileReport{
+		File:   file,
+		MinLat: area.MinLat,
+		MinLon: area.MinLon,
+		MaxLat: area.MaxLat,
+		MaxLon: area.MaxLon,
+		Ways:   len(area.Ways),
+		Bytes:  size,
+
+		UnquantizedBytes: size,
+	}
+	if len(area.Ways) == 0 {
+		return report
+	}
+	maxSpeed, directional, practical, lanes, advisory := 0, 0, 0, 0, 0
+	for _, way := range area.Ways {
+		report.Nodes += len(way.Nodes)
+		if way.MaxSpeed > 0 {
+			maxSpeed++
+		}
+		if way.MaxSpeedForward > 0 || way.MaxSpeedBackward > 0 {
+			directional++
+		}
+		if way.MaxSpeedPractical > 0 || way.MaxSpeedPracticalForward > 0 || way.MaxSpeedPracticalBackward > 0 {
+			practical++
+		}
+		if way.Lanes > 0 {
+			lanes++
+		}
+		if way.MaxSpeedAdvisory > 0 {
+			advisory++
+		}
+	}
+	total := float64(len(area.Ways))
+	report.MaxSpeedShare = float64(maxSpeed) / total
+	report.DirectionalMaxSpeedShare = float64(directional) / total
+	report.PracticalMaxSpeedShare = float64(practical) / total
+	report.LanesShare = float64(lanes) / total
+	report.AdvisoryShare = float64(advisory) / total
+	return report
+}
+
+// Records the overrides of generated ways. Call Report after every way was added.
+type OverrideTracker struct {
+	applied map[int64]AppliedOverride
+	outside map[int64]bool // overridden ways of the input that lie outside the generated box
+}
+
+func NewOverrideTracker() *OverrideTracker {
+	return &OverrideTracker{applied: map[int64]AppliedOverride{}, outside: map[int64]bool{}}
+}
+
+func (o *OverrideTracker) Add(way TmpWay) {
+	if override, exists := maxSpeedOverrides[way.Id]; exists {
+		o.applied[way.Id] = AppliedOverride{WayId: way.Id, Name: way.Name, MaxSpeed: override}
+	}
+}
+
+// Records a way of the input that is not generated because it lies outside
+// the generated box, its override is applied when its own box is generated
+func (o *OverrideTracker) Outside(id int64) {
+	if _, exists := maxSpeedOverrides[id]; exists {
+		o.outside[id] = true
+	}
+}
+
+// Lists the applied overrides and, if listUnmatched is set, the overrides whose ways were not in the input
+func (o *OverrideTracker) Report(listUnmatched bool) OverridesReport {
+	report := OverridesReport{Applied: []AppliedOverride{}, Unmatched: []int64{}}
+	for _, override := range o.applied {
+		report.Applied = append(report.Applied, override)
+	}
+	sort.Slice(report.Applied, func(i, j int) bool {
+		return report.Applied[i].WayId < report.Applied[j].WayId
+	})
+	if listUnmatched {
+		for id := range maxSpeedOverrides {
+			if _, ok := o.applied[id]; !ok && !o.outside[id] {
+				report.Unmatched = append(report.Unmatched, id)
+			}
+		}
+		sort.Slice(report.Unmatched, func(i, j int) bool {
+			return report.Unmatched[i] < report.Unmatched[j]
+		})
+	}
+	return report
+}
+
+func WriteGenerateReport(path string, report GenerateReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "could not marshal generation report")
+	}
+	return errors.Wrap(os.WriteFile(path, data, 0o644), "could not write generation report")
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/bradleyjkemp/cupaloy"
+)
+
+func TestNewTileReport(t *testing.T) {
+	nodes := []TmpNode{{Latitude: 51.1, Longitude: 17.1}, {Latitude: 51.2, Longitude: 17.2}}
+	area := Area{MinLat: 51, MinLon: 17, MaxLat: 51.25, MaxLon: 17.25, Ways: []TmpWay{
+		{Id: 1, MaxSpeed: 13.9, Lanes: 2, Nodes: nodes},
+		{Id: 2, MaxSpeedForward: 13.9, MaxSpeedPractical: 11.1, Nodes: nodes},
+		{Id: 3, MaxSpeedAdvisory: 8.3, Nodes: nodes},
+		{Id: 4, Nodes: nodes},
+	}}
+
+	data, err := json.Marshal(NewTileReport(area, "tile", 1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cupaloy.SnapshotT(t, string(data))
+}
+
+func TestOverrideTrackerReport(t *testing.T) {
+	ids := []int64{}
+	for id := range maxSpeedOverrides {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	applied, outside := ids[0], ids[1]
+
+	overrides := NewOverrideTracker()
+	overrides.Add(TmpWay{Id: applied, Name: "in the box"})
+	overrides.Add(TmpWay{Id: -1, Name: "not overridden"})
+	overrides.Outside(outside)
+	overrides.Outside(-2)
+	report := overrides.Report(true)
+	unmatched := map[int64]bool{}
+	for _, id := range report.Unmatched {
+		unmatched[id] = true
+	}
+
+	cupaloy.SnapshotT(t,
+		fmt.Sprintf("applied %+v", report.Applied),
+		fmt.Sprintf("applied unmatched %v, outside unmatched %v", unmatched[applied], unmatched[outside]),
+		fmt.Sprintf("other overrides unmatched %v", len(report.Unmatched) == len(ids)-2),
+		fmt.Sprintf("unmatched without listing %v", overrides.Report(false).Unmatched),
+	)
+}
@@ -6,7 +6,9 @@ require (
 	capnproto.org/go/capnp/v3 v3.0.0-alpha-29
 	github.com/bradleyjkemp/cupaloy v2.3.0+incompatible
 	github.com/gofrs/flock v0.8.1
+	github.com/paulmach/orb v0.1.3
 	github.com/paulmach/osm v0.7.1
+	golang.org/x/sys v0.14.0
 )
 
 require (
@@ -15,13 +17,11 @@ require (
 	github.com/google/go-cmp v0.5.8 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.19 // indirect
-	github.com/paulmach/orb v0.1.3 // indirect
 	github.com/paulmach/protoscan v0.2.1 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/rs/zerolog v1.31.0 // indirect
 	golang.org/x/sync v0.5.0 // indirect
-	golang.org/x/sys v0.14.0 // indirect
 	google.golang.org/protobuf v1.27.1 // indirect
 	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
 	zenhack.net/go/util v0.0.0-20230414204917-531d38494cf5 // indirect
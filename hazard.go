@@ -0,0 +1,280 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/paulmach/osm"
+	"github.com/pkg/errors"
+)
+
+var HAZARD_LOOKAHEAD = float64(MIN_WAY_DIST) // meters. how far along the predicted path to report hazards
+
+var hazardTypeNames = map[HazardType]string{
+	HazardType_other:             "other",
+	HazardType_curve:             "curve",
+	HazardType_animalCrossing:    "animal_crossing",
+	HazardType_schoolZone:        "school_zone",
+	HazardType_ice:               "ice",
+	HazardType_fallingRocks:      "falling_rocks",
+	HazardType_slippery:          "slippery",
+	HazardType_unevenRoad:        "uneven_road",
+	HazardType_pedestrians:       "pedestrians",
+	HazardType_cyclists:          "cyclists",
+	HazardType_roadworks:         "roadworks",
+	HazardType_roadNarrows:       "road_narrows",
+	HazardType_dangerousJunction: "dangerous_junction",
+	HazardType_sideWinds:         "side_winds",
+	HazardType_fog:               "fog",
+	HazardType_flooding:          "flooding",
+	HazardType_queuesLikely:      "queues_likely",
+}
+
+// OSM hazard values and their aliases
+var hazardValues = map[string]HazardType{
+	"curve":              HazardType_curve,
+	"curves":             HazardType_curve,
+	"turn":               HazardType_curve,
+	"turns":              HazardType_curve,
+	"animal_crossing":    HazardType_animalCrossing,
+	"animal":             HazardType_animalCrossing,
+	"deer":               HazardType_animalCrossing,
+	"school_zone":        HazardType_schoolZone,
+	"children":           HazardType_schoolZone,
+	"ice":                HazardType_ice,
+	"snow":               HazardType_ice,
+	"falling_rocks":      HazardType_fallingRocks,
+	"landslide":          HazardType_fallingRocks,
+	"slippery":           HazardType_slippery,
+	"loose_gravel":       HazardType_slippery,
+	"bump":               HazardType_unevenRoad,
+	"dip":                HazardType_unevenRoad,
+	"damaged_road":       HazardType_unevenRoad,
+	"frost_heave":        HazardType_unevenRoad,
+	"uneven_road":        HazardType_unevenRoad,
+	"pedestrians":        HazardType_pedestrians,
+	"cyclists":           HazardType_cyclists,
+	"roadworks":          HazardType_roadworks,
+	"construction":       HazardType_roadworks,
+	"road_narrows":       HazardType_roadNarrows,
+	"dangerous_junction": HazardType_dangerousJunction,
+	"side_winds":         HazardType_sideWinds,
+	"fog":                HazardType_fog,
+	"flooding":           HazardType_flooding,
+	"queues_likely":      HazardType_queuesLikely,
+}
+
+// Warning signs from traffic_sign tags, keyed without the country prefix
+var hazardSigns = map[string]map[string]HazardType{
+	"PL": {
+		"A-1":   HazardType_curve,
+		"A-2":   HazardType_curve,
+		"A-3":   HazardType_curve,
+		"A-4":   HazardType_curve,
+		"A-11":  HazardType_unevenRoad,
+		"A-11a": HazardType_unevenRoad,
+		"A-12a": HazardType_roadNarrows,
+		"A-12b": HazardType_roadNarrows,
+		"A-12c": HazardType_roadNarrows,
+		"A-14":  HazardType_roadworks,
+		"A-15":  HazardType_slippery,
+		"A-16":  HazardType_pedestrians,
+		"A-17":  HazardType_schoolZone,
+		"A-18a": HazardType_animalCrossing,
+		"A-18b": HazardType_animalCrossing,
+		"A-19":  HazardType_sideWinds,
+		"A-24":  HazardType_cyclists,
+		"A-25":  HazardType_fallingRocks,
+		"A-32":  HazardType_ice,
+		"A-33":  HazardType_queuesLikely,
+	},
+	"DE": {
+		"103":    HazardType_curve,
+		"105":    HazardType_curve,
+		"112":    HazardType_unevenRoad,
+		"114":    HazardType_slippery,
+		"120":    HazardType_roadNarrows,
+		"123":    HazardType_roadworks,
+		"133":    HazardType_pedestrians,
+		"136":    HazardType_schoolZone,
+		"138":    HazardType_cyclists,
+		"142":    HazardType_animalCrossing,
+		"101-15": HazardType_fallingRocks,
+		"101-51": HazardType_ice,
+		"101-52": HazardType_queuesLikely,
+	},
+}
+
+type TmpHazard struct {
+	Type      HazardType
+	Value     string
+	OnNode    bool
+	NodeIndex uint32
+	Direction string
+}
+
+type PathHazard struct {
+	Type      string  `json:"type"`
+	Value     string  `json:"value"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Distance  float64 `json:"distance"`
+	Extent    float64 `json:"extent"`
+	WayId     uint64  `json:"way_id"`
+}
+
+func ParseHazardValue(value string) HazardType {
+	if hazardType, ok := hazardValues[strings.ToLower(value)]; ok {
+		return hazardType
+	}
+	return HazardType_other
+}
+
+// Parses a traffic_sign tag into the hazard types of its warning signs
+func ParseHazardSigns(trafficSign string) []HazardType {
+	hazardTypes := []HazardType{}
+	country := ""
+	for _, sign := range strings.FieldsFunc(trafficSign, func(r rune) bool { return r == ';' || r == ',' }) {
+		sign = strings.TrimSpace(sign)
+		if i := strings.Index(sign, ":"); i >= 0 {
+			country = sign[:i]
+			sign = sign[i+1:]
+		}
+		// drop additional sign values such as DE:274[60]
+		if i := strings.Index(sign, "["); i >= 0 {
+			sign = sign[:i]
+		}
+		if hazardType, ok := hazardSigns[country][sign]; ok {
+			hazardTypes = append(hazardTypes, hazardType)
+		} else if hazardType, ok := hazardValues[sign]; ok {
+			hazardTypes = append(hazardTypes, hazardType)
+		}
+	}
+	return hazardTypes
+}
+
+// Collects the hazards of an OSM element from the hazard, hazard:* and
+// traffic_sign tags. Each hazard type is reported at most once.
+func ParseHazards(tags osm.Tags) []TmpHazard {
+	hazards := []TmpHazard{}
+	seen := map[HazardType]bool{}
+	add := func(hazardType HazardType, value string) {
+		if seen[hazardType] {
+			return
+		}
+		seen[hazardType] = true
+		hazards = append(hazards, TmpHazard{Type: hazardType, Value: value, Direction: tags.Find("direction")})
+	}
+
+	for _, value := range strings.Split(tags.Find("hazard"), ";") {
+		if value = strings.TrimSpace(value); len(value) > 0 && value != "no" {
+			add(ParseHazardValue(value), value)
+		}
+	}
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag.Key, "hazard:") || tag.Value == "no" {
+			continue
+		}
+		key := strings.TrimPrefix(tag.Key, "hazard:")
+		if tag.Value == "yes" {
+			add(ParseHazardValue(key), key)
+		} else {
+			add(ParseHazardValue(key), tag.Value)
+		}
+	}
+	trafficSign := tags.Find("traffic_sign")
+	for _, hazardType := range ParseHazardSigns(trafficSign) {
+		add(hazardType, trafficSign)
+	}
+	return hazards
+}
+
+// Lists the hazards along the predicted path within HAZARD_LOOKAHEAD, nearest
+// first. Hazards tagged on a way extend over the part of the way on the path,
+// hazards tagged on a node are points.
+func GetPathHazards(pos Position, currentWay CurrentWay, nextWays []NextWayResult) ([]PathHazard, error) {
+	directions := map[int64]bool{currentWay.Way.Id(): currentWay.OnWay.IsForward}
+	for _, nextWay := range nextWays {
+		directions[nextWay.Way.Id()] = nextWay.IsForward
+	}
+
+	var err error
+	pathHazards := []PathHazard{}
+	wayEnds := map[int64]float64{}
+	WalkPathNodes(pos, currentWay, nextWays, func(way Way, index int, distance float64) {
+		wayEnds[way.Id()] = distance
+		if distance > HAZARD_LOOKAHEAD || !way.HasHazards() {
+			return
+		}
+		hazards, e := way.Hazards()
+		if e != nil {
+			err = errors.Wrap(e, "could not read way hazards")
+			return
+		}
+		nodes, e := way.Nodes()
+		if e != nil {
+			err = errors.Wrap(e, "could not read way nodes")
+			return
+		}
+		for i := 0; i < hazards.Len(); i++ {
+			hazard := hazards.At(i)
+			if !hazard.OnNode() || int(hazard.NodeIndex()) != index {
+				continue
+			}
+			direction, _ := hazard.Direction()
+			if !FeatureApplies(direction, directions[way.Id()]) {
+				continue
+			}
+			value, _ := hazard.Value()
+			node := nodes.At(index)
+			pathHazards = append(pathHazards, PathHazard{
+				Type:      hazardTypeNames[hazard.Type()],
+				Value:     value,
+				Latitude:  node.Latitude(),
+				Longitude: node.Longitude(),
+				Distance:  distance,
+				WayId:     uint64(way.Id()),
+			})
+		}
+	})
+
+	addWayHazards := func(way Way, lat float64, lon float64, distance float64) {
+		if distance > HAZARD_LOOKAHEAD || !way.HasHazards() {
+			return
+		}
+		hazards, e := way.Hazards()
+		if e != nil {
+			err = errors.Wrap(e, "could not read way hazards")
+			return
+		}
+		extent := wayEnds[way.Id()] - distance
+		if extent < 0 {
+			extent = 0
+		}
+		for i := 0; i < hazards.Len(); i++ {
+			hazard := hazards.At(i)
+			if hazard.OnNode() {
+				continue
+			}
+			value, _ := hazard.Value()
+			pathHazards = append(pathHazards, PathHazard{
+				Type:      hazardTypeNames[hazard.Type()],
+				Value:     value,
+				Latitude:  lat,
+				Longitude: lon,
+				Distance:  distance,
+				Extent:    extent,
+				WayId:     uint64(way.Id()),
+			})
+		}
+	}
+	addWayHazards(currentWay.Way, pos.Latitude, pos.Longitude, 0)
+	for _, nextWay := range nextWays {
+		addWayHazards(nextWay.Way, nextWay.StartPosition.Latitude(), nextWay.StartPosition.Longitude(), nextWay.Distance)
+	}
+
+	sort.SliceStable(pathHazards, func(i, j int) bool {
+		return pathHazards[i].Distance < pathHazards[j].Distance
+	})
+	return pathHazards, err
+}
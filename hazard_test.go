@@ -0,0 +1,23 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bradleyjkemp/cupaloy"
+	"github.com/paulmach/osm"
+)
+
+func TestParseHazards(t *testing.T) {
+	hazards := ParseHazards(osm.Tags{
+		{Key: "hazard", Value: "curves;deer"},
+		{Key: "hazard:children", Value: "yes"},
+		{Key: "traffic_sign", Value: "PL:A-15,A-1"},
+	})
+	names := []string{}
+	for _, hazard := range hazards {
+		names = append(names, hazardTypeNames[hazard.Type]+"="+hazard.Value)
+	}
+
+	cupaloy.SnapshotT(t, strings.Join(names, " "))
+}
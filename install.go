@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	DOWNLOAD_DIR = fmt.Sprintf("%s/tmp", GetBaseOpPath())      // group archives are downloaded here before they are installed
+	STAGING_DIR  = fmt.Sprintf("%s/staging", GetBaseOpPath())  // downloaded groups are extracted and checked here before they go live
+	PREVIOUS_DIR = fmt.Sprintf("%s/previous", GetBaseOpPath()) // the replaced version of every installed group, for rollbacks
+)
+
+var (
+	groupsLock    sync.RWMutex // held to swap groups and to open tiles, so a tile is never opened half way through a swap
+	groupsVersion atomic.Int64 // counts the installs and rollbacks, the loaded tile is reopened when it changes
+)
+
+// Changes every time a group is installed or rolled back
+func GroupsVersion() int64 {
+	return groupsVersion.Load()
+}
+
+type RollbackRequest struct {
+	Groups []string `json:"groups"` // groups such as 38/-76, all groups with a previous version when empty
+}
+
+// The live, staged and previous directories of a 2x2 degree group such as 38/-76
+func groupDirs(group string) (string, string, string) {
+	return filepath.Join(BOUNDS_DIR, group), filepath.Join(STAGING_DIR, "offline", group), filepath.Join(PREVIOUS_DIR, group)
+}
+
+// Checks that a directory holds exactly the files of a group's manifest
+func VerifyGroupDir(base string, groupDir string, manifest GroupManifest) error {
+	expected := map[string]ManifestFile{}
+	for _, file := range manifest.Files {
+		expected[file.Name] = file
+	}
+	err := filepath.WalkDir(filepath.Join(base, groupDir), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(base, path)
+		if err != nil {
+			return errors.Wrap(err, "could not get staged file name")
+		}
+		name = filepath.ToSlash(name)
+		want, ok := expected[name]
+		if !ok {
+			return errors.Errorf("staged file %s is not in the manifest", name)
+		}
+		file, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		if file.Size != want.Size || file.SHA256 != want.SHA256 {
+			return errors.Errorf("staged file %s does not match the manifest", name)
+		}
+		delete(expected, name)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(expected) > 0 {
+		return errors.Errorf("%d files of the manifest were not staged", len(expected))
+	}
+	return nil
+}
+
+var exchangeDirs = renameExchange // replaced in tests to use the fallback of swapDirs
+
+// Moves a into b and b into a. Without an atomic exchange the group is
+// missing for the moment between the renames.
+func swapDirs(a string, b string) error {
+	if exchangeDirs(a, b) == nil {
+		return nil
+	}
+	tmp := b + ".swap"
+	err := os.RemoveAll(tmp)
+	if err != nil {
+		return errors.Wrap(err, "could not remove old swap directory")
+	}
+	err = os.Rename(b, tmp)
+	if err != nil {
+		return errors.Wrap(err, "could not move directory aside")
+	}
+	err = os.Rename(a, b)
+	if err != nil {
+		restoreErr := os.Rename(tmp, b)
+		if restoreErr != nil {
+			return errors.Wrapf(err, "could not move directory into place, restoring it failed too: %v", restoreErr)
+		}
+		return errors.Wrap(err, "could not move directory into place")
+	}
+	return errors.Wrap(os.Rename(tmp, a), "could not move swapped directory")
+}
+
+// Makes dir the live version of a group and keeps the replaced version as
+// its previous version
+func replaceGroup(dir string, group string) error {
+	groupsLock.Lock()
+	defer groupsLock.Unlock()
+	defer groupsVersion.Add(1)
+	live, _, previous := groupDirs(group)
+	err := os.RemoveAll(previous)
+	if err != nil {
+		return errors.Wrap(err, "could not remove the old previous version")
+	}
+	for _, parent := range []string{filepath.Dir(live), filepath.Dir(previous)} {
+		err = os.MkdirAll(parent, 0o775)
+		if err != nil {
+			return errors.Wrap(err, "could not create group parent directory")
+		}
+	}
+	if _, err := os.Stat(live); err != nil {
+		return errors.Wrap(os.Rename(dir, live), "could not install group")
+	}
+	err = swapDirs(dir, live)
+	if err != nil {
+		return errors.Wrap(err, "could not swap in group")
+	}
+	return errors.Wrap(os.Rename(dir, previous), "could not keep the previous version of the group")
+}
+
+// Extracts a verified group archive into the staging directory, checks the
+// extracted tiles against the manifest and swaps the whole group in
+func InstallGroup(archivePath string, group string, manifest GroupManifest) error {
+	_, staged, _ := groupDirs(group)
+	err := os.RemoveAll(staged)
+	if err != nil {
+		return errors.Wrap(err, "could not clear staging directory")
+	}
+	defer os.RemoveAll(staged)
+	rejected, err := ExtractArchive(archivePath, STAGING_DIR, group)
+	AddRejectedEntries(rejected)
+	if err != nil {
+		return errors.Wrap(err, "could not extract group into staging directory")
+	}
+	err = VerifyGroupDir(STAGING_DIR, filepath.ToSlash(filepath.Join("offline", group)), manifest)
+	if err != nil {
+		return errors.Wrap(err, "staged group does not match its manifest")
+	}
+	err = replaceGroup(staged, group)
+	if err != nil {
+		return err
+	}
+	log.Info().Str("group", group).Int("files", len(manifest.Files)).Msg("Installed group")
+	return nil
+}
+
+// Swaps the live and previous versions of a group. Rolling back twice
+// restores the newer version.
+func RollbackGroup(group string) error {
+	// the name is joined to the offline directories, only <lat>/<lon> is accepted
+	if _, err := ParseGroupArea(group); err != nil {
+		return err
+	}
+	groupsLock.Lock()
+	defer groupsLock.Unlock()
+	defer groupsVersion.Add(1)
+	live, _, previous := groupDirs(group)
+	if _, err := os.Stat(previous); err != nil {
+		return errors.Errorf("group %s has no previous version", group)
+	}
+	if _, err := os.Stat(live); err != nil {
+		err = os.Rename(previous, live)
+		if err == nil {
+			logwe(errors.Wrap(recordRollback(group), "could not record rollback"))
+		}
+		return errors.Wrap(err, "could not restore previous version")
+	}
+	err := swapDirs(previous, live)
+	if err != nil {
+		return errors.Wrap(err, "could not swap in previous version")
+	}
+	logwe(errors.Wrap(recordRollback(group), "could not record rollback"))
+	log.Info().Str("group", group).Msg("Rolled back group")
+	return nil
+}
+
+// The groups that have a previous version to roll back to
+func PreviousGroups() []string {
+	dirs, _ := filepath.Glob(filepath.Join(PREVIOUS_DIR, "*", "*"))
+	groups := []string{}
+	for _, dir := range dirs {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() || strings.HasSuffix(dir, ".swap") {
+			continue
+		}
+		group, err := filepath.Rel(PREVIOUS_DIR, dir)
+		if err == nil {
+			groups = append(groups, filepath.ToSlash(group))
+		}
+	}
+	return groups
+}
+
+func RollbackIfTriggered() {
+	b, err := TakeParam(DOWNLOAD_ROLLBACK)
+	logwe(err)
+	if err != nil || len(b) == 0 {
+		return
+	}
+	var request RollbackRequest
+	err = json.Unmarshal(b, &request)
+	logwe(errors.Wrap(err, "could not unmarshal rollback request"))
+	if err == nil {
+		groups := request.Groups
+		if len(groups) == 0 {
+			groups = PreviousGroups()
+		}
+		for _, group := range groups {
+			logwe(errors.Wrapf(RollbackGroup(group), "could not roll back group %s", group))
+		}
+	}
+}
@@ -0,0 +1,8 @@
+package main
+
+import "golang.org/x/sys/unix"
+
+// Atomically exchanges two directories with renameat2
+func renameExchange(a string, b string) error {
+	return unix.Renameat2(unix.AT_FDCWD, a, unix.AT_FDCWD, b, unix.RENAME_EXCHANGE)
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "github.com/pkg/errors"
+
+func renameExchange(a string, b string) error {
+	return errors.New("atomic directory exchange is not supported")
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bradleyjkemp/cupaloy"
+)
+
+func TestInstallGroup(t *testing.T) {
+	useTestDirs(t)
+	tile := filepath.Join(BOUNDS_DIR, "38", "-76", "38.000000_-76.000000_38.250000_-75.750000")
+
+	results := ""
+	readTile := func(step string) {
+		data, err := os.ReadFile(tile)
+		results += fmt.Sprintf("%s: %q %v\n", step, data, err == nil)
+	}
+	for _, content := range []string{"release 1", "release 2"} {
+		source := t.TempDir()
+		archivePath := writeTestGroup(t, source, map[string]string{"offline/38/-76/38.000000_-76.000000_38.250000_-75.750000": content})
+		manifest, err := NewGroupManifest(source, "offline/38/-76")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = InstallGroup(archivePath, "38/-76", manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		readTile("install")
+	}
+
+	// a bad release keeps the live group
+	source := t.TempDir()
+	archivePath := writeTestGroup(t, source, map[string]string{"offline/38/-76/38.000000_-76.000000_38.250000_-75.750000": "release 3"})
+	results += fmt.Sprintf("mismatch: %v\n", InstallGroup(archivePath, "38/-76", GroupManifest{}) != nil)
+	readTile("after mismatch")
+
+	results += fmt.Sprintf("previous groups: %v\n", PreviousGroups())
+	for i := 0; i < 2; i++ {
+		err := RollbackGroup("38/-76")
+		if err != nil {
+			t.Fatal(err)
+		}
+		readTile("rollback")
+	}
+	for _, group := range []string{"../../..", "38/-76/..", "39/-76"} {
+		results += fmt.Sprintf("rollback %q: %v\n", group, RollbackGroup(group))
+	}
+	_, err := os.Stat(filepath.Join(STAGING_DIR, "offline", "38", "-76"))
+	results += fmt.Sprintf("staging cleared: %v\n", os.IsNotExist(err))
+
+	cupaloy.SnapshotT(t, results)
+}
+
+func TestSwapDirsFallback(t *testing.T) {
+	exchange := exchangeDirs
+	defer func() { exchangeDirs = exchange }()
+	exchangeDirs = func(a string, b string) error { return fmt.Errorf("renameat2 is not supported") }
+	base := t.TempDir()
+	results := ""
+	write := func(dir string, content string) {
+		err := os.MkdirAll(dir, 0o775)
+		if err == nil {
+			err = os.WriteFile(filepath.Join(dir, "tile"), []byte(content), 0o644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(step string, err error) {
+		a, _ := os.ReadFile(filepath.Join(base, "a", "tile"))
+		b, _ := os.ReadFile(filepath.Join(base, "b", "tile"))
+		_, swapErr := os.Stat(filepath.Join(base, "b.swap"))
+		results += fmt.Sprintf("%s: err=%v a=%q b=%q swap left=%v\n", step, err, a, b, swapErr == nil)
+	}
+	write(filepath.Join(base, "a"), "new")
+	write(filepath.Join(base, "b"), "old")
+	read("swap", swapDirs(filepath.Join(base, "a"), filepath.Join(base, "b")))
+
+	// the directory that should move into place is missing, b is restored
+	// and the failure is reported
+	read("missing", swapDirs(filepath.Join(base, "missing"), filepath.Join(base, "b")))
+
+	cupaloy.SnapshotT(t, strings.ReplaceAll(results, base, "<base>"))
+}
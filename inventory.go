@@ -0,0 +1,474 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	DISK_BUDGET          = int64(0) // bytes the installed, previous and unpacked offline data may use, 0 for no limit
+	UNPACKED_SIZE_FACTOR = int64(4) // estimate of how many times larger the unpacked cache of a tile is than the tile
+)
+
+// An installed 2x2 degree group and the disk space it uses
+type GroupInventory struct {
+	Group        string     `json:"group"`
+	Size         int64      `json:"size"`          // bytes of the live tiles
+	PreviousSize int64      `json:"previous_size"` // bytes of the version a rollback returns to
+	UnpackedSize int64      `json:"unpacked_size"` // bytes of the tiles unpacked for reading
+	Files        int        `json:"files"`
+	GeneratedAt  *time.Time `json:"generated_at"` // null when the group was installed before it was recorded
+	Locations    []string   `json:"locations"`    // nation and state codes whose bounding boxes overlap the group
+}
+
+type Inventory struct {
+	Groups     []GroupInventory `json:"groups"`
+	TotalSize  int64            `json:"total_size"`
+	DiskBudget int64            `json:"disk_budget"`
+}
+
+// A request written to the OSMDeleteRegions param. Every group that overlaps
+// one of the locations or the bounds is deleted.
+type DeleteRequest struct {
+	Nations []string `json:"nations"`
+	States  []string `json:"states"`
+	Bounds  *Bounds  `json:"bounds"`
+	Groups  []string `json:"groups"` // groups such as 38/-76
+}
+
+// The size and number of the files below a directory, 0 if it does not exist
+func dirSize(dir string) (int64, int) {
+	size := int64(0)
+	files := 0
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			size += info.Size()
+			files++
+		}
+		return nil
+	})
+	return size, files
+}
+
+// The bytes used by the installed, previous and unpacked offline data
+func DiskUsage() int64 {
+	usage := int64(0)
+	for _, dir := range []string{BOUNDS_DIR, PREVIOUS_DIR, UNPACKED_DIR} {
+		size, _ := dirSize(dir)
+		usage += size
+	}
+	return usage
+}
+
+// The disk usage once the installed tiles that were not read yet are unpacked
+func projectedDiskUsage() int64 {
+	usage := DiskUsage()
+	_ = filepath.WalkDir(BOUNDS_DIR, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if _, err := os.Stat(UnpackedTileName(path)); err == nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			usage += info.Size() * UNPACKED_SIZE_FACTOR
+		}
+		return nil
+	})
+	return usage
+}
+
+func DiskBudget() int64 {
+	budget := readIntParam(DISK_BUDGET_PERSIST, DISK_BUDGET)
+	if budget < 0 {
+		return 0
+	}
+	return budget
+}
+
+var (
+	diskLock     sync.Mutex
+	diskReserved int64 // bytes of the groups that are being downloaded
+)
+
+// The bytes installing a group adds to the disk usage once its tiles are
+// unpacked, and the bytes it needs only while it is installed. The archive is
+// kept in the download directory until the group is installed, the tiles are
+// extracted into the staging directory and moved into place from there.
+func groupSpace(group string, manifest GroupManifest) (int64, int64) {
+	tiles := int64(0)
+	for _, file := range manifest.Files {
+		tiles += file.Size
+	}
+	live, _, previous := groupDirs(group)
+	previousSize, _ := dirSize(previous)
+	unpackedSize, _ := dirSize(UnpackedTileName(live))
+	// the live version becomes the previous version and the unpacked cache of
+	// the new tiles replaces the one of the live version
+	return tiles + tiles*UNPACKED_SIZE_FACTOR - previousSize - unpackedSize, manifest.Archive.Size
+}
+
+// Reserves the space a group needs until the returned function is called, or
+// refuses it when installing the group would go over the disk budget. The
+// installed group replaces the previous version of the group, the live version
+// becomes the new previous version.
+func ReserveDiskSpace(group string, manifest GroupManifest) (func(), error) {
+	budget := DiskBudget()
+	if budget == 0 {
+		return func() {}, nil
+	}
+	installed, transient := groupSpace(group, manifest)
+	needed := installed + transient
+
+	diskLock.Lock()
+	defer diskLock.Unlock()
+	usage := projectedDiskUsage() + diskReserved
+	if usage+needed > budget {
+		return func() {}, errors.Errorf("installing group %s needs %d bytes, %d of the disk budget of %d bytes are used", group, needed, usage, budget)
+	}
+	diskReserved += needed
+	released := false
+	return func() {
+		diskLock.Lock()
+		defer diskLock.Unlock()
+		if !released {
+			diskReserved -= needed
+			released = true
+		}
+	}, nil
+}
+
+// Checks that all groups of a download job fit into the disk budget before any
+// of them is downloaded, so that a region is not left half installed. Groups
+// without a manifest are skipped, their size is only known once they are
+// downloaded and they are checked then.
+func CheckDiskBudget(ctx context.Context, sources []string, groups []GroupArea, concurrency int) error {
+	budget := DiskBudget()
+	if budget == 0 {
+		return nil
+	}
+	needed := int64(0)
+	transient := int64(0)
+	for _, group := range groups {
+		for _, source := range sources {
+			if ctx.Err() != nil {
+				return errors.Wrap(ctx.Err(), "disk budget check stopped")
+			}
+			manifest, err := FetchManifest(ctx, manifestName(downloadURL(source, group.Lat, group.Lon)))
+			if err != nil {
+				continue
+			}
+			installed, archive := groupSpace(group.String(), manifest)
+			needed += installed
+			if archive > transient {
+				transient = archive
+			}
+			break
+		}
+	}
+	// only the archives of the groups that are downloaded at once exist together
+	needed += transient * int64(concurrency)
+
+	diskLock.Lock()
+	defer diskLock.Unlock()
+	usage := projectedDiskUsage() + diskReserved
+	if usage+needed > budget {
+		return errors.Errorf("installing %d groups needs %d bytes, %d of the disk budget of %d bytes are used", len(groups), needed, usage, budget)
+	}
+	return nil
+}
+
+// The nation and state codes whose bounding boxes overlap each group
+func groupLocations() map[string][]string {
+	locations := map[string][]string{}
+	for _, boxes := range []map[string]LocationData{NATION_BOXES, STATE_BOXES} {
+		for code, location := range boxes {
+			for _, group := range boundsGroups(location.BoundingBox) {
+				locations[group.String()] = append(locations[group.String()], code)
+			}
+		}
+	}
+	return locations
+}
+
+// Lists the installed groups with the space they use
+func ReadInventory() Inventory {
+	registry, err := ReadRegistry()
+	logwe(err)
+	locations := groupLocations()
+	inventory := Inventory{Groups: []GroupInventory{}, DiskBudget: DiskBudget()}
+	for _, group := range InstalledGroupAreas() {
+		live, _, previous := groupDirs(group.String())
+		item := GroupInventory{Group: group.String(), Locations: locations[group.String()]}
+		item.Size, item.Files = dirSize(live)
+		item.PreviousSize, _ = dirSize(previous)
+		item.UnpackedSize, _ = dirSize(UnpackedTileName(live))
+		if installed, ok := registry[group.String()]; ok && len(installed.Fingerprint) > 0 {
+			generatedAt := installed.GeneratedAt
+			item.GeneratedAt = &generatedAt
+		}
+		if item.Locations == nil {
+			item.Locations = []string{}
+		}
+		sort.Strings(item.Locations)
+		inventory.Groups = append(inventory.Groups, item)
+		inventory.TotalSize += item.Size + item.PreviousSize + item.UnpackedSize
+	}
+	sort.Slice(inventory.Groups, func(i, j int) bool { return inventory.Groups[i].Group < inventory.Groups[j].Group })
+	return inventory
+}
+
+var inventoryVersion = int64(-1) // the GroupsVersion the inventory was written at
+
+var MAINTENANCE_INTERVAL = time.Second // how often rollback and delete requests are checked for
+
+// Handles rollback and delete requests and keeps the inventory up to date
+// next to the download worker, so that walking and renaming the offline
+// directories does not block matching. Returns when ctx is done.
+func RunMaintenance(ctx context.Context) {
+	ticker := time.NewTicker(MAINTENANCE_INTERVAL)
+	defer ticker.Stop()
+	for {
+		maintain()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func maintain() {
+	defer func() {
+		if err := recover(); err != nil {
+			loge(errors.Errorf("panic occured in maintenance worker: %v", err))
+		}
+	}()
+	RollbackIfTriggered()
+	DeleteIfTriggered()
+	WriteInventoryIfChanged()
+}
+
+// Writes the inventory when mapd starts and after groups were installed,
+// rolled back or deleted
+func WriteInventoryIfChanged() {
+	version := GroupsVersion()
+	if version == inventoryVersion {
+		return
+	}
+	data, err := json.Marshal(ReadInventory())
+	if err != nil {
+		logwe(errors.Wrap(err, "could not marshal inventory"))
+		return
+	}
+	err = PutParam(INSTALLED_GROUPS, data)
+	logwe(errors.Wrap(err, "could not write inventory"))
+	if err == nil {
+		inventoryVersion = version
+	}
+}
+
+// Removes the live, previous and unpacked versions of a group and forgets it
+// in the registry
+func DeleteGroup(group string) error {
+	groupsLock.Lock()
+	defer groupsLock.Unlock()
+	defer groupsVersion.Add(1)
+	live, _, previous := groupDirs(group)
+	for _, dir := range []string{live, previous, UnpackedTileName(live)} {
+		err := os.RemoveAll(dir)
+		if err != nil {
+			return errors.Wrap(err, "could not remove group directory")
+		}
+		// the latitude directory is only removed once its last group is gone
+		_ = os.Remove(filepath.Dir(dir))
+	}
+	err := updateRegistry(func(registry map[string]InstalledGroup) { delete(registry, group) })
+	if err != nil {
+		return errors.Wrap(err, "could not remove group from the registry")
+	}
+	log.Info().Str("group", group).Msg("Deleted group")
+	return nil
+}
+
+// Whether a live or previous version of a group is installed
+func groupInstalled(group string) bool {
+	live, _, previous := groupDirs(group)
+	_, liveErr := os.Stat(live)
+	_, previousErr := os.Stat(previous)
+	return liveErr == nil || previousErr == nil
+}
+
+// The groups that lie entirely inside bounds, groups on its border may belong
+// to a neighbour too
+func innerBoundsGroups(bounds Bounds) []GroupArea {
+	step := float64(GROUP_AREA_BOX_DEGREES)
+	minLat := int(math.Ceil(bounds.MinLat/step)) * GROUP_AREA_BOX_DEGREES
+	minLon := int(math.Ceil(bounds.MinLon/step)) * GROUP_AREA_BOX_DEGREES
+	maxLat := int(math.Floor(bounds.MaxLat/step)) * GROUP_AREA_BOX_DEGREES
+	maxLon := int(math.Floor(bounds.MaxLon/step)) * GROUP_AREA_BOX_DEGREES
+	groups := []GroupArea{}
+	for i := minLat; i+GROUP_AREA_BOX_DEGREES <= maxLat; i += GROUP_AREA_BOX_DEGREES {
+		for j := minLon; j+GROUP_AREA_BOX_DEGREES <= maxLon; j += GROUP_AREA_BOX_DEGREES {
+			groups = append(groups, GroupArea{Lat: i, Lon: j})
+		}
+	}
+	return groups
+}
+
+// The groups a location of a delete request removes
+func deleteBoundsGroups(name string, bounds Bounds) ([]GroupArea, []GroupArea, error) {
+	// the boxes of locations that cross the antimeridian span every longitude
+	if bounds.MaxLon-bounds.MinLon >= 360 {
+		return nil, nil, errors.Errorf("%s spans every longitude, delete its groups by name", name)
+	}
+	return innerBoundsGroups(bounds), boundsGroups(bounds), nil
+}
+
+// The outcome of a delete request
+type DeleteResult struct {
+	DeletedAt time.Time   `json:"deleted_at"`
+	Deleted   []string    `json:"deleted"`
+	Kept      []KeptGroup `json:"kept"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// An installed group of a deleted region that was kept
+type KeptGroup struct {
+	Group     string   `json:"group"`
+	Locations []string `json:"locations"` // the other locations the group was downloaded for, empty when it was not recorded
+}
+
+// Deletes the installed groups of a request. A group that lies entirely
+// inside a location or the bounds is deleted, a group on their border only
+// when it was downloaded for the deleted locations alone. Groups that another
+// location was downloaded for are kept, named groups are always deleted.
+func DeleteRegions(request DeleteRequest) (DeleteResult, error) {
+	result := DeleteResult{DeletedAt: time.Now().UTC(), Deleted: []string{}, Kept: []KeptGroup{}}
+	areas := []GroupArea{}
+	inner := map[string]bool{}
+	named := map[string]bool{}
+	requested := map[string]bool{}
+	add := func(name string, key string, bounds Bounds) error {
+		inside, all, err := deleteBoundsGroups(name, bounds)
+		for _, group := range inside {
+			inner[group.String()] = true
+		}
+		areas = append(areas, all...)
+		if len(key) > 0 {
+			requested[key] = true
+		}
+		return err
+	}
+	for _, code := range request.Nations {
+		location, ok := NATION_BOXES[code]
+		if !ok {
+			return result, errors.Errorf("no bounding box data for nation code: %s", code)
+		}
+		err := add("bounding box of nation "+code, LocationKey("nation", code), location.BoundingBox)
+		if err != nil {
+			return result, err
+		}
+	}
+	for _, code := range request.States {
+		location, ok := STATE_BOXES[code]
+		if !ok {
+			return result, errors.Errorf("no bounding box data for state code: %s", code)
+		}
+		err := add("bounding box of state "+code, LocationKey("state", code), location.BoundingBox)
+		if err != nil {
+			return result, err
+		}
+	}
+	if request.Bounds != nil {
+		err := add("bounds", "", *request.Bounds)
+		if err != nil {
+			return result, err
+		}
+	}
+	for _, name := range request.Groups {
+		group, err := ParseGroupArea(name)
+		if err != nil {
+			return result, err
+		}
+		named[name] = true
+		areas = append(areas, group)
+	}
+
+	registry, err := ReadRegistry()
+	if err != nil {
+		return result, err
+	}
+	seen := map[string]bool{}
+	kept := []string{}
+	for _, area := range areas {
+		group := area.String()
+		if seen[group] {
+			continue
+		}
+		seen[group] = true
+		if !groupInstalled(group) {
+			continue
+		}
+		recorded := registry[group].Locations
+		others := []string{}
+		for _, location := range recorded {
+			if !requested[location] {
+				others = append(others, location)
+			}
+		}
+		if !named[group] && (len(others) > 0 || (!inner[group] && len(recorded) == 0)) {
+			result.Kept = append(result.Kept, KeptGroup{Group: group, Locations: others})
+			kept = append(kept, group)
+			continue
+		}
+		err := DeleteGroup(group)
+		if err != nil {
+			return result, errors.Wrapf(err, "could not delete group %s", group)
+		}
+		result.Deleted = append(result.Deleted, group)
+	}
+	// the deleted locations no longer hold on to the kept groups
+	return result, errors.Wrap(forgetGroupLocations(kept, requested), "could not forget the deleted locations")
+}
+
+func DeleteIfTriggered() {
+	b, err := TakeParam(DELETE_REGIONS)
+	logwe(err)
+	if err != nil || len(b) == 0 {
+		return
+	}
+	var request DeleteRequest
+	result := DeleteResult{DeletedAt: time.Now().UTC(), Deleted: []string{}, Kept: []KeptGroup{}}
+	err = json.Unmarshal(b, &request)
+	if err != nil {
+		err = errors.Wrap(err, "could not unmarshal delete request")
+	} else {
+		result, err = DeleteRegions(request)
+	}
+	if err != nil {
+		logwe(err)
+		result.Error = err.Error()
+	}
+	log.Info().Strs("groups", result.Deleted).Int("kept", len(result.Kept)).Msgf("Deleted %d groups", len(result.Deleted))
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		logwe(errors.Wrap(err, "could not marshal delete result"))
+		return
+	}
+	logwe(errors.Wrap(PutParam(DELETE_RESULT, data), "could not write delete result"))
+}
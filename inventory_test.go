@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bradleyjkemp/cupaloy"
+)
+
+func TestInventoryAndDelete(t *testing.T) {
+	base := useTestDirs(t)
+	unpackedDir, budget, sources := UNPACKED_DIR, DISK_BUDGET, DOWNLOAD_SOURCES
+	defer func() { UNPACKED_DIR, DISK_BUDGET, DOWNLOAD_SOURCES = unpackedDir, budget, sources }()
+	UNPACKED_DIR = filepath.Join(base, "unpacked")
+	mirror := t.TempDir()
+	source, err := NormalizeSource(mirror)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generatedAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, name := range []string{
+		"offline/38/-76/38.000000_-76.000000_38.250000_-75.750000",
+		"offline/40/-76/40.000000_-76.000000_40.250000_-75.750000",
+		"offline/46/6/46.000000_6.000000_46.250000_6.250000",
+		// inside Germany, on the border to Poland and inside Poland
+		"offline/50/8/50.000000_8.000000_50.250000_8.250000",
+		"offline/52/14/52.000000_14.000000_52.250000_14.250000",
+		"offline/52/16/52.000000_16.000000_52.250000_16.250000",
+	} {
+		writeTestGroup(t, mirror, map[string]string{name: "tile " + name})
+		err = os.Chtimes(filepath.Join(mirror, name), generatedAt, generatedAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = WriteGroupManifests(mirror)
+	if err != nil {
+		t.Fatal(err)
+	}
+	DOWNLOAD_SOURCES = []string{source}
+
+	results := ""
+	inventory := func(step string) {
+		inventory := ReadInventory()
+		results += fmt.Sprintf("%s: total=%d budget=%d\n", step, inventory.TotalSize, inventory.DiskBudget)
+		for _, group := range inventory.Groups {
+			generated := "unrecorded"
+			if group.GeneratedAt != nil {
+				generated = group.GeneratedAt.Format(time.RFC3339)
+			}
+			results += fmt.Sprintf("  %s size=%d previous=%d unpacked=%d files=%d generated=%s locations=%d\n", group.Group, group.Size, group.PreviousSize, group.UnpackedSize, group.Files, generated, len(group.Locations))
+		}
+	}
+	download := func(lat int, lon int) {
+		downloaded, err := DownloadGroup(context.Background(), []string{source}, lat, lon)
+		results += fmt.Sprintf("download %d/%d: downloaded=%v err=%v\n", lat, lon, downloaded, err)
+	}
+
+	// a group needs space for its tiles, their unpacked cache and its archive
+	manifest, err := FetchManifest(context.Background(), manifestName(downloadURL(source, 38, -76)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	installed, archive := groupSpace("38/-76", manifest)
+	results += fmt.Sprintf("group needs: installed=%d archive=%d\n", installed, archive)
+	// the first group fits into the budget, the second does not once the first is unpacked
+	DISK_BUDGET = installed + archive + 100
+	download(38, -76)
+	download(40, -76)
+	// the replaced version of a group is kept as its previous version and counts too
+	download(38, -76)
+	// each group of the job fits on its own, but not both
+	DISK_BUDGET = 2 * (installed + archive)
+	jobErrors := RunDownloadJob(context.Background(), DownloadJob{Groups: []string{"40/-76", "46/6"}}, map[string]bool{})
+	results += fmt.Sprintf("job: %q\n", jobErrors)
+	DISK_BUDGET = 0
+	download(40, -76)
+	download(46, 6)
+	download(50, 8)
+	download(52, 14)
+	download(52, 16)
+	unpacked := UnpackedTileName(filepath.Join(BOUNDS_DIR, "38", "-76", "38.000000_-76.000000_38.250000_-75.750000"))
+	err = os.MkdirAll(filepath.Dir(unpacked), 0o775)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(unpacked, []byte("unpacked"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inventory("installed")
+	// the groups on the border of Germany and Poland were downloaded for both
+	completed := map[string]bool{"50/8": true, "52/14": true, "52/16": true}
+	for location, groups := range map[string][]GroupArea{
+		LocationKey("nation", "DE"): {{Lat: 50, Lon: 8}, {Lat: 52, Lon: 14}},
+		LocationKey("nation", "PL"): {{Lat: 52, Lon: 14}, {Lat: 52, Lon: 16}},
+	} {
+		err = RecordGroupLocation(groups, location, completed)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, request := range []DeleteRequest{
+		{Nations: []string{"XX"}},
+		{Nations: []string{"RU"}},
+		{Bounds: &Bounds{MinLat: 46, MinLon: -180, MaxLat: 48, MaxLon: 180}},
+		// the state is smaller than a group, so its groups are shared with its neighbours
+		{States: []string{"DE"}},
+		{Groups: []string{"38/-76"}},
+		{Nations: []string{"DE"}},
+		// Germany no longer holds on to the group it shares with Poland
+		{Nations: []string{"PL"}},
+		{Bounds: &Bounds{MinLat: 46, MinLon: 6, MaxLat: 48, MaxLon: 8}},
+	} {
+		result, err := DeleteRegions(request)
+		data, _ := json.Marshal(request)
+		results += fmt.Sprintf("delete %s: %q kept=%v err=%v\n", data, result.Deleted, result.Kept, err)
+	}
+	for _, dir := range []string{"offline/38/-76", "previous/38/-76", "unpacked/38/-76", "offline/46", "offline/50", "offline/52"} {
+		_, err := os.Stat(filepath.Join(base, dir))
+		results += fmt.Sprintf("%s exists: %v\n", dir, err == nil)
+	}
+	registry, err := ReadRegistry()
+	results += fmt.Sprintf("registry: %d groups err=%v\n", len(registry), err)
+	inventory("deleted")
+
+	cupaloy.SnapshotT(t, results)
+}
+
+func TestRunMaintenance(t *testing.T) {
+	base := useTestDirs(t)
+	params := filepath.Join(base, "params", "d")
+	rollback, deleteRegions, deleteResult, installedGroups, interval := DOWNLOAD_ROLLBACK, DELETE_REGIONS, DELETE_RESULT, INSTALLED_GROUPS, MAINTENANCE_INTERVAL
+	defer func() {
+		DOWNLOAD_ROLLBACK, DELETE_REGIONS, DELETE_RESULT, INSTALLED_GROUPS, MAINTENANCE_INTERVAL = rollback, deleteRegions, deleteResult, installedGroups, interval
+	}()
+	DELETE_RESULT = filepath.Join(params, "OSMDeleteResult")
+	DOWNLOAD_ROLLBACK = filepath.Join(params, "OSMDownloadRollback")
+	DELETE_REGIONS = filepath.Join(params, "OSMDeleteRegions")
+	INSTALLED_GROUPS = filepath.Join(params, "OSMInstalledGroups")
+	MAINTENANCE_INTERVAL = 10 * time.Millisecond
+	err := os.MkdirAll(params, 0o775)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, content := range []string{"release 1", "release 2"} {
+		source := t.TempDir()
+		archivePath := writeTestGroup(t, source, map[string]string{"offline/38/-76/38.000000_-76.000000_38.250000_-75.750000": content})
+		manifest, err := NewGroupManifest(source, "offline/38/-76")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = InstallGroup(archivePath, "38/-76", manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		RunMaintenance(ctx)
+		close(stopped)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+	results := ""
+	waitFor := func(step string, done func() bool) {
+		deadline := time.Now().Add(10 * time.Second)
+		for !done() && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		tile, _ := os.ReadFile(filepath.Join(BOUNDS_DIR, "38", "-76", "38.000000_-76.000000_38.250000_-75.750000"))
+		results += fmt.Sprintf("%s: done=%v tile=%q\n", step, done(), tile)
+	}
+	tileIs := func(content string) func() bool {
+		return func() bool {
+			tile, _ := os.ReadFile(filepath.Join(BOUNDS_DIR, "38", "-76", "38.000000_-76.000000_38.250000_-75.750000"))
+			return string(tile) == content
+		}
+	}
+
+	waitFor("inventory", func() bool {
+		_, err := os.Stat(INSTALLED_GROUPS)
+		return err == nil
+	})
+	err = PutParam(DOWNLOAD_ROLLBACK, []byte(`{"groups": ["38/-76"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor("rollback", tileIs("release 1"))
+	err = PutParam(DELETE_REGIONS, []byte(`{"groups": ["38/-76"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor("delete", tileIs(""))
+	var result DeleteResult
+	waitFor("delete result", func() bool {
+		data, err := os.ReadFile(DELETE_RESULT)
+		return err == nil && json.Unmarshal(data, &result) == nil
+	})
+	results += fmt.Sprintf("deleted: %q kept: %v error: %q\n", result.Deleted, result.Kept, result.Error)
+	waitFor("inventory after delete", func() bool {
+		inventory, err := os.ReadFile(INSTALLED_GROUPS)
+		return err == nil && strings.Contains(string(inventory), `"groups":[]`)
+	})
+
+	cupaloy.SnapshotT(t, results)
+}
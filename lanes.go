@@ -0,0 +1,255 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var EXIT_LOOKAHEAD = float64(MIN_WAY_DIST) // meters. how far along the predicted path to report exits
+
+// The lanes of one direction of a way. Lane lists are ordered from left to
+// right in the direction of travel.
+type TmpLanes struct {
+	Count          uint8
+	Turn           []string
+	Change         []string
+	MaxSpeeds      []float64
+	Destination    string
+	DestinationRef string
+}
+
+type LaneLayout struct {
+	Count          uint8     `json:"count"`
+	Turn           []string  `json:"turn"`
+	Change         []string  `json:"change"`
+	MaxSpeeds      []float64 `json:"maxspeeds"`
+	Destination    string    `json:"destination"`
+	DestinationRef string    `json:"destination_ref"`
+}
+
+type PathExit struct {
+	Ref            string  `json:"ref"`
+	Destination    string  `json:"destination"`
+	DestinationRef string  `json:"destination_ref"`
+	Latitude       float64 `json:"latitude"`
+	Longitude      float64 `json:"longitude"`
+	Distance       float64 `json:"distance"`
+	WayId          uint64  `json:"way_id"`
+}
+
+// Splits a *:lanes value into its lanes, empty values become none
+func ParseLaneValues(value string) []string {
+	if len(value) == 0 {
+		return []string{}
+	}
+	lanes := strings.Split(value, "|")
+	for i, lane := range lanes {
+		lanes[i] = strings.TrimSpace(lane)
+		if len(lanes[i]) == 0 {
+			lanes[i] = "none"
+		}
+	}
+	return lanes
+}
+
+// Reads the lane tags with the given suffix such as :forward, falling back to
+// the tags without a suffix if fallback is set
+func ParseLanes(tags map[string]string, suffix string, fallback bool) TmpLanes {
+	find := func(key string) string {
+		if v, ok := tags[key+suffix]; ok || !fallback {
+			return v
+		}
+		return tags[key]
+	}
+
+	lanes := TmpLanes{
+		Turn:           ParseLaneValues(find("turn:lanes")),
+		Change:         ParseLaneValues(find("change:lanes")),
+		MaxSpeeds:      []float64{},
+		Destination:    find("destination"),
+		DestinationRef: find("destination:ref"),
+	}
+	for _, maxSpeed := range ParseLaneValues(find("maxspeed:lanes")) {
+		lanes.MaxSpeeds = append(lanes.MaxSpeeds, ParseMaxSpeed(maxSpeed))
+	}
+	count, _ := strconv.ParseUint(find("lanes"), 10, 8)
+	lanes.Count = uint8(count)
+	for _, list := range []int{len(lanes.Turn), len(lanes.Change), len(lanes.MaxSpeeds)} {
+		if lanes.Count == 0 && list > 0 && list < 256 {
+			lanes.Count = uint8(list)
+		}
+	}
+	return lanes
+}
+
+// Lanes of both directions of a way. The tags without a suffix describe the
+// forward direction of oneway ways, two way roads need :forward and :backward.
+func NewWayLanes(tags map[string]string, oneWay bool) (TmpLanes, TmpLanes) {
+	if oneWay {
+		return ParseLanes(tags, ":forward", true), TmpLanes{}
+	}
+	return ParseLanes(tags, ":forward", false), ParseLanes(tags, ":backward", false)
+}
+
+func SetLanes(l Lanes, lanes TmpLanes) error {
+	l.SetCount(lanes.Count)
+	turn, err := l.NewTurn(int32(len(lanes.Turn)))
+	if err != nil {
+		return errors.Wrap(err, "could not create turn lanes")
+	}
+	for i, v := range lanes.Turn {
+		err = turn.Set(i, v)
+		if err != nil {
+			return errors.Wrap(err, "could not set turn lane")
+		}
+	}
+	change, err := l.NewChange(int32(len(lanes.Change)))
+	if err != nil {
+		return errors.Wrap(err, "could not create change lanes")
+	}
+	for i, v := range lanes.Change {
+		err = change.Set(i, v)
+		if err != nil {
+			return errors.Wrap(err, "could not set change lane")
+		}
+	}
+	maxSpeeds, err := l.NewMaxSpeeds(int32(len(lanes.MaxSpeeds)))
+	if err != nil {
+		return errors.Wrap(err, "could not create lane max speeds")
+	}
+	for i, v := range lanes.MaxSpeeds {
+		maxSpeeds.Set(i, v)
+	}
+	err = l.SetDestination(lanes.Destination)
+	if err != nil {
+		return errors.Wrap(err, "could not set lane destination")
+	}
+	return errors.Wrap(l.SetDestinationRef(lanes.DestinationRef), "could not set lane destination ref")
+}
+
+func ReadLanes(l Lanes) (TmpLanes, error) {
+	lanes := TmpLanes{Count: l.Count(), Turn: []string{}, Change: []string{}, MaxSpeeds: []float64{}}
+	turn, err := l.Turn()
+	if err != nil {
+		return lanes, errors.Wrap(err, "could not read turn lanes")
+	}
+	for i := 0; i < turn.Len(); i++ {
+		v, _ := turn.At(i)
+		lanes.Turn = append(lanes.Turn, v)
+	}
+	change, err := l.Change()
+	if err != nil {
+		return lanes, errors.Wrap(err, "could not read change lanes")
+	}
+	for i := 0; i < change.Len(); i++ {
+		v, _ := change.At(i)
+		lanes.Change = append(lanes.Change, v)
+	}
+	maxSpeeds, err := l.MaxSpeeds()
+	if err != nil {
+		return lanes, errors.Wrap(err, "could not read lane max speeds")
+	}
+	for i := 0; i < maxSpeeds.Len(); i++ {
+		lanes.MaxSpeeds = append(lanes.MaxSpeeds, maxSpeeds.At(i))
+	}
+	lanes.Destination, _ = l.Destination()
+	lanes.DestinationRef, _ = l.DestinationRef()
+	return lanes, nil
+}
+
+// Lanes of a way in the direction of travel
+func WayLanes(way Way, isForward bool) (TmpLanes, error) {
+	var l Lanes
+	var err error
+	if isForward {
+		l, err = way.LanesForward()
+	} else {
+		l, err = way.LanesBackward()
+	}
+	if err != nil {
+		return TmpLanes{}, errors.Wrap(err, "could not read way lanes")
+	}
+	return ReadLanes(l)
+}
+
+// The lane layout of the current way in the direction of travel. The lane
+// count falls back to the total lanes of oneway ways.
+func GetLaneLayout(currentWay CurrentWay) (LaneLayout, error) {
+	lanes, err := WayLanes(currentWay.Way, currentWay.OnWay.IsForward)
+	if err != nil {
+		return LaneLayout{}, err
+	}
+	if lanes.Count == 0 && currentWay.Way.OneWay() {
+		lanes.Count = currentWay.Way.Lanes()
+	}
+	return LaneLayout{
+		Count:          lanes.Count,
+		Turn:           lanes.Turn,
+		Change:         lanes.Change,
+		MaxSpeeds:      lanes.MaxSpeeds,
+		Destination:    lanes.Destination,
+		DestinationRef: lanes.DestinationRef,
+	}, nil
+}
+
+// Lists the motorway junctions along the predicted path within EXIT_LOOKAHEAD,
+// nearest first, with the destination of the way leaving the path there
+func GetPathExits(pos Position, currentWay CurrentWay, nextWays []NextWayResult, offline Offline) ([]PathExit, error) {
+	pathWays := map[int64]bool{currentWay.Way.Id(): true}
+	for _, nextWay := range nextWays {
+		pathWays[nextWay.Way.Id()] = true
+	}
+
+	var err error
+	exits := []PathExit{}
+	WalkPathNodes(pos, currentWay, nextWays, func(way Way, index int, distance float64) {
+		if distance > EXIT_LOOKAHEAD || !way.HasFeatures() {
+			return
+		}
+		features, e := way.Features()
+		if e != nil {
+			err = errors.Wrap(e, "could not read way features")
+			return
+		}
+		for i := 0; i < features.Len(); i++ {
+			feature := features.At(i)
+			if feature.Type() != FeatureType_motorwayJunction || int(feature.NodeIndex()) != index {
+				continue
+			}
+			nodes, e := way.Nodes()
+			if e != nil {
+				err = errors.Wrap(e, "could not read way nodes")
+				return
+			}
+			node := nodes.At(index)
+			ref, _ := feature.Value()
+			exit := PathExit{Ref: ref, Latitude: node.Latitude(), Longitude: node.Longitude(), Distance: distance}
+
+			matchingWays, e := MatchingWays(way, offline, node)
+			if e != nil {
+				err = errors.Wrap(e, "could not find exit ways")
+				return
+			}
+			for _, mWay := range matchingWays {
+				isForward := NextIsForward(mWay, node)
+				if pathWays[mWay.Id()] || (!isForward && mWay.OneWay()) {
+					continue
+				}
+				lanes, e := WayLanes(mWay, isForward)
+				if e != nil {
+					err = e
+					return
+				}
+				if exit.WayId == 0 || len(exit.Destination)+len(exit.DestinationRef) == 0 {
+					exit.WayId = uint64(mWay.Id())
+					exit.Destination = lanes.Destination
+					exit.DestinationRef = lanes.DestinationRef
+				}
+			}
+			exits = append(exits, exit)
+		}
+	})
+	return exits, err
+}
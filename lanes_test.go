@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bradleyjkemp/cupaloy"
+)
+
+func TestNewWayLanes(t *testing.T) {
+	results := ""
+	for _, test := range []struct {
+		tags   map[string]string
+		oneWay bool
+	}{
+		{map[string]string{"lanes": "3", "turn:lanes": "left||through;right", "destination": "Dover", "destination:ref": "US 13"}, true},
+		{map[string]string{"turn:lanes:forward": "left|through", "turn:lanes:backward": "through", "maxspeed:lanes:forward": "50 mph|none"}, false},
+		{map[string]string{"lanes": "2", "turn:lanes": "left|through"}, false},
+	} {
+		forward, backward := NewWayLanes(test.tags, test.oneWay)
+		results += fmt.Sprintf("forward=%+v backward=%+v\n", forward, backward)
+	}
+
+	cupaloy.SnapshotT(t, results)
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	MANIFEST_SUFFIX   = ".manifest.json"
+	MANIFEST_TIMEOUT  = 30 * time.Second // how long fetching the manifest of a group may take
+	MAX_MANIFEST_SIZE = int64(1 << 20)   // bytes
+)
+
+// The source publishes no manifest for a group
+var ErrNoManifest = errors.New("source has no manifest")
+
+// Whether groups from sources without manifests are skipped instead of being
+// installed unverified, set with the persistent OSMRequireManifests param
+func RequireManifests() bool {
+	required, err := GetParam(REQUIRE_MANIFESTS_PERSIST)
+	return err == nil && strings.TrimSpace(string(required)) == "1"
+}
+
+type ManifestFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Describes the offline data of a 2x2 degree group. It is published next to
+// the group's tar.gz so that downloads can be checked before they go live.
+type GroupManifest struct {
+	GeneratedAt time.Time      `json:"generated_at"`
+	Archive     ManifestFile   `json:"archive"`
+	Files       []ManifestFile `json:"files"`
+}
+
+func hashFile(path string) (ManifestFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return ManifestFile{}, errors.Wrap(err, "could not open file to hash")
+	}
+	defer f.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return ManifestFile{}, errors.Wrap(err, "could not hash file")
+	}
+	return ManifestFile{Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// Builds the manifest of a group directory such as offline/38/-76 under base.
+// File names are relative to base, the same as in the group's tar.gz.
+func NewGroupManifest(base string, groupDir string) (GroupManifest, error) {
+	manifest := GroupManifest{Files: []ManifestFile{}}
+	err := filepath.WalkDir(filepath.Join(base, groupDir), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		file, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		file.Name, err = filepath.Rel(base, path)
+		if err != nil {
+			return errors.Wrap(err, "could not get manifest file name")
+		}
+		file.Name = filepath.ToSlash(file.Name)
+		info, err := d.Info()
+		if err != nil {
+			return errors.Wrap(err, "could not stat manifest file")
+		}
+		if info.ModTime().After(manifest.GeneratedAt) {
+			manifest.GeneratedAt = info.ModTime().UTC()
+		}
+		manifest.Files = append(manifest.Files, file)
+		return nil
+	})
+	if err != nil {
+		return manifest, errors.Wrap(err, "could not list group files")
+	}
+	sort.Slice(manifest.Files, func(i, j int) bool { return manifest.Files[i].Name < manifest.Files[j].Name })
+
+	archivePath := filepath.Join(base, groupDir+".tar.gz")
+	if _, err := os.Stat(archivePath); err == nil {
+		manifest.Archive, err = hashFile(archivePath)
+		if err != nil {
+			return manifest, err
+		}
+		manifest.Archive.Name = filepath.ToSlash(groupDir + ".tar.gz")
+	}
+	return manifest, nil
+}
+
+// Writes a manifest next to every group directory of offline/<lat>/<lon> under base
+func WriteGroupManifests(base string) error {
+	groupDirs, err := filepath.Glob(filepath.Join(base, "offline", "*", "*"))
+	if err != nil {
+		return errors.Wrap(err, "could not list group directories")
+	}
+	for _, groupPath := range groupDirs {
+		if info, err := os.Stat(groupPath); err != nil || !info.IsDir() {
+			continue
+		}
+		groupDir, err := filepath.Rel(base, groupPath)
+		if err != nil {
+			return errors.Wrap(err, "could not get group directory name")
+		}
+		manifest, err := NewGroupManifest(base, groupDir)
+		if err != nil {
+			return errors.Wrapf(err, "could not create manifest of %s", groupDir)
+		}
+		data, err := json.MarshalIndent(manifest, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "could not marshal manifest")
+		}
+		err = os.WriteFile(groupPath+MANIFEST_SUFFIX, data, 0o644)
+		if err != nil {
+			return errors.Wrap(err, "could not write manifest")
+		}
+		log.Info().Str("group", groupDir).Int("files", len(manifest.Files)).Msg("Wrote manifest")
+	}
+	return nil
+}
+
+func FetchManifest(ctx context.Context, url string) (GroupManifest, error) {
+	manifest := GroupManifest{}
+	ctx, cancel := context.WithTimeout(ctx, MANIFEST_TIMEOUT)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return manifest, errors.Wrap(err, "could not create manifest request")
+	}
+	client, err := sourceClient(url)
+	if err != nil {
+		return manifest, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return manifest, errors.Wrap(err, "could not download manifest")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return manifest, errors.Wrapf(ErrNoManifest, "manifest download received bad status: %s", resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return manifest, errors.Errorf("manifest download received bad status: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MAX_MANIFEST_SIZE))
+	if err != nil {
+		return manifest, errors.Wrap(err, "could not read manifest")
+	}
+	err = json.Unmarshal(data, &manifest)
+	return manifest, errors.Wrap(err, "could not unmarshal manifest")
+}
+
+// Checks a downloaded group archive and every file in it against the
+// manifest. Nothing is extracted, so the installed tiles stay untouched when
+// the archive is corrupt.
+func VerifyArchive(path string, manifest GroupManifest) error {
+	if len(manifest.Archive.SHA256) > 0 {
+		archive, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		if archive.Size != manifest.Archive.Size || archive.SHA256 != manifest.Archive.SHA256 {
+			return errors.Errorf("archive has %d bytes with sha256 %s, manifest expects %d bytes with sha256 %s", archive.Size, archive.SHA256, manifest.Archive.Size, manifest.Archive.SHA256)
+		}
+	}
+
+	expected := map[string]ManifestFile{}
+	for _, file := range manifest.Files {
+		expected[file.Name] = file
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "could not open archive")
+	}
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return errors.Wrap(err, "could not read archive gzip")
+	}
+	defer reader.Close()
+	tr := tar.NewReader(reader)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "could not read archive")
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := strings.TrimPrefix(filepath.ToSlash(filepath.Clean(header.Name)), "./")
+		want, ok := expected[name]
+		if !ok {
+			return errors.Errorf("archive file %s is not in the manifest", name)
+		}
+		hash := sha256.New()
+		size, err := io.Copy(hash, tr)
+		if err != nil {
+			return errors.Wrapf(err, "could not read archive file %s", name)
+		}
+		if sum := hex.EncodeToString(hash.Sum(nil)); size != want.Size || sum != want.SHA256 {
+			return errors.Errorf("archive file %s has %d bytes with sha256 %s, manifest expects %d bytes with sha256 %s", name, size, sum, want.Size, want.SHA256)
+		}
+		delete(expected, name)
+	}
+	if len(expected) > 0 {
+		missing := []string{}
+		for name := range expected {
+			missing = append(missing, name)
+		}
+		sort.Strings(missing)
+		return errors.Errorf("archive is missing %d files of the manifest: %s", len(missing), strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// Builds the manifest of a downloaded archive from the files in it, for
+// sources that publish no manifest. It only makes sure that the extracted
+// tiles are the ones that were downloaded.
+func ArchiveManifest(path string) (GroupManifest, error) {
+	manifest := GroupManifest{Files: []ManifestFile{}}
+	archive, err := hashFile(path)
+	if err != nil {
+		return manifest, err
+	}
+	manifest.Archive = archive
+	file, err := os.Open(path)
+	if err != nil {
+		return manifest, errors.Wrap(err, "could not open archive")
+	}
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return manifest, errors.Wrap(err, "could not read archive gzip")
+	}
+	defer reader.Close()
+	tr := tar.NewReader(reader)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return manifest, errors.Wrap(err, "could not read archive")
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := strings.TrimPrefix(filepath.ToSlash(filepath.Clean(header.Name)), "./")
+		hash := sha256.New()
+		size, err := io.Copy(hash, tr)
+		if err != nil {
+			return manifest, errors.Wrapf(err, "could not read archive file %s", name)
+		}
+		manifest.Files = append(manifest.Files, ManifestFile{Name: name, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))})
+		if header.ModTime.After(manifest.GeneratedAt) {
+			manifest.GeneratedAt = header.ModTime.UTC()
+		}
+	}
+	sort.Slice(manifest.Files, func(i, j int) bool { return manifest.Files[i].Name < manifest.Files[j].Name })
+	return manifest, nil
+}
+
+func manifestName(archiveName string) string {
+	return fmt.Sprintf("%s%s", strings.TrimSuffix(archiveName, ".tar.gz"), MANIFEST_SUFFIX)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bradleyjkemp/cupaloy"
+)
+
+// Writes a group like scripts/compress_offline.sh does, all files must be in
+// the same offline/<lat>/<lon> group
+func writeTestGroup(t *testing.T, base string, files map[string]string) string {
+	archivePath := ""
+	for name := range files {
+		archivePath = filepath.Join(base, strings.Join(strings.SplitN(name, "/", 4)[:3], "/")+".tar.gz")
+	}
+	err := os.MkdirAll(filepath.Dir(archivePath), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+	gz := gzip.NewWriter(archive)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		path := filepath.Join(base, name)
+		err = os.MkdirAll(filepath.Dir(path), 0o755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, []byte(content), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(content))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = tw.Write([]byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return archivePath
+}
+
+func TestVerifyArchive(t *testing.T) {
+	base := t.TempDir()
+	archivePath := writeTestGroup(t, base, map[string]string{
+		"offline/38/-76/38.00/-76.00": "tile a",
+		"offline/38/-76/38.25/-76.00": "tile b",
+	})
+	manifest, err := NewGroupManifest(base, "offline/38/-76")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := fmt.Sprintf("archive=%s files=%d\n", manifest.Archive.Name, len(manifest.Files))
+	results += fmt.Sprintf("valid: %v\n", VerifyArchive(archivePath, manifest))
+
+	// a tile that changed after the manifest was written
+	changed := manifest
+	changed.Archive = ManifestFile{}
+	changed.Files = append([]ManifestFile{}, manifest.Files...)
+	changed.Files[0].SHA256 = "0000"
+	results += fmt.Sprintf("changed tile: %v\n", VerifyArchive(archivePath, changed) != nil)
+
+	// a tile listed in the manifest but missing from the archive
+	missing := changed
+	missing.Files = append(append([]ManifestFile{}, manifest.Files...), ManifestFile{Name: "offline/38/-76/38.50/-76.00"})
+	results += fmt.Sprintf("missing tile: %v\n", VerifyArchive(archivePath, missing))
+
+	// a truncated download
+	info, err := os.Stat(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Truncate(archivePath, info.Size()/2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results += fmt.Sprintf("truncated: %v\n", VerifyArchive(archivePath, manifest) != nil)
+
+	cupaloy.SnapshotT(t, results)
+}
@@ -1,12 +1,12 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"os"
 	"time"
 
-	"capnproto.org/go/capnp/v3"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -14,10 +14,55 @@ import (
 )
 
 type State struct {
-	Data       []uint8
-	CurrentWay CurrentWay
-	NextWays   []NextWayResult
-	Position   Position
+	Tile         *OfflineTile
+	RetiredTiles []*OfflineTile // replaced tiles that the current or next ways may still be read from
+	CurrentWay   CurrentWay
+	NextWays     []NextWayResult
+	Position     Position
+	Reckoning    DeadReckoning
+	Updates      UpdateScheduler
+	TileVersion  int64 // the GroupsVersion the tile was loaded at
+}
+
+// The offline data of the current tile, empty if no tile is loaded
+func (s *State) Offline() Offline {
+	if s.Tile == nil {
+		return Offline{}
+	}
+	return s.Tile.Offline
+}
+
+// Replaces the current tile. The old tile stays mapped until ReleaseTiles
+// finds that no way of the state is read from it anymore.
+func (s *State) SetTile(tile *OfflineTile) {
+	if s.Tile != nil {
+		s.RetiredTiles = append(s.RetiredTiles, s.Tile)
+	}
+	s.Tile = tile
+}
+
+// The speed cameras of the current tile, nil if no tile is loaded
+func (s *State) SpeedCameras() *SpeedCameraIndex {
+	if s.Tile == nil {
+		return nil
+	}
+	return s.Tile.Cameras
+}
+
+func (s *State) ReleaseTiles() {
+	kept := []*OfflineTile{}
+	for _, tile := range s.RetiredTiles {
+		used := tile.Contains(s.CurrentWay.Way)
+		for _, nextWay := range s.NextWays {
+			used = used || tile.Contains(nextWay.Way)
+		}
+		if used {
+			kept = append(kept, tile)
+			continue
+		}
+		logde(tile.Close())
+	}
+	s.RetiredTiles = kept
 }
 
 type Position struct {
@@ -65,17 +110,6 @@ func RoadName(way Way) string {
 	return ""
 }
 
-func readOffline(data []uint8) Offline {
-	msg, err := capnp.UnmarshalPacked(data)
-	logde(errors.Wrap(err, "could not unmarshal offline data"))
-	if err == nil {
-		offline, err := ReadRootOffline(msg)
-		logde(errors.Wrap(err, "could not read offline message"))
-		return offline
-	}
-	return Offline{}
-}
-
 func readPosition(persistent bool) (Position, error) {
 	path := LAST_GPS_POSITION
 	if persistent {
@@ -97,11 +131,13 @@ func loop(state *State) {
 			e := errors.Errorf("panic occured: %v", err)
 			loge(e)
 			// reset state for next loop
-			state.Data = []uint8{}
+			state.SetTile(nil)
 			state.NextWays = []NextWayResult{}
 			state.CurrentWay = CurrentWay{}
 			state.Position = Position{}
+			state.Reckoning = DeadReckoning{}
 		}
+		state.ReleaseTiles()
 	}()
 
 	logLevelData, err := GetParam(MAPD_LOG_LEVEL)
@@ -139,24 +175,33 @@ func loop(state *State) {
 		logwe(errors.Wrap(err, "could not read current position"))
 		return
 	}
-	offline := readOffline(state.Data)
+	pos = state.Reckoning.Update(pos, time.Now(), state.CurrentWay, state.NextWays)
+	state.Updates.Update(pos, time.Now())
+	offline := state.Offline()
 
 	// ------------- Find current and next ways ------------
 
-	if !PointInBox(pos.Latitude, pos.Longitude, offline.MinLat(), offline.MinLon(), offline.MaxLat(), offline.MaxLon()) {
-		state.Data, err = FindWaysAroundLocation(pos.Latitude, pos.Longitude)
+	// groups installed by the download worker are picked up by reloading the tile
+	version := GroupsVersion()
+	if version != state.TileVersion || !PointInBox(pos.Latitude, pos.Longitude, offline.MinLat(), offline.MinLon(), offline.MaxLat(), offline.MaxLon()) {
+		tile, err := FindTileAroundLocation(pos.Latitude, pos.Longitude)
 		logde(errors.Wrap(err, "could not find ways around current location"))
+		state.SetTile(tile)
+		state.TileVersion = version
+		offline = state.Offline()
 	}
 
 	state.CurrentWay, err = GetCurrentWay(state.CurrentWay, state.NextWays, offline, pos)
 	logde(errors.Wrap(err, "could not get current way"))
 
-	state.NextWays, err = NextWays(pos, state.CurrentWay, offline, state.CurrentWay.OnWay.IsForward)
+	state.NextWays, err = NextWays(pos, state.CurrentWay, state.NextWays, offline, state.CurrentWay.OnWay.IsForward)
 	logde(errors.Wrap(err, "could not get next way"))
 
 	curvatures, err := GetStateCurvatures(state)
 	logde(errors.Wrap(err, "could not get curvatures from current state"))
-	target_velocities := GetTargetVelocities(curvatures)
+	grades, err := GetStateGrades(state)
+	logde(errors.Wrap(err, "could not get grades from current state"))
+	target_velocities := GetTargetVelocities(curvatures, grades, GetStateSurfaceScales(state))
 
 	// -----------------  Write data ---------------------
 
@@ -166,6 +211,11 @@ func loop(state *State) {
 	err = PutParam(MAP_CURVATURES, data)
 	logwe(errors.Wrap(err, "could not write curvatures"))
 
+	data, err = json.Marshal(grades)
+	logde(errors.Wrap(err, "could not marshal grades"))
+	err = PutParam(MAP_GRADES, data)
+	logwe(errors.Wrap(err, "could not write grades"))
+
 	data, err = json.Marshal(target_velocities)
 	logde(errors.Wrap(err, "could not marshal target velocities"))
 	err = PutParam(MAP_TARGET_VELOCITIES, data)
@@ -211,8 +261,53 @@ func loop(state *State) {
 	err = PutParam(MAP_ADVISORY_LIMIT, data)
 	logwe(errors.Wrap(err, "could not write advisory speed limit"))
 
+	data, err = json.Marshal(GetRoadAttributes(state.CurrentWay.Way, state.Reckoning.Active))
+	logde(errors.Wrap(err, "could not marshal road attributes"))
+	err = PutParam(MAP_ROAD_ATTRIBUTES, data)
+	logwe(errors.Wrap(err, "could not write road attributes"))
+
 	// ---------------- Next Data ---------------------
 
+	features, err := GetPathFeatures(pos, state.CurrentWay, state.NextWays)
+	logde(errors.Wrap(err, "could not get features along path"))
+	data, err = json.Marshal(features)
+	logde(errors.Wrap(err, "could not marshal features"))
+	err = PutParam(MAP_FEATURES, data)
+	logwe(errors.Wrap(err, "could not write features"))
+
+	hazards, err := GetPathHazards(pos, state.CurrentWay, state.NextWays)
+	logde(errors.Wrap(err, "could not get hazards along path"))
+	data, err = json.Marshal(hazards)
+	logde(errors.Wrap(err, "could not marshal hazards"))
+	err = PutParam(MAP_HAZARDS, data)
+	logwe(errors.Wrap(err, "could not write hazards"))
+
+	lanes, err := GetLaneLayout(state.CurrentWay)
+	logde(errors.Wrap(err, "could not get lane layout"))
+	data, err = json.Marshal(lanes)
+	logde(errors.Wrap(err, "could not marshal lane layout"))
+	err = PutParam(MAP_LANES, data)
+	logwe(errors.Wrap(err, "could not write lane layout"))
+
+	exits, err := GetPathExits(pos, state.CurrentWay, state.NextWays, offline)
+	logde(errors.Wrap(err, "could not get exits along path"))
+	data, err = json.Marshal(exits)
+	logde(errors.Wrap(err, "could not marshal exits"))
+	err = PutParam(MAP_EXITS, data)
+	logwe(errors.Wrap(err, "could not write exits"))
+
+	camera, err := GetNextSpeedCamera(pos, state.CurrentWay, state.NextWays, state.SpeedCameras())
+	logde(errors.Wrap(err, "could not get next speed camera"))
+	data, err = json.Marshal(camera)
+	logde(errors.Wrap(err, "could not marshal next speed camera"))
+	err = PutParam(NEXT_SPEED_CAMERA, data)
+	logwe(errors.Wrap(err, "could not write next speed camera"))
+
+	data, err = json.Marshal(GetRoundabout(state.CurrentWay, state.NextWays))
+	logde(errors.Wrap(err, "could not marshal roundabout"))
+	err = PutParam(MAP_ROUNDABOUT, data)
+	logwe(errors.Wrap(err, "could not write roundabout"))
+
 	if len(state.NextWays) > 0 {
 		hazard, err = state.NextWays[0].Way.Hazard()
 		logde(errors.Wrap(err, "could not read next hazard"))
@@ -309,20 +404,67 @@ func main() {
 	maxGenLatPtr := flag.Int("maxlat", -90, "the maximum latitude to generate")
 	maxGenLonPtr := flag.Int("maxlon", -180, "the maximum longitude to generate")
 	generateEmptyFiles := flag.Bool("generate-empty-files", false, "Includes empty files when generating map")
+	demDirPtr := flag.String("dem", "", "directory of SRTM .hgt or GeoTIFF elevation files to sample node elevations from")
+	inputPtr := flag.String("input", "./map.osm.pbf", "the pbf file to generate map data from")
+	highwaysPtr := flag.String("highways", "", "comma separated highway values to generate, all ways are generated when empty")
+	bboxPtr := flag.String("bbox", "", "only generate ways with a node inside minLon,minLat,maxLon,maxLat")
+	polygonPtr := flag.String("polygon", "", "only generate ways with a node inside the polygons of a GeoJSON file")
+	stateDirPtr := flag.String("state-dir", "", "directory to keep the generation state in so that osm changes can be applied later")
+	applyChangesPtr := flag.String("apply-changes", "", "applies an osmChange (.osc or .osc.gz) file to the generation state in -state-dir and rewrites the affected areas")
+	sequencePtr := flag.Int64("sequence", 0, "the osm replication sequence number of the input or change file")
+	quantizePtr := flag.Bool("quantize", false, "stores node coordinates as 1e-7 degree deltas to make offline files smaller")
+	reportPtr := flag.String("report", "./generate_report.json", "path to write the JSON generation report to, empty to skip it")
+	downloadSourcesPtr := flag.String("download-sources", "", "comma separated map data sources tried in order, http(s) or file:// urls or local directories that hold the offline directory")
+	writeManifestsPtr := flag.Bool("write-manifests", false, "writes a checksum manifest next to every 2 degree group in the offline directory, run it after compressing the groups")
 	flag.Parse()
+	if len(*downloadSourcesPtr) > 0 {
+		sources, err := ParseSources([]byte(*downloadSourcesPtr))
+		check(errors.Wrap(err, "could not parse download sources"))
+		for _, source := range sources {
+			_, err = NormalizeSource(source)
+			check(errors.Wrap(err, "invalid download source"))
+		}
+		DOWNLOAD_SOURCES = sources
+	}
+	if *writeManifestsPtr {
+		check(errors.Wrap(WriteGroupManifests(GetBaseOpPath()), "could not write manifests"))
+		return
+	}
+	if len(*applyChangesPtr) > 0 {
+		ApplyChanges(*stateDirPtr, *applyChangesPtr, *sequencePtr, *reportPtr)
+		return
+	}
 	if *generatePtr {
-		GenerateOffline(*minGenLatPtr, *minGenLonPtr, *maxGenLatPtr, *maxGenLonPtr, *generateEmptyFiles)
+		filter, err := NewWayFilter(*highwaysPtr, *bboxPtr, *polygonPtr)
+		check(errors.Wrap(err, "could not create generation filter"))
+		GenerateOffline(GenerateOptions{
+			Input:              *inputPtr,
+			MinLat:             *minGenLatPtr,
+			MinLon:             *minGenLonPtr,
+			MaxLat:             *maxGenLatPtr,
+			MaxLon:             *maxGenLonPtr,
+			GenerateEmptyFiles: *generateEmptyFiles,
+			DEMDir:             *demDirPtr,
+			Filter:             filter,
+			StateDir:           *stateDirPtr,
+			Sequence:           *sequencePtr,
+			Report:             *reportPtr,
+			Quantize:           *quantizePtr,
+		})
 		return
 	}
 	EnsureParamDirectories()
 	ResetParams()
+	go downloadQueue.Run(context.Background())
+	go RunMaintenance(context.Background())
 	state := State{}
 
 	pos, err := readPosition(true)
 	logde(err)
 	if err == nil {
-		state.Data, err = FindWaysAroundLocation(pos.Latitude, pos.Longitude)
+		tile, err := FindTileAroundLocation(pos.Latitude, pos.Longitude)
 		logde(errors.Wrap(err, "could not find ways around initial location"))
+		state.SetTile(tile)
 	}
 
 	target_lat_a, err := GetParam(MAP_TARGET_LAT_A_PERSIST)
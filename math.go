@@ -15,6 +15,10 @@ var (
 	TO_RADIANS       = math.Pi / 180
 	TO_DEGREES       = 180 / math.Pi
 	TARGET_LAT_ACCEL = 2.0 // m/s^2
+
+	GRADE_MIN_DISTANCE        = 25.0 // meters. minimum distance to measure a grade over to smooth out elevation noise
+	DOWNHILL_LAT_ACCEL_FACTOR = 2.0  // fraction of the target lateral accel given up per unit of downhill grade
+	MIN_LAT_ACCEL_SCALE       = 0.5  // never scale the target lateral accel below this fraction
 )
 
 func Dot(ax float64, ay float64, bx float64, by float64) float64 {
@@ -71,65 +75,81 @@ type Curvature struct {
 	Latitude  float64 `json:"latitude"`
 	Longitude float64 `json:"longitude"`
 	Curvature float64 `json:"curvature"`
+	Index     int     `json:"-"` // point in the StatePath
 }
 
-func GetStateCurvatures(state *State) ([]Curvature, error) {
+// The nodes of the current and next ways in the direction of travel
+type StatePath struct {
+	Points            []Coordinates
+	HasElevation      []bool
+	LatAccelScale     []float64
+	MergeOrSplitNodes []int
+}
+
+func GetStatePath(state *State) (StatePath, error) {
 	nodes, err := state.CurrentWay.Way.Nodes()
 	if err != nil {
-		return []Curvature{}, errors.Wrap(err, "could not read way nodes")
+		return StatePath{}, errors.Wrap(err, "could not read way nodes")
+	}
+	path := StatePath{}
+	// whether the next way continues from the last point of the path
+	connected := false
+	addWay := func(way Way, nodes capnp.StructList[Coordinates], forward bool) {
+		for i := 0; i < nodes.Len(); i++ {
+			if connected && i == 0 {
+				continue
+			}
+			index := i
+			if !forward {
+				index = nodes.Len() - i - 1
+			}
+			path.Points = append(path.Points, nodes.At(index))
+			path.HasElevation = append(path.HasElevation, way.HasElevation())
+			path.LatAccelScale = append(path.LatAccelScale, WayLatAccelScale(way))
+		}
+		connected = true
 	}
-	num_points := nodes.Len()
-	all_nodes := []capnp.StructList[Coordinates]{nodes}
-	all_nodes_direction := []bool{state.CurrentWay.OnWay.IsForward}
-	all_nodes_is_merge_or_split := []bool{false}
+
+	// the ring of a roundabout gives erratic curvatures, MapRoundabout covers
+	// its entry speed instead. The path skips from the entry to the exit node.
 	lastWay := state.CurrentWay.Way
+	if !IsRoundabout(lastWay) {
+		addWay(lastWay, nodes, state.CurrentWay.OnWay.IsForward)
+	}
 	for _, nextWay := range state.NextWays {
+		if IsRoundabout(nextWay.Way) {
+			connected = false
+			lastWay = nextWay.Way
+			continue
+		}
 		nwNodes, err := nextWay.Way.Nodes()
 		if err != nil {
 			continue
 		}
-		if nwNodes.Len() > 0 {
-			num_points += nwNodes.Len() - 1
+		// the gap left by a roundabout is kept straight like a merge
+		isMergeOrSplit := !connected || lastWay.Lanes() < nextWay.Way.Lanes() || (lastWay.Lanes() > nextWay.Way.Lanes() && !lastWay.OneWay() && nextWay.Way.OneWay())
+		if isMergeOrSplit && len(path.Points) > 0 {
+			path.MergeOrSplitNodes = append(path.MergeOrSplitNodes, len(path.Points)-1)
 		}
-		all_nodes = append(all_nodes, nwNodes)
-		all_nodes_direction = append(all_nodes_direction, nextWay.IsForward)
-		all_nodes_is_merge_or_split = append(all_nodes_is_merge_or_split, lastWay.Lanes() < nextWay.Way.Lanes() || (lastWay.Lanes() > nextWay.Way.Lanes() && !lastWay.OneWay() && nextWay.Way.OneWay()))
+		addWay(nextWay.Way, nwNodes, nextWay.IsForward)
 		lastWay = nextWay.Way
 	}
 
-	x_points := make([]float64, num_points)
-	y_points := make([]float64, num_points)
-
-	merge_or_split_nodes := []int{}
-	all_nodes_idx := 0
-	nodes_idx := 0
-	for i := 0; i < num_points; i++ {
-		var index int
-		forward := all_nodes_direction[all_nodes_idx]
-		if forward {
-			index = nodes_idx
-			if all_nodes_idx > 0 {
-				index += 1
-			}
-		} else {
-			index = all_nodes[all_nodes_idx].Len() - nodes_idx - 1
-			if all_nodes_idx > 0 {
-				index -= 1
-			}
-		}
-		node := all_nodes[all_nodes_idx].At(index)
-		x_points[i] = node.Latitude()
-		y_points[i] = node.Longitude()
-
-		nodes_idx += 1
-		if nodes_idx == all_nodes[all_nodes_idx].Len() || (nodes_idx == all_nodes[all_nodes_idx].Len()-1 && all_nodes_idx > 0) {
-			all_nodes_idx += 1
-			nodes_idx = 0
-			if all_nodes_idx < len(all_nodes_is_merge_or_split) && all_nodes_is_merge_or_split[all_nodes_idx] {
-				merge_or_split_nodes = append(merge_or_split_nodes, i)
-			}
-		}
+	return path, nil
+}
+
+func GetStateCurvatures(state *State) ([]Curvature, error) {
+	path, err := GetStatePath(state)
+	if err != nil {
+		return []Curvature{}, errors.Wrap(err, "could not get path from current state")
 	}
+	x_points := make([]float64, len(path.Points))
+	y_points := make([]float64, len(path.Points))
+	for i, point := range path.Points {
+		x_points[i] = point.Latitude()
+		y_points[i] = point.Longitude()
+	}
+	merge_or_split_nodes := path.MergeOrSplitNodes
 
 	curvatures, arc_lengths, err := GetCurvatures(x_points, y_points)
 	if err != nil {
@@ -167,23 +187,95 @@ func GetStateCurvatures(state *State) ([]Curvature, error) {
 		curvature_outputs[i].Curvature = curvature
 		curvature_outputs[i].Latitude = x_points[i+2]
 		curvature_outputs[i].Longitude = y_points[i+2]
+		curvature_outputs[i].Index = i + 2
 	}
 	return curvature_outputs, nil
 }
 
+type Grade struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Elevation float64 `json:"elevation"`
+	Grade     float64 `json:"grade"`
+	Index     int     `json:"-"` // point in the StatePath
+}
+
+func GetStateGrades(state *State) ([]Grade, error) {
+	path, err := GetStatePath(state)
+	if err != nil {
+		return []Grade{}, errors.Wrap(err, "could not get path from current state")
+	}
+	return GetGrades(path), nil
+}
+
+// Grades are rise over run in the direction of travel, measured from each point
+// to the first point at least GRADE_MIN_DISTANCE ahead of it.
+func GetGrades(path StatePath) []Grade {
+	grades := []Grade{}
+	for i, point := range path.Points {
+		if !path.HasElevation[i] {
+			continue
+		}
+		dist := 0.0
+		j := i
+		for j+1 < len(path.Points) && path.HasElevation[j+1] && dist < GRADE_MIN_DISTANCE {
+			a := path.Points[j]
+			b := path.Points[j+1]
+			dist += DistanceToPoint(a.Latitude()*TO_RADIANS, a.Longitude()*TO_RADIANS, b.Latitude()*TO_RADIANS, b.Longitude()*TO_RADIANS)
+			j++
+		}
+		if dist == 0 {
+			continue
+		}
+		grades = append(grades, Grade{
+			Latitude:  point.Latitude(),
+			Longitude: point.Longitude(),
+			Elevation: float64(point.Elevation()),
+			Grade:     float64(path.Points[j].Elevation()-point.Elevation()) / dist,
+			Index:     i,
+		})
+	}
+	return grades
+}
+
+// Scales the target lateral accel down on descents where braking distances grow
+func GradeLatAccel(grade float64) float64 {
+	if grade >= 0 {
+		return TARGET_LAT_ACCEL
+	}
+	return TARGET_LAT_ACCEL * math.Max(MIN_LAT_ACCEL_SCALE, 1+DOWNHILL_LAT_ACCEL_FACTOR*grade)
+}
+
 type Velocity struct {
 	Latitude  float64 `json:"latitude"`
 	Longitude float64 `json:"longitude"`
 	Velocity  float64 `json:"velocity"`
 }
 
-func GetTargetVelocities(curvatures []Curvature) []Velocity {
+func GetTargetVelocities(curvatures []Curvature, grades []Grade, surfaces []SurfaceScale) []Velocity {
+	// all three are taken from the same StatePath, its point index matches them
+	gradeAt := map[int]float64{}
+	for _, grade := range grades {
+		gradeAt[grade.Index] = grade.Grade
+	}
+	surfaceAt := map[int]float64{}
+	for _, surface := range surfaces {
+		surfaceAt[surface.Index] = surface.Scale
+	}
 	velocities := make([]Velocity, len(curvatures))
 	for i, curv := range curvatures {
 		if curv.Curvature == 0 {
 			continue
 		}
-		velocities[i].Velocity = math.Pow(TARGET_LAT_ACCEL/curv.Curvature, 1.0/2)
+		latAccel := TARGET_LAT_ACCEL
+		if grade, ok := gradeAt[curv.Index]; ok {
+			latAccel = GradeLatAccel(grade)
+		}
+		// unpaved and rough roads give up grip on top of descents, down to the same floor
+		if scale, ok := surfaceAt[curv.Index]; ok {
+			latAccel = math.Max(TARGET_LAT_ACCEL*MIN_LAT_ACCEL_SCALE, latAccel*scale)
+		}
+		velocities[i].Velocity = math.Pow(latAccel/curv.Curvature, 1.0/2)
 		velocities[i].Latitude = curv.Latitude
 		velocities[i].Longitude = curv.Longitude
 	}
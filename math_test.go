@@ -35,3 +35,25 @@ func TestBearing(t *testing.T) {
 	east := Bearing(39.97639072630465, -83.11918338645518, 39.97031064469578, -82.8450246292918)
 	cupaloy.SnapshotT(t, "Should be near 0 (northbound)", north*TO_DEGREES, "Should be near 90 (eastbound)", east*TO_DEGREES)
 }
+
+func TestGetTargetVelocities(t *testing.T) {
+	// the path passes the same coordinates twice, downhill on gravel first and
+	// uphill on asphalt the second time
+	curvatures := []Curvature{
+		{Latitude: 1, Longitude: 1, Curvature: 0.01, Index: 2},
+		{Latitude: 1, Longitude: 1, Curvature: 0.01, Index: 5},
+		{Latitude: 1.0000000000000002, Longitude: 1, Curvature: 0.01, Index: 6},
+	}
+	grades := []Grade{
+		{Latitude: 1, Longitude: 1, Grade: -0.1, Index: 2},
+		{Latitude: 1, Longitude: 1, Grade: 0.1, Index: 5},
+		{Latitude: 1, Longitude: 1, Grade: -0.1, Index: 6},
+	}
+	surfaces := []SurfaceScale{
+		{Latitude: 1, Longitude: 1, Scale: 0.6, Index: 2},
+		{Latitude: 1, Longitude: 1, Scale: 1, Index: 5},
+		{Latitude: 1, Longitude: 1, Scale: 1, Index: 6},
+	}
+
+	cupaloy.SnapshotT(t, GetTargetVelocities(curvatures, grades, surfaces))
+}
@@ -0,0 +1,30 @@
+//go:build !unix
+
+package main
+
+import (
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// Reads size bytes of a file into memory where memory mapping is not
+// available. The data of a writable mapping is written back when it is
+// unmapped.
+func mapFile(f *os.File, size int, writable bool) ([]byte, error) {
+	data := make([]byte, size)
+	_, err := f.ReadAt(data, 0)
+	if err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "could not read file into memory")
+	}
+	return data, nil
+}
+
+func unmapFile(f *os.File, data []byte, writable bool) error {
+	if !writable {
+		return nil
+	}
+	_, err := f.WriteAt(data, 0)
+	return errors.Wrap(err, "could not write file back from memory")
+}
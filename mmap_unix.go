@@ -0,0 +1,22 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// Maps size bytes of a file into memory. Writes to a writable mapping go
+// straight to the file.
+func mapFile(f *os.File, size int, writable bool) ([]byte, error) {
+	prot := syscall.PROT_READ
+	if writable {
+		prot |= syscall.PROT_WRITE
+	}
+	return syscall.Mmap(int(f.Fd()), 0, size, prot, syscall.MAP_SHARED)
+}
+
+func unmapFile(f *os.File, data []byte, writable bool) error {
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+
+	"github.com/paulmach/osm"
+	"github.com/pkg/errors"
+)
+
+var (
+	SPARSE_INDEX_GROW   = int64(1 << 28) // bytes. minimum amount to grow a sparse index by
+	NODE_LATITUDE_SHIFT = int32(1000000000)
+)
+
+// A file of fixed size records indexed by osm id. The file is sparse and
+// memory mapped, so only the pages holding records take up disk and the
+// operating system decides how much of it stays in memory. Records that were
+// never written read as zeros. Without memory mapping the whole file is read
+// into memory and written back when the index grows or is closed.
+type SparseIndex struct {
+	file       *os.File
+	data       []byte
+	recordSize int64
+}
+
+// Opens an index, an existing index is kept unless truncate is set
+func OpenSparseIndex(path string, recordSize int64, truncate bool) (*SparseIndex, error) {
+	flags := os.O_CREATE | os.O_RDWR
+	if truncate {
+		flags |= os.O_TRUNC
+	}
+	file, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not open sparse index")
+	}
+	index := &SparseIndex{file: file, recordSize: recordSize}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, errors.Wrap(err, "could not stat sparse index")
+	}
+	if info.Size() > 0 {
+		err = index.grow(info.Size())
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return index, nil
+}
+
+func (s *SparseIndex) grow(size int64) error {
+	if s.data != nil {
+		err := unmapFile(s.file, s.data, true)
+		if err != nil {
+			return errors.Wrap(err, "could not unmap sparse index")
+		}
+		s.data = nil
+	}
+	err := s.file.Truncate(size)
+	if err != nil {
+		return errors.Wrap(err, "could not grow sparse index")
+	}
+	s.data, err = mapFile(s.file, int(size), true)
+	return errors.Wrap(err, "could not map sparse index")
+}
+
+// Returns the record of an id, growing the index if needed. Negative ids have no record.
+func (s *SparseIndex) record(id int64, grow bool) ([]byte, error) {
+	if id < 0 {
+		return nil, nil
+	}
+	offset := id * s.recordSize
+	if offset+s.recordSize > int64(len(s.data)) {
+		if !grow {
+			return nil, nil
+		}
+		size := int64(len(s.data)) * 2
+		if size < offset+SPARSE_INDEX_GROW {
+			size = offset + SPARSE_INDEX_GROW
+		}
+		err := s.grow(size)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s.data[offset : offset+s.recordSize], nil
+}
+
+func (s *SparseIndex) Close() error {
+	if s.data != nil {
+		err := unmapFile(s.file, s.data, true)
+		if err != nil {
+			return errors.Wrap(err, "could not unmap sparse index")
+		}
+		s.data = nil
+	}
+	return errors.Wrap(s.file.Close(), "could not close sparse index")
+}
+
+// Coordinates are stored as 1e-7 degree fixed point, latitudes are shifted so
+// that an empty record reads as a missing location.
+func putLocation(b []byte, lat float64, lon float64) {
+	binary.LittleEndian.PutUint32(b, uint32(int32(math.Round(lat*1e7))+NODE_LATITUDE_SHIFT))
+	binary.LittleEndian.PutUint32(b[4:], uint32(int32(math.Round(lon*1e7))))
+}
+
+func getLocation(b []byte) (float64, float64, bool) {
+	lat := int32(binary.LittleEndian.Uint32(b))
+	if lat == 0 {
+		return 0, 0, false
+	}
+	lon := int32(binary.LittleEndian.Uint32(b[4:]))
+	return float64(lat-NODE_LATITUDE_SHIFT) / 1e7, float64(lon) / 1e7, true
+}
+
+// Maps node ids to their locations
+type NodeLocations struct {
+	index *SparseIndex
+}
+
+func OpenNodeLocations(path string, truncate bool) (*NodeLocations, error) {
+	index, err := OpenSparseIndex(path, 8, truncate)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not open node location index")
+	}
+	return &NodeLocations{index: index}, nil
+}
+
+func (n *NodeLocations) Set(id osm.NodeID, lat float64, lon float64) error {
+	record, err := n.index.record(int64(id), true)
+	if record != nil {
+		putLocation(record, lat, lon)
+	}
+	return err
+}
+
+func (n *NodeLocations) Delete(id osm.NodeID) {
+	record, _ := n.index.record(int64(id), false)
+	for i := range record {
+		record[i] = 0
+	}
+}
+
+func (n *NodeLocations) Get(id osm.NodeID) (float64, float64, bool) {
+	record, _ := n.index.record(int64(id), false)
+	if record == nil {
+		return 0, 0, false
+	}
+	return getLocation(record)
+}
+
+func (n *NodeLocations) Close() error {
+	return n.index.Close()
+}
+
+// Maps way ids to the bounding box they were generated with, so that the
+// areas holding a way can be found when it changes or is deleted
+type WayBounds struct {
+	index *SparseIndex
+}
+
+func OpenWayBounds(path string, truncate bool) (*WayBounds, error) {
+	index, err := OpenSparseIndex(path, 16, truncate)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not open way bounds index")
+	}
+	return &WayBounds{index: index}, nil
+}
+
+func (w *WayBounds) Set(way TmpWay) error {
+	record, err := w.index.record(way.Id, true)
+	if record != nil {
+		putLocation(record, way.MinLat, way.MinLon)
+		putLocation(record[8:], way.MaxLat, way.MaxLon)
+	}
+	return err
+}
+
+func (w *WayBounds) Delete(id int64) {
+	record, _ := w.index.record(id, false)
+	for i := range record {
+		record[i] = 0
+	}
+}
+
+func (w *WayBounds) Get(id int64) (float64, float64, float64, float64, bool) {
+	record, _ := w.index.record(id, false)
+	if record == nil {
+		return 0, 0, 0, 0, false
+	}
+	minLat, minLon, ok := getLocation(record)
+	maxLat, maxLon, _ := getLocation(record[8:])
+	return minLat, minLon, maxLat, maxLon, ok
+}
+
+func (w *WayBounds) Close() error {
+	return w.index.Close()
+}
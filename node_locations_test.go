@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/bradleyjkemp/cupaloy"
+	"github.com/paulmach/osm"
+)
+
+func TestNodeLocations(t *testing.T) {
+	grow := SPARSE_INDEX_GROW
+	defer func() { SPARSE_INDEX_GROW = grow }()
+	SPARSE_INDEX_GROW = 64
+	path := filepath.Join(t.TempDir(), "nodes.bin")
+
+	results := ""
+	get := func(step string, locations *NodeLocations) {
+		results += step + ":"
+		for _, id := range []osm.NodeID{1, 2, 1000, 5000, -1} {
+			lat, lon, ok := locations.Get(id)
+			results += fmt.Sprintf(" %d=%.7f,%.7f/%v", id, lat, lon, ok)
+		}
+		results += "\n"
+	}
+
+	locations, err := OpenNodeLocations(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, node := range []struct {
+		id       osm.NodeID
+		lat, lon float64
+	}{{1, 38.1234567, -75.7654321}, {2, -90, -180}, {1000, 0, 0}, {5000, 89.9999999, 179.9999999}, {-1, 1, 1}} {
+		err = locations.Set(node.id, node.lat, node.lon)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	get("set", locations)
+	locations.Delete(2)
+	locations.Delete(9999)
+	get("deleted", locations)
+	err = locations.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	locations, err = OpenNodeLocations(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get("reopened", locations)
+	err = locations.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	locations, err = OpenNodeLocations(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get("truncated", locations)
+	err = locations.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bounds, err := OpenWayBounds(filepath.Join(t.TempDir(), "ways.bin"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bounds.Close()
+	err = bounds.Set(TmpWay{Id: 42, MinLat: 38, MinLon: -76, MaxLat: 38.5, MaxLon: -75.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	minLat, minLon, maxLat, maxLon, ok := bounds.Get(42)
+	results += fmt.Sprintf("way bounds: %.1f,%.1f,%.1f,%.1f/%v\n", minLat, minLon, maxLat, maxLon, ok)
+	bounds.Delete(42)
+	_, _, _, _, ok = bounds.Get(42)
+	results += fmt.Sprintf("deleted way bounds: %v\n", ok)
+
+	cupaloy.SnapshotT(t, results)
+}
@@ -15,12 +15,12 @@ type Way capnp.Struct
 const Way_TypeID = 0xa4b9c59286b69600
 
 func NewWay(s *capnp.Segment) (Way, error) {
-	st, err := capnp.NewStruct(s, capnp.ObjectSize{DataSize: 104, PointerCount: 4})
+	st, err := capnp.NewStruct(s, capnp.ObjectSize{DataSize: 104, PointerCount: 13})
 	return Way(st), err
 }
 
 func NewRootWay(s *capnp.Segment) (Way, error) {
-	st, err := capnp.NewRootStruct(s, capnp.ObjectSize{DataSize: 104, PointerCount: 4})
+	st, err := capnp.NewRootStruct(s, capnp.ObjectSize{DataSize: 104, PointerCount: 13})
 	return Way(st), err
 }
 
@@ -245,101 +245,1136 @@ func (s Way) SetMaxSpeedPracticalBackward(v float64) {
 	capnp.Struct(s).SetUint64(96, math.Float64bits(v))
 }
 
+func (s Way) Junction() (string, error) {
+	p, err := capnp.Struct(s).Ptr(4)
+	return p.Text(), err
+}
+
+func (s Way) HasJunction() bool {
+	return capnp.Struct(s).HasPtr(4)
+}
+
+func (s Way) JunctionBytes() ([]byte, error) {
+	p, err := capnp.Struct(s).Ptr(4)
+	return p.TextBytes(), err
+}
+
+func (s Way) SetJunction(v string) error {
+	return capnp.Struct(s).SetText(4, v)
+}
+
+func (s Way) HasElevation() bool {
+	return capnp.Struct(s).Bit(393)
+}
+
+func (s Way) SetHasElevation(v bool) {
+	capnp.Struct(s).SetBit(393, v)
+}
+
+func (s Way) Features() (Feature_List, error) {
+	p, err := capnp.Struct(s).Ptr(5)
+	return Feature_List(p.List()), err
+}
+
+func (s Way) HasFeatures() bool {
+	return capnp.Struct(s).HasPtr(5)
+}
+
+func (s Way) SetFeatures(v Feature_List) error {
+	return capnp.Struct(s).SetPtr(5, v.ToPtr())
+}
+
+// NewFeatures sets the features field to a newly
+// allocated Feature_List, preferring placement in s's segment.
+func (s Way) NewFeatures(n int32) (Feature_List, error) {
+	l, err := NewFeature_List(capnp.Struct(s).Segment(), n)
+	if err != nil {
+		return Feature_List{}, err
+	}
+	err = capnp.Struct(s).SetPtr(5, l.ToPtr())
+	return l, err
+}
+func (s Way) Hazards() (WayHazard_List, error) {
+	p, err := capnp.Struct(s).Ptr(6)
+	return WayHazard_List(p.List()), err
+}
+
+func (s Way) HasHazards() bool {
+	return capnp.Struct(s).HasPtr(6)
+}
+
+func (s Way) SetHazards(v WayHazard_List) error {
+	return capnp.Struct(s).SetPtr(6, v.ToPtr())
+}
+
+// NewHazards sets the hazards field to a newly
+// allocated WayHazard_List, preferring placement in s's segment.
+func (s Way) NewHazards(n int32) (WayHazard_List, error) {
+	l, err := NewWayHazard_List(capnp.Struct(s).Segment(), n)
+	if err != nil {
+		return WayHazard_List{}, err
+	}
+	err = capnp.Struct(s).SetPtr(6, l.ToPtr())
+	return l, err
+}
+func (s Way) NodeDeltas() (capnp.Int32List, error) {
+	p, err := capnp.Struct(s).Ptr(7)
+	return capnp.Int32List(p.List()), err
+}
+
+func (s Way) HasNodeDeltas() bool {
+	return capnp.Struct(s).HasPtr(7)
+}
+
+func (s Way) SetNodeDeltas(v capnp.Int32List) error {
+	return capnp.Struct(s).SetPtr(7, v.ToPtr())
+}
+
+// NewNodeDeltas sets the nodeDeltas field to a newly
+// allocated capnp.Int32List, preferring placement in s's segment.
+func (s Way) NewNodeDeltas(n int32) (capnp.Int32List, error) {
+	l, err := capnp.NewInt32List(capnp.Struct(s).Segment(), n)
+	if err != nil {
+		return capnp.Int32List{}, err
+	}
+	err = capnp.Struct(s).SetPtr(7, l.ToPtr())
+	return l, err
+}
+func (s Way) NodeElevations() (capnp.Float32List, error) {
+	p, err := capnp.Struct(s).Ptr(8)
+	return capnp.Float32List(p.List()), err
+}
+
+func (s Way) HasNodeElevations() bool {
+	return capnp.Struct(s).HasPtr(8)
+}
+
+func (s Way) SetNodeElevations(v capnp.Float32List) error {
+	return capnp.Struct(s).SetPtr(8, v.ToPtr())
+}
+
+// NewNodeElevations sets the nodeElevations field to a newly
+// allocated capnp.Float32List, preferring placement in s's segment.
+func (s Way) NewNodeElevations(n int32) (capnp.Float32List, error) {
+	l, err := capnp.NewFloat32List(capnp.Struct(s).Segment(), n)
+	if err != nil {
+		return capnp.Float32List{}, err
+	}
+	err = capnp.Struct(s).SetPtr(8, l.ToPtr())
+	return l, err
+}
+func (s Way) LanesForward() (Lanes, error) {
+	p, err := capnp.Struct(s).Ptr(9)
+	return Lanes(p.Struct()), err
+}
+
+func (s Way) HasLanesForward() bool {
+	return capnp.Struct(s).HasPtr(9)
+}
+
+func (s Way) SetLanesForward(v Lanes) error {
+	return capnp.Struct(s).SetPtr(9, capnp.Struct(v).ToPtr())
+}
+
+// NewLanesForward sets the lanesForward field to a newly
+// allocated Lanes struct, preferring placement in s's segment.
+func (s Way) NewLanesForward() (Lanes, error) {
+	ss, err := NewLanes(capnp.Struct(s).Segment())
+	if err != nil {
+		return Lanes{}, err
+	}
+	err = capnp.Struct(s).SetPtr(9, capnp.Struct(ss).ToPtr())
+	return ss, err
+}
+
+func (s Way) LanesBackward() (Lanes, error) {
+	p, err := capnp.Struct(s).Ptr(10)
+	return Lanes(p.Struct()), err
+}
+
+func (s Way) HasLanesBackward() bool {
+	return capnp.Struct(s).HasPtr(10)
+}
+
+func (s Way) SetLanesBackward(v Lanes) error {
+	return capnp.Struct(s).SetPtr(10, capnp.Struct(v).ToPtr())
+}
+
+// NewLanesBackward sets the lanesBackward field to a newly
+// allocated Lanes struct, preferring placement in s's segment.
+func (s Way) NewLanesBackward() (Lanes, error) {
+	ss, err := NewLanes(capnp.Struct(s).Segment())
+	if err != nil {
+		return Lanes{}, err
+	}
+	err = capnp.Struct(s).SetPtr(10, capnp.Struct(ss).ToPtr())
+	return ss, err
+}
+
+func (s Way) Tunnel() bool {
+	return capnp.Struct(s).Bit(394)
+}
+
+func (s Way) SetTunnel(v bool) {
+	capnp.Struct(s).SetBit(394, v)
+}
+
+func (s Way) Bridge() bool {
+	return capnp.Struct(s).Bit(395)
+}
+
+func (s Way) SetBridge(v bool) {
+	capnp.Struct(s).SetBit(395, v)
+}
+
+func (s Way) Layer() int8 {
+	return int8(capnp.Struct(s).Uint8(50))
+}
+
+func (s Way) SetLayer(v int8) {
+	capnp.Struct(s).SetUint8(50, uint8(v))
+}
+
+func (s Way) Surface() (string, error) {
+	p, err := capnp.Struct(s).Ptr(11)
+	return p.Text(), err
+}
+
+func (s Way) HasSurface() bool {
+	return capnp.Struct(s).HasPtr(11)
+}
+
+func (s Way) SurfaceBytes() ([]byte, error) {
+	p, err := capnp.Struct(s).Ptr(11)
+	return p.TextBytes(), err
+}
+
+func (s Way) SetSurface(v string) error {
+	return capnp.Struct(s).SetText(11, v)
+}
+
+func (s Way) Smoothness() (string, error) {
+	p, err := capnp.Struct(s).Ptr(12)
+	return p.Text(), err
+}
+
+func (s Way) HasSmoothness() bool {
+	return capnp.Struct(s).HasPtr(12)
+}
+
+func (s Way) SmoothnessBytes() ([]byte, error) {
+	p, err := capnp.Struct(s).Ptr(12)
+	return p.TextBytes(), err
+}
+
+func (s Way) SetSmoothness(v string) error {
+	return capnp.Struct(s).SetText(12, v)
+}
+
 // Way_List is a list of Way.
 type Way_List = capnp.StructList[Way]
 
-// NewWay creates a new list of Way.
-func NewWay_List(s *capnp.Segment, sz int32) (Way_List, error) {
-	l, err := capnp.NewCompositeList(s, capnp.ObjectSize{DataSize: 104, PointerCount: 4}, sz)
-	return capnp.StructList[Way](l), err
+// NewWay creates a new list of Way.
+func NewWay_List(s *capnp.Segment, sz int32) (Way_List, error) {
+	l, err := capnp.NewCompositeList(s, capnp.ObjectSize{DataSize: 104, PointerCount: 13}, sz)
+	return capnp.StructList[Way](l), err
+}
+
+// Way_Future is a wrapper for a Way promised by a client call.
+type Way_Future struct{ *capnp.Future }
+
+func (f Way_Future) Struct() (Way, error) {
+	p, err := f.Future.Ptr()
+	return Way(p.Struct()), err
+}
+func (p Way_Future) LanesForward() Lanes_Future {
+	return Lanes_Future{Future: p.Future.Field(9, nil)}
+}
+func (p Way_Future) LanesBackward() Lanes_Future {
+	return Lanes_Future{Future: p.Future.Field(10, nil)}
+}
+
+type Lanes capnp.Struct
+
+// Lanes_TypeID is the unique identifier for the type Lanes.
+const Lanes_TypeID = 0xf5eaa9c93feb2bb5
+
+func NewLanes(s *capnp.Segment) (Lanes, error) {
+	st, err := capnp.NewStruct(s, capnp.ObjectSize{DataSize: 8, PointerCount: 5})
+	return Lanes(st), err
+}
+
+func NewRootLanes(s *capnp.Segment) (Lanes, error) {
+	st, err := capnp.NewRootStruct(s, capnp.ObjectSize{DataSize: 8, PointerCount: 5})
+	return Lanes(st), err
+}
+
+func ReadRootLanes(msg *capnp.Message) (Lanes, error) {
+	root, err := msg.Root()
+	return Lanes(root.Struct()), err
+}
+
+func (s Lanes) String() string {
+	str, _ := text.Marshal(0xf5eaa9c93feb2bb5, capnp.Struct(s))
+	return str
+}
+
+func (s Lanes) EncodeAsPtr(seg *capnp.Segment) capnp.Ptr {
+	return capnp.Struct(s).EncodeAsPtr(seg)
+}
+
+func (Lanes) DecodeFromPtr(p capnp.Ptr) Lanes {
+	return Lanes(capnp.Struct{}.DecodeFromPtr(p))
+}
+
+func (s Lanes) ToPtr() capnp.Ptr {
+	return capnp.Struct(s).ToPtr()
+}
+func (s Lanes) IsValid() bool {
+	return capnp.Struct(s).IsValid()
+}
+
+func (s Lanes) Message() *capnp.Message {
+	return capnp.Struct(s).Message()
+}
+
+func (s Lanes) Segment() *capnp.Segment {
+	return capnp.Struct(s).Segment()
+}
+func (s Lanes) Count() uint8 {
+	return capnp.Struct(s).Uint8(0)
+}
+
+func (s Lanes) SetCount(v uint8) {
+	capnp.Struct(s).SetUint8(0, v)
+}
+
+func (s Lanes) Turn() (capnp.TextList, error) {
+	p, err := capnp.Struct(s).Ptr(0)
+	return capnp.TextList(p.List()), err
+}
+
+func (s Lanes) HasTurn() bool {
+	return capnp.Struct(s).HasPtr(0)
+}
+
+func (s Lanes) SetTurn(v capnp.TextList) error {
+	return capnp.Struct(s).SetPtr(0, v.ToPtr())
+}
+
+// NewTurn sets the turn field to a newly
+// allocated capnp.TextList, preferring placement in s's segment.
+func (s Lanes) NewTurn(n int32) (capnp.TextList, error) {
+	l, err := capnp.NewTextList(capnp.Struct(s).Segment(), n)
+	if err != nil {
+		return capnp.TextList{}, err
+	}
+	err = capnp.Struct(s).SetPtr(0, l.ToPtr())
+	return l, err
+}
+func (s Lanes) Change() (capnp.TextList, error) {
+	p, err := capnp.Struct(s).Ptr(1)
+	return capnp.TextList(p.List()), err
+}
+
+func (s Lanes) HasChange() bool {
+	return capnp.Struct(s).HasPtr(1)
+}
+
+func (s Lanes) SetChange(v capnp.TextList) error {
+	return capnp.Struct(s).SetPtr(1, v.ToPtr())
+}
+
+// NewChange sets the change field to a newly
+// allocated capnp.TextList, preferring placement in s's segment.
+func (s Lanes) NewChange(n int32) (capnp.TextList, error) {
+	l, err := capnp.NewTextList(capnp.Struct(s).Segment(), n)
+	if err != nil {
+		return capnp.TextList{}, err
+	}
+	err = capnp.Struct(s).SetPtr(1, l.ToPtr())
+	return l, err
+}
+func (s Lanes) MaxSpeeds() (capnp.Float64List, error) {
+	p, err := capnp.Struct(s).Ptr(2)
+	return capnp.Float64List(p.List()), err
+}
+
+func (s Lanes) HasMaxSpeeds() bool {
+	return capnp.Struct(s).HasPtr(2)
+}
+
+func (s Lanes) SetMaxSpeeds(v capnp.Float64List) error {
+	return capnp.Struct(s).SetPtr(2, v.ToPtr())
+}
+
+// NewMaxSpeeds sets the maxSpeeds field to a newly
+// allocated capnp.Float64List, preferring placement in s's segment.
+func (s Lanes) NewMaxSpeeds(n int32) (capnp.Float64List, error) {
+	l, err := capnp.NewFloat64List(capnp.Struct(s).Segment(), n)
+	if err != nil {
+		return capnp.Float64List{}, err
+	}
+	err = capnp.Struct(s).SetPtr(2, l.ToPtr())
+	return l, err
+}
+func (s Lanes) Destination() (string, error) {
+	p, err := capnp.Struct(s).Ptr(3)
+	return p.Text(), err
+}
+
+func (s Lanes) HasDestination() bool {
+	return capnp.Struct(s).HasPtr(3)
+}
+
+func (s Lanes) DestinationBytes() ([]byte, error) {
+	p, err := capnp.Struct(s).Ptr(3)
+	return p.TextBytes(), err
+}
+
+func (s Lanes) SetDestination(v string) error {
+	return capnp.Struct(s).SetText(3, v)
+}
+
+func (s Lanes) DestinationRef() (string, error) {
+	p, err := capnp.Struct(s).Ptr(4)
+	return p.Text(), err
+}
+
+func (s Lanes) HasDestinationRef() bool {
+	return capnp.Struct(s).HasPtr(4)
+}
+
+func (s Lanes) DestinationRefBytes() ([]byte, error) {
+	p, err := capnp.Struct(s).Ptr(4)
+	return p.TextBytes(), err
+}
+
+func (s Lanes) SetDestinationRef(v string) error {
+	return capnp.Struct(s).SetText(4, v)
+}
+
+// Lanes_List is a list of Lanes.
+type Lanes_List = capnp.StructList[Lanes]
+
+// NewLanes creates a new list of Lanes.
+func NewLanes_List(s *capnp.Segment, sz int32) (Lanes_List, error) {
+	l, err := capnp.NewCompositeList(s, capnp.ObjectSize{DataSize: 8, PointerCount: 5}, sz)
+	return capnp.StructList[Lanes](l), err
+}
+
+// Lanes_Future is a wrapper for a Lanes promised by a client call.
+type Lanes_Future struct{ *capnp.Future }
+
+func (f Lanes_Future) Struct() (Lanes, error) {
+	p, err := f.Future.Ptr()
+	return Lanes(p.Struct()), err
+}
+
+type Coordinates capnp.Struct
+
+// Coordinates_TypeID is the unique identifier for the type Coordinates.
+const Coordinates_TypeID = 0x922b57c60c6a46d1
+
+func NewCoordinates(s *capnp.Segment) (Coordinates, error) {
+	st, err := capnp.NewStruct(s, capnp.ObjectSize{DataSize: 24, PointerCount: 0})
+	return Coordinates(st), err
+}
+
+func NewRootCoordinates(s *capnp.Segment) (Coordinates, error) {
+	st, err := capnp.NewRootStruct(s, capnp.ObjectSize{DataSize: 24, PointerCount: 0})
+	return Coordinates(st), err
+}
+
+func ReadRootCoordinates(msg *capnp.Message) (Coordinates, error) {
+	root, err := msg.Root()
+	return Coordinates(root.Struct()), err
+}
+
+func (s Coordinates) String() string {
+	str, _ := text.Marshal(0x922b57c60c6a46d1, capnp.Struct(s))
+	return str
+}
+
+func (s Coordinates) EncodeAsPtr(seg *capnp.Segment) capnp.Ptr {
+	return capnp.Struct(s).EncodeAsPtr(seg)
+}
+
+func (Coordinates) DecodeFromPtr(p capnp.Ptr) Coordinates {
+	return Coordinates(capnp.Struct{}.DecodeFromPtr(p))
+}
+
+func (s Coordinates) ToPtr() capnp.Ptr {
+	return capnp.Struct(s).ToPtr()
+}
+func (s Coordinates) IsValid() bool {
+	return capnp.Struct(s).IsValid()
+}
+
+func (s Coordinates) Message() *capnp.Message {
+	return capnp.Struct(s).Message()
+}
+
+func (s Coordinates) Segment() *capnp.Segment {
+	return capnp.Struct(s).Segment()
+}
+func (s Coordinates) Latitude() float64 {
+	return math.Float64frombits(capnp.Struct(s).Uint64(0))
+}
+
+func (s Coordinates) SetLatitude(v float64) {
+	capnp.Struct(s).SetUint64(0, math.Float64bits(v))
+}
+
+func (s Coordinates) Longitude() float64 {
+	return math.Float64frombits(capnp.Struct(s).Uint64(8))
+}
+
+func (s Coordinates) SetLongitude(v float64) {
+	capnp.Struct(s).SetUint64(8, math.Float64bits(v))
+}
+
+func (s Coordinates) Elevation() float32 {
+	return math.Float32frombits(capnp.Struct(s).Uint32(16))
+}
+
+func (s Coordinates) SetElevation(v float32) {
+	capnp.Struct(s).SetUint32(16, math.Float32bits(v))
+}
+
+// Coordinates_List is a list of Coordinates.
+type Coordinates_List = capnp.StructList[Coordinates]
+
+// NewCoordinates creates a new list of Coordinates.
+func NewCoordinates_List(s *capnp.Segment, sz int32) (Coordinates_List, error) {
+	l, err := capnp.NewCompositeList(s, capnp.ObjectSize{DataSize: 24, PointerCount: 0}, sz)
+	return capnp.StructList[Coordinates](l), err
+}
+
+// Coordinates_Future is a wrapper for a Coordinates promised by a client call.
+type Coordinates_Future struct{ *capnp.Future }
+
+func (f Coordinates_Future) Struct() (Coordinates, error) {
+	p, err := f.Future.Ptr()
+	return Coordinates(p.Struct()), err
+}
+
+type FeatureType uint16
+
+// FeatureType_TypeID is the unique identifier for the type FeatureType.
+const FeatureType_TypeID = 0xf3d7a4ae286d000b
+
+// Values of FeatureType.
+const (
+	FeatureType_trafficCalming   FeatureType = 0
+	FeatureType_stop             FeatureType = 1
+	FeatureType_giveWay          FeatureType = 2
+	FeatureType_trafficSignals   FeatureType = 3
+	FeatureType_levelCrossing    FeatureType = 4
+	FeatureType_crossing         FeatureType = 5
+	FeatureType_motorwayJunction FeatureType = 6
+)
+
+// String returns the enum's constant name.
+func (c FeatureType) String() string {
+	switch c {
+	case FeatureType_trafficCalming:
+		return "trafficCalming"
+	case FeatureType_stop:
+		return "stop"
+	case FeatureType_giveWay:
+		return "giveWay"
+	case FeatureType_trafficSignals:
+		return "trafficSignals"
+	case FeatureType_levelCrossing:
+		return "levelCrossing"
+	case FeatureType_crossing:
+		return "crossing"
+	case FeatureType_motorwayJunction:
+		return "motorwayJunction"
+
+	default:
+		return ""
+	}
+}
+
+// FeatureTypeFromString returns the enum value with a name,
+// or the zero value if there's no such value.
+func FeatureTypeFromString(c string) FeatureType {
+	switch c {
+	case "trafficCalming":
+		return FeatureType_trafficCalming
+	case "stop":
+		return FeatureType_stop
+	case "giveWay":
+		return FeatureType_giveWay
+	case "trafficSignals":
+		return FeatureType_trafficSignals
+	case "levelCrossing":
+		return FeatureType_levelCrossing
+	case "crossing":
+		return FeatureType_crossing
+	case "motorwayJunction":
+		return FeatureType_motorwayJunction
+
+	default:
+		return 0
+	}
+}
+
+type FeatureType_List = capnp.EnumList[FeatureType]
+
+func NewFeatureType_List(s *capnp.Segment, sz int32) (FeatureType_List, error) {
+	return capnp.NewEnumList[FeatureType](s, sz)
+}
+
+type Feature capnp.Struct
+
+// Feature_TypeID is the unique identifier for the type Feature.
+const Feature_TypeID = 0xe9d0d03649f7a645
+
+func NewFeature(s *capnp.Segment) (Feature, error) {
+	st, err := capnp.NewStruct(s, capnp.ObjectSize{DataSize: 8, PointerCount: 2})
+	return Feature(st), err
+}
+
+func NewRootFeature(s *capnp.Segment) (Feature, error) {
+	st, err := capnp.NewRootStruct(s, capnp.ObjectSize{DataSize: 8, PointerCount: 2})
+	return Feature(st), err
+}
+
+func ReadRootFeature(msg *capnp.Message) (Feature, error) {
+	root, err := msg.Root()
+	return Feature(root.Struct()), err
+}
+
+func (s Feature) String() string {
+	str, _ := text.Marshal(0xe9d0d03649f7a645, capnp.Struct(s))
+	return str
+}
+
+func (s Feature) EncodeAsPtr(seg *capnp.Segment) capnp.Ptr {
+	return capnp.Struct(s).EncodeAsPtr(seg)
+}
+
+func (Feature) DecodeFromPtr(p capnp.Ptr) Feature {
+	return Feature(capnp.Struct{}.DecodeFromPtr(p))
+}
+
+func (s Feature) ToPtr() capnp.Ptr {
+	return capnp.Struct(s).ToPtr()
+}
+func (s Feature) IsValid() bool {
+	return capnp.Struct(s).IsValid()
+}
+
+func (s Feature) Message() *capnp.Message {
+	return capnp.Struct(s).Message()
+}
+
+func (s Feature) Segment() *capnp.Segment {
+	return capnp.Struct(s).Segment()
+}
+func (s Feature) Type() FeatureType {
+	return FeatureType(capnp.Struct(s).Uint16(0))
+}
+
+func (s Feature) SetType(v FeatureType) {
+	capnp.Struct(s).SetUint16(0, uint16(v))
+}
+
+func (s Feature) Value() (string, error) {
+	p, err := capnp.Struct(s).Ptr(0)
+	return p.Text(), err
+}
+
+func (s Feature) HasValue() bool {
+	return capnp.Struct(s).HasPtr(0)
+}
+
+func (s Feature) ValueBytes() ([]byte, error) {
+	p, err := capnp.Struct(s).Ptr(0)
+	return p.TextBytes(), err
+}
+
+func (s Feature) SetValue(v string) error {
+	return capnp.Struct(s).SetText(0, v)
 }
 
-// Way_Future is a wrapper for a Way promised by a client call.
-type Way_Future struct{ *capnp.Future }
+func (s Feature) NodeIndex() uint32 {
+	return capnp.Struct(s).Uint32(4)
+}
 
-func (f Way_Future) Struct() (Way, error) {
+func (s Feature) SetNodeIndex(v uint32) {
+	capnp.Struct(s).SetUint32(4, v)
+}
+
+func (s Feature) Direction() (string, error) {
+	p, err := capnp.Struct(s).Ptr(1)
+	return p.Text(), err
+}
+
+func (s Feature) HasDirection() bool {
+	return capnp.Struct(s).HasPtr(1)
+}
+
+func (s Feature) DirectionBytes() ([]byte, error) {
+	p, err := capnp.Struct(s).Ptr(1)
+	return p.TextBytes(), err
+}
+
+func (s Feature) SetDirection(v string) error {
+	return capnp.Struct(s).SetText(1, v)
+}
+
+// Feature_List is a list of Feature.
+type Feature_List = capnp.StructList[Feature]
+
+// NewFeature creates a new list of Feature.
+func NewFeature_List(s *capnp.Segment, sz int32) (Feature_List, error) {
+	l, err := capnp.NewCompositeList(s, capnp.ObjectSize{DataSize: 8, PointerCount: 2}, sz)
+	return capnp.StructList[Feature](l), err
+}
+
+// Feature_Future is a wrapper for a Feature promised by a client call.
+type Feature_Future struct{ *capnp.Future }
+
+func (f Feature_Future) Struct() (Feature, error) {
 	p, err := f.Future.Ptr()
-	return Way(p.Struct()), err
+	return Feature(p.Struct()), err
+}
+
+type HazardType uint16
+
+// HazardType_TypeID is the unique identifier for the type HazardType.
+const HazardType_TypeID = 0xfc0d939c8fbfd66c
+
+// Values of HazardType.
+const (
+	HazardType_other             HazardType = 0
+	HazardType_curve             HazardType = 1
+	HazardType_animalCrossing    HazardType = 2
+	HazardType_schoolZone        HazardType = 3
+	HazardType_ice               HazardType = 4
+	HazardType_fallingRocks      HazardType = 5
+	HazardType_slippery          HazardType = 6
+	HazardType_unevenRoad        HazardType = 7
+	HazardType_pedestrians       HazardType = 8
+	HazardType_cyclists          HazardType = 9
+	HazardType_roadworks         HazardType = 10
+	HazardType_roadNarrows       HazardType = 11
+	HazardType_dangerousJunction HazardType = 12
+	HazardType_sideWinds         HazardType = 13
+	HazardType_fog               HazardType = 14
+	HazardType_flooding          HazardType = 15
+	HazardType_queuesLikely      HazardType = 16
+)
+
+// String returns the enum's constant name.
+func (c HazardType) String() string {
+	switch c {
+	case HazardType_other:
+		return "other"
+	case HazardType_curve:
+		return "curve"
+	case HazardType_animalCrossing:
+		return "animalCrossing"
+	case HazardType_schoolZone:
+		return "schoolZone"
+	case HazardType_ice:
+		return "ice"
+	case HazardType_fallingRocks:
+		return "fallingRocks"
+	case HazardType_slippery:
+		return "slippery"
+	case HazardType_unevenRoad:
+		return "unevenRoad"
+	case HazardType_pedestrians:
+		return "pedestrians"
+	case HazardType_cyclists:
+		return "cyclists"
+	case HazardType_roadworks:
+		return "roadworks"
+	case HazardType_roadNarrows:
+		return "roadNarrows"
+	case HazardType_dangerousJunction:
+		return "dangerousJunction"
+	case HazardType_sideWinds:
+		return "sideWinds"
+	case HazardType_fog:
+		return "fog"
+	case HazardType_flooding:
+		return "flooding"
+	case HazardType_queuesLikely:
+		return "queuesLikely"
+
+	default:
+		return ""
+	}
 }
 
-type Coordinates capnp.Struct
+// HazardTypeFromString returns the enum value with a name,
+// or the zero value if there's no such value.
+func HazardTypeFromString(c string) HazardType {
+	switch c {
+	case "other":
+		return HazardType_other
+	case "curve":
+		return HazardType_curve
+	case "animalCrossing":
+		return HazardType_animalCrossing
+	case "schoolZone":
+		return HazardType_schoolZone
+	case "ice":
+		return HazardType_ice
+	case "fallingRocks":
+		return HazardType_fallingRocks
+	case "slippery":
+		return HazardType_slippery
+	case "unevenRoad":
+		return HazardType_unevenRoad
+	case "pedestrians":
+		return HazardType_pedestrians
+	case "cyclists":
+		return HazardType_cyclists
+	case "roadworks":
+		return HazardType_roadworks
+	case "roadNarrows":
+		return HazardType_roadNarrows
+	case "dangerousJunction":
+		return HazardType_dangerousJunction
+	case "sideWinds":
+		return HazardType_sideWinds
+	case "fog":
+		return HazardType_fog
+	case "flooding":
+		return HazardType_flooding
+	case "queuesLikely":
+		return HazardType_queuesLikely
+
+	default:
+		return 0
+	}
+}
 
-// Coordinates_TypeID is the unique identifier for the type Coordinates.
-const Coordinates_TypeID = 0x922b57c60c6a46d1
+type HazardType_List = capnp.EnumList[HazardType]
 
-func NewCoordinates(s *capnp.Segment) (Coordinates, error) {
-	st, err := capnp.NewStruct(s, capnp.ObjectSize{DataSize: 16, PointerCount: 0})
-	return Coordinates(st), err
+func NewHazardType_List(s *capnp.Segment, sz int32) (HazardType_List, error) {
+	return capnp.NewEnumList[HazardType](s, sz)
 }
 
-func NewRootCoordinates(s *capnp.Segment) (Coordinates, error) {
-	st, err := capnp.NewRootStruct(s, capnp.ObjectSize{DataSize: 16, PointerCount: 0})
-	return Coordinates(st), err
+type WayHazard capnp.Struct
+
+// WayHazard_TypeID is the unique identifier for the type WayHazard.
+const WayHazard_TypeID = 0x8b30f1f20ea044fa
+
+func NewWayHazard(s *capnp.Segment) (WayHazard, error) {
+	st, err := capnp.NewStruct(s, capnp.ObjectSize{DataSize: 8, PointerCount: 2})
+	return WayHazard(st), err
 }
 
-func ReadRootCoordinates(msg *capnp.Message) (Coordinates, error) {
+func NewRootWayHazard(s *capnp.Segment) (WayHazard, error) {
+	st, err := capnp.NewRootStruct(s, capnp.ObjectSize{DataSize: 8, PointerCount: 2})
+	return WayHazard(st), err
+}
+
+func ReadRootWayHazard(msg *capnp.Message) (WayHazard, error) {
 	root, err := msg.Root()
-	return Coordinates(root.Struct()), err
+	return WayHazard(root.Struct()), err
 }
 
-func (s Coordinates) String() string {
-	str, _ := text.Marshal(0x922b57c60c6a46d1, capnp.Struct(s))
+func (s WayHazard) String() string {
+	str, _ := text.Marshal(0x8b30f1f20ea044fa, capnp.Struct(s))
 	return str
 }
 
-func (s Coordinates) EncodeAsPtr(seg *capnp.Segment) capnp.Ptr {
+func (s WayHazard) EncodeAsPtr(seg *capnp.Segment) capnp.Ptr {
 	return capnp.Struct(s).EncodeAsPtr(seg)
 }
 
-func (Coordinates) DecodeFromPtr(p capnp.Ptr) Coordinates {
-	return Coordinates(capnp.Struct{}.DecodeFromPtr(p))
+func (WayHazard) DecodeFromPtr(p capnp.Ptr) WayHazard {
+	return WayHazard(capnp.Struct{}.DecodeFromPtr(p))
 }
 
-func (s Coordinates) ToPtr() capnp.Ptr {
+func (s WayHazard) ToPtr() capnp.Ptr {
 	return capnp.Struct(s).ToPtr()
 }
-func (s Coordinates) IsValid() bool {
+func (s WayHazard) IsValid() bool {
 	return capnp.Struct(s).IsValid()
 }
 
-func (s Coordinates) Message() *capnp.Message {
+func (s WayHazard) Message() *capnp.Message {
 	return capnp.Struct(s).Message()
 }
 
-func (s Coordinates) Segment() *capnp.Segment {
+func (s WayHazard) Segment() *capnp.Segment {
 	return capnp.Struct(s).Segment()
 }
-func (s Coordinates) Latitude() float64 {
-	return math.Float64frombits(capnp.Struct(s).Uint64(0))
+func (s WayHazard) Type() HazardType {
+	return HazardType(capnp.Struct(s).Uint16(0))
 }
 
-func (s Coordinates) SetLatitude(v float64) {
-	capnp.Struct(s).SetUint64(0, math.Float64bits(v))
+func (s WayHazard) SetType(v HazardType) {
+	capnp.Struct(s).SetUint16(0, uint16(v))
 }
 
-func (s Coordinates) Longitude() float64 {
+func (s WayHazard) Value() (string, error) {
+	p, err := capnp.Struct(s).Ptr(0)
+	return p.Text(), err
+}
+
+func (s WayHazard) HasValue() bool {
+	return capnp.Struct(s).HasPtr(0)
+}
+
+func (s WayHazard) ValueBytes() ([]byte, error) {
+	p, err := capnp.Struct(s).Ptr(0)
+	return p.TextBytes(), err
+}
+
+func (s WayHazard) SetValue(v string) error {
+	return capnp.Struct(s).SetText(0, v)
+}
+
+func (s WayHazard) OnNode() bool {
+	return capnp.Struct(s).Bit(16)
+}
+
+func (s WayHazard) SetOnNode(v bool) {
+	capnp.Struct(s).SetBit(16, v)
+}
+
+func (s WayHazard) NodeIndex() uint32 {
+	return capnp.Struct(s).Uint32(4)
+}
+
+func (s WayHazard) SetNodeIndex(v uint32) {
+	capnp.Struct(s).SetUint32(4, v)
+}
+
+func (s WayHazard) Direction() (string, error) {
+	p, err := capnp.Struct(s).Ptr(1)
+	return p.Text(), err
+}
+
+func (s WayHazard) HasDirection() bool {
+	return capnp.Struct(s).HasPtr(1)
+}
+
+func (s WayHazard) DirectionBytes() ([]byte, error) {
+	p, err := capnp.Struct(s).Ptr(1)
+	return p.TextBytes(), err
+}
+
+func (s WayHazard) SetDirection(v string) error {
+	return capnp.Struct(s).SetText(1, v)
+}
+
+// WayHazard_List is a list of WayHazard.
+type WayHazard_List = capnp.StructList[WayHazard]
+
+// NewWayHazard creates a new list of WayHazard.
+func NewWayHazard_List(s *capnp.Segment, sz int32) (WayHazard_List, error) {
+	l, err := capnp.NewCompositeList(s, capnp.ObjectSize{DataSize: 8, PointerCount: 2}, sz)
+	return capnp.StructList[WayHazard](l), err
+}
+
+// WayHazard_Future is a wrapper for a WayHazard promised by a client call.
+type WayHazard_Future struct{ *capnp.Future }
+
+func (f WayHazard_Future) Struct() (WayHazard, error) {
+	p, err := f.Future.Ptr()
+	return WayHazard(p.Struct()), err
+}
+
+type SpeedCamera capnp.Struct
+
+// SpeedCamera_TypeID is the unique identifier for the type SpeedCamera.
+const SpeedCamera_TypeID = 0xa9fca57688807689
+
+func NewSpeedCamera(s *capnp.Segment) (SpeedCamera, error) {
+	st, err := capnp.NewStruct(s, capnp.ObjectSize{DataSize: 64, PointerCount: 1})
+	return SpeedCamera(st), err
+}
+
+func NewRootSpeedCamera(s *capnp.Segment) (SpeedCamera, error) {
+	st, err := capnp.NewRootStruct(s, capnp.ObjectSize{DataSize: 64, PointerCount: 1})
+	return SpeedCamera(st), err
+}
+
+func ReadRootSpeedCamera(msg *capnp.Message) (SpeedCamera, error) {
+	root, err := msg.Root()
+	return SpeedCamera(root.Struct()), err
+}
+
+func (s SpeedCamera) String() string {
+	str, _ := text.Marshal(0xa9fca57688807689, capnp.Struct(s))
+	return str
+}
+
+func (s SpeedCamera) EncodeAsPtr(seg *capnp.Segment) capnp.Ptr {
+	return capnp.Struct(s).EncodeAsPtr(seg)
+}
+
+func (SpeedCamera) DecodeFromPtr(p capnp.Ptr) SpeedCamera {
+	return SpeedCamera(capnp.Struct{}.DecodeFromPtr(p))
+}
+
+func (s SpeedCamera) ToPtr() capnp.Ptr {
+	return capnp.Struct(s).ToPtr()
+}
+func (s SpeedCamera) IsValid() bool {
+	return capnp.Struct(s).IsValid()
+}
+
+func (s SpeedCamera) Message() *capnp.Message {
+	return capnp.Struct(s).Message()
+}
+
+func (s SpeedCamera) Segment() *capnp.Segment {
+	return capnp.Struct(s).Segment()
+}
+func (s SpeedCamera) Id() int64 {
+	return int64(capnp.Struct(s).Uint64(0))
+}
+
+func (s SpeedCamera) SetId(v int64) {
+	capnp.Struct(s).SetUint64(0, uint64(v))
+}
+
+func (s SpeedCamera) Latitude() float64 {
 	return math.Float64frombits(capnp.Struct(s).Uint64(8))
 }
 
-func (s Coordinates) SetLongitude(v float64) {
+func (s SpeedCamera) SetLatitude(v float64) {
 	capnp.Struct(s).SetUint64(8, math.Float64bits(v))
 }
 
-// Coordinates_List is a list of Coordinates.
-type Coordinates_List = capnp.StructList[Coordinates]
+func (s SpeedCamera) Longitude() float64 {
+	return math.Float64frombits(capnp.Struct(s).Uint64(16))
+}
 
-// NewCoordinates creates a new list of Coordinates.
-func NewCoordinates_List(s *capnp.Segment, sz int32) (Coordinates_List, error) {
-	l, err := capnp.NewCompositeList(s, capnp.ObjectSize{DataSize: 16, PointerCount: 0}, sz)
-	return capnp.StructList[Coordinates](l), err
+func (s SpeedCamera) SetLongitude(v float64) {
+	capnp.Struct(s).SetUint64(16, math.Float64bits(v))
 }
 
-// Coordinates_Future is a wrapper for a Coordinates promised by a client call.
-type Coordinates_Future struct{ *capnp.Future }
+func (s SpeedCamera) MaxSpeed() float64 {
+	return math.Float64frombits(capnp.Struct(s).Uint64(24))
+}
 
-func (f Coordinates_Future) Struct() (Coordinates, error) {
+func (s SpeedCamera) SetMaxSpeed(v float64) {
+	capnp.Struct(s).SetUint64(24, math.Float64bits(v))
+}
+
+func (s SpeedCamera) Bearing() float64 {
+	return math.Float64frombits(capnp.Struct(s).Uint64(32))
+}
+
+func (s SpeedCamera) SetBearing(v float64) {
+	capnp.Struct(s).SetUint64(32, math.Float64bits(v))
+}
+
+func (s SpeedCamera) HasBearing() bool {
+	return capnp.Struct(s).Bit(320)
+}
+
+func (s SpeedCamera) SetHasBearing(v bool) {
+	capnp.Struct(s).SetBit(320, v)
+}
+
+func (s SpeedCamera) Enforcement() (string, error) {
+	p, err := capnp.Struct(s).Ptr(0)
+	return p.Text(), err
+}
+
+func (s SpeedCamera) HasEnforcement() bool {
+	return capnp.Struct(s).HasPtr(0)
+}
+
+func (s SpeedCamera) EnforcementBytes() ([]byte, error) {
+	p, err := capnp.Struct(s).Ptr(0)
+	return p.TextBytes(), err
+}
+
+func (s SpeedCamera) SetEnforcement(v string) error {
+	return capnp.Struct(s).SetText(0, v)
+}
+
+func (s SpeedCamera) ZoneEndLatitude() float64 {
+	return math.Float64frombits(capnp.Struct(s).Uint64(48))
+}
+
+func (s SpeedCamera) SetZoneEndLatitude(v float64) {
+	capnp.Struct(s).SetUint64(48, math.Float64bits(v))
+}
+
+func (s SpeedCamera) ZoneEndLongitude() float64 {
+	return math.Float64frombits(capnp.Struct(s).Uint64(56))
+}
+
+func (s SpeedCamera) SetZoneEndLongitude(v float64) {
+	capnp.Struct(s).SetUint64(56, math.Float64bits(v))
+}
+
+// SpeedCamera_List is a list of SpeedCamera.
+type SpeedCamera_List = capnp.StructList[SpeedCamera]
+
+// NewSpeedCamera creates a new list of SpeedCamera.
+func NewSpeedCamera_List(s *capnp.Segment, sz int32) (SpeedCamera_List, error) {
+	l, err := capnp.NewCompositeList(s, capnp.ObjectSize{DataSize: 64, PointerCount: 1}, sz)
+	return capnp.StructList[SpeedCamera](l), err
+}
+
+// SpeedCamera_Future is a wrapper for a SpeedCamera promised by a client call.
+type SpeedCamera_Future struct{ *capnp.Future }
+
+func (f SpeedCamera_Future) Struct() (SpeedCamera, error) {
 	p, err := f.Future.Ptr()
-	return Coordinates(p.Struct()), err
+	return SpeedCamera(p.Struct()), err
+}
+
+type CoordinateEncoding uint16
+
+// CoordinateEncoding_TypeID is the unique identifier for the type CoordinateEncoding.
+const CoordinateEncoding_TypeID = 0xc9abc5600f629aff
+
+// Values of CoordinateEncoding.
+const (
+	CoordinateEncoding_float64  CoordinateEncoding = 0
+	CoordinateEncoding_delta1e7 CoordinateEncoding = 1
+)
+
+// String returns the enum's constant name.
+func (c CoordinateEncoding) String() string {
+	switch c {
+	case CoordinateEncoding_float64:
+		return "float64"
+	case CoordinateEncoding_delta1e7:
+		return "delta1e7"
+
+	default:
+		return ""
+	}
+}
+
+// CoordinateEncodingFromString returns the enum value with a name,
+// or the zero value if there's no such value.
+func CoordinateEncodingFromString(c string) CoordinateEncoding {
+	switch c {
+	case "float64":
+		return CoordinateEncoding_float64
+	case "delta1e7":
+		return CoordinateEncoding_delta1e7
+
+	default:
+		return 0
+	}
+}
+
+type CoordinateEncoding_List = capnp.EnumList[CoordinateEncoding]
+
+func NewCoordinateEncoding_List(s *capnp.Segment, sz int32) (CoordinateEncoding_List, error) {
+	return capnp.NewEnumList[CoordinateEncoding](s, sz)
 }
 
 type Offline capnp.Struct
@@ -348,12 +1383,12 @@ type Offline capnp.Struct
 const Offline_TypeID = 0xcb5ff253617678e0
 
 func NewOffline(s *capnp.Segment) (Offline, error) {
-	st, err := capnp.NewStruct(s, capnp.ObjectSize{DataSize: 40, PointerCount: 1})
+	st, err := capnp.NewStruct(s, capnp.ObjectSize{DataSize: 72, PointerCount: 3})
 	return Offline(st), err
 }
 
 func NewRootOffline(s *capnp.Segment) (Offline, error) {
-	st, err := capnp.NewRootStruct(s, capnp.ObjectSize{DataSize: 40, PointerCount: 1})
+	st, err := capnp.NewRootStruct(s, capnp.ObjectSize{DataSize: 72, PointerCount: 3})
 	return Offline(st), err
 }
 
@@ -452,12 +1487,93 @@ func (s Offline) SetOverlap(v float64) {
 	capnp.Struct(s).SetUint64(32, math.Float64bits(v))
 }
 
+func (s Offline) SpeedCameras() (SpeedCamera_List, error) {
+	p, err := capnp.Struct(s).Ptr(1)
+	return SpeedCamera_List(p.List()), err
+}
+
+func (s Offline) HasSpeedCameras() bool {
+	return capnp.Struct(s).HasPtr(1)
+}
+
+func (s Offline) SetSpeedCameras(v SpeedCamera_List) error {
+	return capnp.Struct(s).SetPtr(1, v.ToPtr())
+}
+
+// NewSpeedCameras sets the speedCameras field to a newly
+// allocated SpeedCamera_List, preferring placement in s's segment.
+func (s Offline) NewSpeedCameras(n int32) (SpeedCamera_List, error) {
+	l, err := NewSpeedCamera_List(capnp.Struct(s).Segment(), n)
+	if err != nil {
+		return SpeedCamera_List{}, err
+	}
+	err = capnp.Struct(s).SetPtr(1, l.ToPtr())
+	return l, err
+}
+func (s Offline) SchemaVersion() uint32 {
+	return capnp.Struct(s).Uint32(40)
+}
+
+func (s Offline) SetSchemaVersion(v uint32) {
+	capnp.Struct(s).SetUint32(40, v)
+}
+
+func (s Offline) MinReaderVersion() uint32 {
+	return capnp.Struct(s).Uint32(44)
+}
+
+func (s Offline) SetMinReaderVersion(v uint32) {
+	capnp.Struct(s).SetUint32(44, v)
+}
+
+func (s Offline) GeneratorVersion() (string, error) {
+	p, err := capnp.Struct(s).Ptr(2)
+	return p.Text(), err
+}
+
+func (s Offline) HasGeneratorVersion() bool {
+	return capnp.Struct(s).HasPtr(2)
+}
+
+func (s Offline) GeneratorVersionBytes() ([]byte, error) {
+	p, err := capnp.Struct(s).Ptr(2)
+	return p.TextBytes(), err
+}
+
+func (s Offline) SetGeneratorVersion(v string) error {
+	return capnp.Struct(s).SetText(2, v)
+}
+
+func (s Offline) SourceTimestamp() int64 {
+	return int64(capnp.Struct(s).Uint64(48))
+}
+
+func (s Offline) SetSourceTimestamp(v int64) {
+	capnp.Struct(s).SetUint64(48, uint64(v))
+}
+
+func (s Offline) ReplicationSequence() int64 {
+	return int64(capnp.Struct(s).Uint64(56))
+}
+
+func (s Offline) SetReplicationSequence(v int64) {
+	capnp.Struct(s).SetUint64(56, uint64(v))
+}
+
+func (s Offline) CoordinateEncoding() CoordinateEncoding {
+	return CoordinateEncoding(capnp.Struct(s).Uint16(64))
+}
+
+func (s Offline) SetCoordinateEncoding(v CoordinateEncoding) {
+	capnp.Struct(s).SetUint16(64, uint16(v))
+}
+
 // Offline_List is a list of Offline.
 type Offline_List = capnp.StructList[Offline]
 
 // NewOffline creates a new list of Offline.
 func NewOffline_List(s *capnp.Segment, sz int32) (Offline_List, error) {
-	l, err := capnp.NewCompositeList(s, capnp.ObjectSize{DataSize: 40, PointerCount: 1}, sz)
+	l, err := capnp.NewCompositeList(s, capnp.ObjectSize{DataSize: 72, PointerCount: 3}, sz)
 	return capnp.StructList[Offline](l), err
 }
 
@@ -469,63 +1585,171 @@ func (f Offline_Future) Struct() (Offline, error) {
 	return Offline(p.Struct()), err
 }
 
-const schema_da3a0d9284ca402f = "x\xda\xa4\xd4Mh\x1ce\x18\x07\xf0\xff\xffyg6" +
-	"\x9b\xecG2\xbcs\x10\xa9D\xa5BZ\xad&\x1aA" +
-	"\x82\xd2P\xa1h\x09\x98\xc9 \xf1 \xc8KfbW" +
-	"73a\xb2&\x1b/\x82\x88\xa8\xe0\xc1EDA\xa1" +
-	"B\x04\x05O\x1eD\x0f\x82\x07\xf5PO\xf6\xe8\xc9\x83" +
-	"\x07\x05\x0bVZ\xecA]y\xa6\xdd\x8f\xe0\xc7\xa5\xb7" +
-	"y\x7f\xcf\xb3\xef\xf3\xb2\xef\xfc\xe7VY\xf6\x16\x1a\xb9" +
-	"@\xa2#~\xa5\xff\xdd\xe9g\xea\xdf\xac\xdf\xd9C\xd4" +
-	"\xa4\xf4\xefY>\xffR\xaf\xb1\xf4=\xbc\x09\xc0\xde\xc2" +
-	"\x0b\xf6\x18\xf5\xe9\x0e\xee\x81\x7f\xbd\xf5\xe9\xcb\xbd\xaf?" +
-	"?\x88\x9al\x8c:\xfd\xb2\xf5U\xf6\xec\x1b\xdaz\xdf" +
-	"\xeb\xfc\xdd\x80\xfd\x1f\xba\xbb.\xfe\xed\xa9ou_\x7f" +
-	"\xac\xbb\xdc\xee\xa2\xff\x89\xbd\xe2k\xf7%\x7f\x9d8\xd1" +
-	"\xcf77\xdb\xad,\xbd[6\xdcv\xb6\xbd\xf4p\x9e" +
-	"\x17I+s\x9d\x94;\xabdT5\x1e\xe0\x11\x08\x8e" +
-	"\x9d\x01\xa29\xc3hQ\x18\x90!\x15\x17\xd6\x80h\xde" +
-	"0zP\xd8o\xbbN\xab\xf3\\\x92\x02`\x0d\xc2\x1a" +
-	"\xd8o\xe7\xd9\xd3\x8a`:\xb4\xc1H^\x1b\xb9\xee\xb8" +
-	"\xaf\xa3\x1e\x19\x8c\xb2?\xf3f \xfe\x91\x86\xf1\xaf\x14" +
-	"^\x1ff/\xf28\x10\xff\xa4|\x99\xc2@\x18R\x00" +
-	"{\x89\xb7\x03\xf1/\xeaW\xd5\x0dC\x1a\xc0^\xe1\x19" +
-	" \xbeL\xc35\x11\x06\x9e\x84\xf4\x00\xfb'\x97\x80\xf8" +
-	"\xaa\xb6{\xea\xbe\x09\xe9\x03\x96\xa2\xfe\x87zU\xbd\xe2" +
-	"\x85\xac\x00\xd6W_\x13\xc3\xb8\xae<\xe1\x87\xe5?9" +
-	"Y\xb6{\xea3\xeaU\x09Y\x05lC\xee\x05\xe2\xaa" +
-	"\xfaQ\xf5\xc9\xf9\x90\x93\x80\xbd\xad\xf4#\xeas\xeaS" +
-	"\x13!\xa7\xf4\x82\xa5\x00\xe2\xa3\xea\xf3\xea5\x13\xb2\x06" +
-	"\xd8\x13\xe5\xfes\xea\x8b\"\\\xa8\xbf\xc2\x90u\xc0." +
-	"\x94\x85\xbb\xb4\xf0\x80\xfe\xa0Q\x0d\xd9\x00\xec\xfd\xf2\"" +
-	"\x10/\xaa/\xab7'C6\x01\xfb\x90\xbc\x06\xc4\xcb" +
-	"\xea+\xea\xd3S!\xa7\x01\xfb\xa8\xf4\x80xE\xfd\x09" +
-	"\xf5\x99Z\xc8\x19\xc0>.\xe7\x81\xf8I\xf5\xb3\xeaA" +
-	"=d\x00\xd8T.\x00q[\xbd+B\xd3J\xe8C" +
-	"\xe8\x83\xd3\x99\xdbJY\x87\xb0\x0eN\x14\xe9\xe6\xe0\xb9" +
-	"\xbf\xe5\xba\xf1v\x9a&c\xaf\xc4\xc9\xadV\xb6\xe2:" +
-	"\x87\x96y6Z\xba\xee\xa1\xaa\xeb\x8eUg\xb3<I" +
-	"w\xd8\x04W\x0d93\x8a\x10\xa88\xdbvY\xba\xc3" +
-	"\x0a\x84\x15\xb0\xef\x92\xdd\xd6N^\xecc\xb6<\xc3p" +
-	"\xcf\xb3\xeeyW$\x833\x9e\xcc\xb3t\xdd\xed\x93\x10" +
-	"r\xec\xc8<\x9d\x17{\xaeHF\xef\xf2\xb0r\xcam" +
-	"<[\x96\xfe\xa5\xb6Z\xb8\x8dNk\xc3\xb1\xfd\x8f\x9a" +
-	"\x0cj\xed\xc1\xd6\xf8\x9f\x9e\xebC\x98\xfcWn\x1e\xdb" +
-	"\x9c-\xd7\x9a\x9d\x9b\x861}g\x09\x88\xde4\x8c\xce" +
-	"\x8d\xc5\xf4=\xc5\xb7\x0d\xa3\x03\x8d\x8d\x94\xb1\x09\xdeW" +
-	"|\xd70\xfaP3c\xca\xcc\x04\x1f(\x9e3\x8c>" +
-	"\x16\xd2+\x03\x13|t\x1c\x88\x0e\x0c\xa3/5-^" +
-	"\x99\x96\xe0\x8bS@\xf4\x99a\xf4\x95\xdc\xd0\x95N\xef" +
-	"\xb9\xfd\xd1\x8d\x0e>t\xd7\xee\xf3\x85|7-\xdan" +
-	"{\xd0\xfbw\x00\x00\x00\xff\xffG\xab\xff\xcf"
+const schema_da3a0d9284ca402f = "x\xda\xa4\x97\x7fl\x1c\xc5\x15\xc7\xdf\xdb\xd9\xf3\xd9\xbe" +
+	"\xf3\x9d\xd7\xbb@\x08\x09\x07\xa8H\x14D\x8b\x93\xf0\xa3" +
+	"\xf9\xc74\x89\xa3b9\xd4\xeb5$\xa0\xa0z|;" +
+	"w\xb7\xc9\xde\xeeew\xcf\xf1YA\x81*T\x0e\x14" +
+	"\x15\xdc\xb4\x02\x94\xa8\x01A\x05*-\x02A\x05R\xa3" +
+	"\x96\x8aT!\xfd\xa3$\x8a\x0a\xaaZ5\x95\xa8\x1a\xfa" +
+	"CJ(\xa8?\x94v\xab7\xeb\xdb\xbb\x98\xb4\xaa\xda" +
+	"\xff\xf6>\xef\xcd\xdc\x9b\xf7f\xbeo\xe6\xa6\xf72\xb7" +
+	"\xab\xc3\x03\xef\xaa\xa0\x98\xb7ez\xe2\xbfo:\\\xf8" +
+	"\xf0\xdcM\x8f\x80Y@\x8c?{\xfb\xf1}\x8b\x03\xeb" +
+	"\x7f\x01\x19%\x0b\xa0\x9b\xca\x8f\xf5{\xe8k\xed]J" +
+	"\x09\x01\xe3\x13\x9bw\xe4\x7f\xb2\xf5\x86E\xf2f\x1do" +
+	"\x95\x9c\xeb\xec\xa4\xdeb\xf4\xd5d/\x01\xfe\xf3\x9b\xdf" +
+	"\xff\xca\xe2\xd17\x9e5\x0b8\xd05\xef\x009\\\xae" +
+	".\xeaW\xd3\xa0\xb5\xab\xd5\x9f\xf5\x00\xc6\xfbg\x1fX" +
+	"\x98}\xee\xfc\x0b4oo\x977\x92\xf7\x07\xb9\x93\xfa" +
+	"\xc79\xf2>\x97\x8b)\x8a\xf8\xa9\x99\xe2\xf4\xd1\xef\xbc" +
+	"\x0dZA\xe98\x03\xae\xd5\x0a\xfd\xa8_]\xa0A\xab" +
+	"\x0b\xb7\x02\xc6\xa7\xe7f\xb9\xf5\xe1\x97~J\xf3\xf6u" +
+	"\xcd+\xc3\xbc\xb6\xf0\x8a~#9\xaf\xfdt\xe1\xd7\x0a" +
+	"`<\xfa\xed\xbf\xdcq\xcb;\xef|p\xd1\\\x08\xed" +
+	"\x15\xbd\xae\xd1\x97\xa3\xfd\x0e\xf0\x1f\xb9\xfau\xdf{\xf6" +
+	"\xdd?/\x0bA\x1f\x1d:\xa9\x9bC\xe4\xb6e\xe8%" +
+	"\xc0\xf8\xb5\x1b\xfe0\xf2\xf6\x0b\xbf\xffx\xf9\x9c\x19r" +
+	"yc\xe8\x19\xfdMr^{dh+\xad\xcc\xfd\xf9" +
+	"\x0f\xbfv\xf0\xeb\x03\xe7\xe1\x13\xd3\x1a\xc7u\xd3 \xcf" +
+	"-\xc6\xb7\x10n\x8c\xfdJ\xc5u<\xf1\x19\xa5\xcc\x1b" +
+	"^c\xfdV\xde\xfa\x02\x9f\xe7\x81\x0d\x13\x88\xa6\xc1T" +
+	"\x00\x15\x01\xb4\xfb\xaf\x070\xe7\x18\x9a\xfb\x14D4\x90" +
+	"\xd8\x83k\x00\xcc=\x0c\xcd\x05\x055e\xd0@\x05@" +
+	"{h=\x80\xf9\x00C\xf3\xab\x0aj\x0c\x0dd\x00\xda" +
+	"\xfeI\x00s\x81\xa1y@AME\x03U\x00\xedq" +
+	"\x82\x8f14\x0f*X\x8cZ\x0d\x81\xc5N\xdc\x80X" +
+	"\x04,\xcdr\xb7)0\x0f\x0a\xe6\x01G|\xefN\xdf" +
+	"\x16\x88\xa0 -\xd2\xf3mq\x87g\x0b\xc09\xec\x05" +
+	"\x05{\x01c\xdb\x09D9r|@\xaf=l\xf9\x12" +
+	"7\xfa~`;\x1e\x8f\x04\x86\xb4\xc8|\xba\xc8\xd11" +
+	"\x00s\x13CsBA\xad\xbd\xca-\x14\xe68Cs" +
+	"\x1b\xadRMVy\x17\xc1)\x86\xe6\xb4\x82\xb1\xcb#" +
+	"'j\xda\x02\x000\x07\x0a\xe6\xa8\x00\xbeW%\x08(" +
+	"R&\\1\xcb\x97b\xeb\x07\x05\xfb\xbbb\xc3v\xfa" +
+	"\xb1E1\xedi\xc7\xa4\xdf\xc5V\x02X\x13\x8c\xa1\xb5" +
+	"\x9d\xa5\xb9\xd7\xefa\xd7\x03XS\x84\xa7\x19\x05\x862" +
+	"0\xfd>v\x0d\x80\xb5\x8d\xb8\xcd:\x15\xd09\x1b\x03" +
+	"\xb0\xa6\x89\xbb\xc4UE\x16Aw\xd8z\x00\xcb&\xde" +
+	" \x9ea\x06f\xe4!$^#\x1e\x11\xefQ\x0d\xec" +
+	"\x01\xd0wI\xee\x12\x9f#\x9e\xcd\x18\x98\x1cU\xe2\x0d" +
+	"\xe2{\x88\xf7*\x06\xf6\x02\xe8-\xb6\x06\xc0\x8a\x88?" +
+	"F\xbc\xef&\x03\xfb\x00\xf4G%_ ~\x80x\x7f" +
+	"\xd6\xc0~\x00\xfdq\x16\x00X\x8f\x11?H<\xc7\x0c" +
+	"\xcc\x01\xe8O\xca\xf9\x0f\x10?\xcc\x14\x1c\xce/\xa0\x81" +
+	"y\x00\xfd\x904<A\x86gi\xc0@\xaf\x81\x03\x00" +
+	"\xfa\xd3\xec\xcb\x00\xd6a\xe2/\x12/\xf4\x19X\x00\xd0" +
+	"_`\x0f\x03X/\x12\x7f\x9dx\xb1\xdf\xc0\"\x80\xfe" +
+	"\x1a[\x04\xb0^'\xfe\x16\xf1\xc1\x9c\x81\x83\x00\xfa\x9b" +
+	"\xec8\x80u\x8c\xf8)\xe2Z\xde@\x0d@?\xc1N" +
+	"\x02X\xef\x11\x7f\x9f\xf8\x90j\xe0\x10\x80\xfe\x1b\x99\xe8" +
+	"\xd3\xc4\xffH\x81\xea\xfb\xd1@\x9d\xd4\x87\xed\x00\xb0\xce" +
+	"\x90\xe1#\x1a`d\x0c4\x00\xf4sr\xc0Y\xe2y" +
+	"UA\xed\x92\x1e\x03/\x01\xd0\xfb\xd4\x0d\x00\x96\xaa2" +
+	"\xb4\xae\"~i\xd6\xc0KI\x90\xd4{\x01\xacU\xc4" +
+	"o#~Y\xaf\x81\x97\x01\xe87\xab\xf3\x00\xd6:\xe2" +
+	"\x13\xc4W\xf4\x19\xb8\x82\xe4C\xa5\xff\x1d'\xbe\x8d\xf8" +
+	"\xe5\xfd\x06^N\x1bK\xa5LO\x11\x9fV\x15\x1c^" +
+	"\xf90\x1a\xb8\x92\xb6\x90J\x19\xddF\x06\x9b\x0cW<" +
+	"\x82\x06^A{H\x1a\xb6\x93\xa1F3\xadZc\xe0" +
+	"*R4\x95j9M\xdc%\xbe:g\xe0j\xda[" +
+	"r\x056\xf1\x06\xf1+\xf3\x06^I{K\xae\xc0%" +
+	">\xa7*\xc8\x1c\x1b3\xa0`\x06\xb0\xe8\xf1zz\xdc" +
+	"\xb3\x81\xa8\xb4\xbf\xe3:\x9f\xb3\x1aB\xd8]gl\xa4" +
+	"\xeex\xe3<\xba\xe0\xa7\xefu~\xf2\xb9\x0b\xac|\xae" +
+	"\xcbZ\"\xed\x08\xb1\x008\xc1\x10\x07;\xfd\x08\x90`" +
+	"\xc9\xe5\x9e\x08\xb1\x07\x14\xa4\xae\xc2\xedY'\xf4\x83\x16" +
+	"\x94d\x0c\xe9\x9c5\xa9\x94]\xf2$\xb6\xf2V*O" +
+	"\xed\x90q\xb3\x1f\xec&Em\x8f\xebX6\xf0\xf2N" +
+	"i\xba\x88m\"\xe0\xe5\xc8)st?aS\xda6" +
+	"\xb7=5\xfc\x07\x9f\xa5?\xc14\xeexG\xd3#\x8d" +
+	"\xf4\x00 Mp\x8d\x87\xa3\xa4OP$K\xba\x88\x8a" +
+	"\xe0Q3\x10!\xb9\xa6\xd9J\xfb[\x92\xad\xbdI\x1e" +
+	"\xba\xd2\x99^\x06\x12\x07\xa9\xd4\x9b\x84\x1b\x01\xe3\xa9\x97" +
+	"\x0aJj\xa3\x7f\x86\x11\xd2F/\xb5\xf7/\xd9e)" +
+	"6\xfb\x01\x14i\xa58\xd8\xe9\x84\x808\xd8v\xd8\xc0" +
+	"\xcbP\xdayq\x8f\x91\xa8\xe9y\xc2m\xafid&" +
+	"p\xecj\xdaFJ.o\x89\x00\x15PP\x01\xdc\x1b" +
+	"6\x83\x0a/\xa7\x9b0\x0e\xeb\xbe\x1f\xd5<\x01,\x0c" +
+	"\xff]G\x91\x09\xdf\xc8\xeb\"@N\xea\xfd\xa9\xb4\xa3" +
+	"\xfci%\x80y\x86\xa1\xf9QWG9Gm\xe6," +
+	"C\xf3<\x09\xb7\x92t\x94\xbfQG\xf9+CKE" +
+	"\x92m\x96\xc86\xe2\x18\xc0$\x926\x10V\xd5D\xb5" +
+	"\xfbPj\x03\xf1ATp8s;&\xb2=\x80t" +
+	"\xb4\xf2dX\x81\x0abO\xa2\xda\x97\xe0\x0c\x80e\x10" +
+	"\xbe\x8a\xe6\xc9\xf6$\xaa\xbd\x1aI$W\x11\xbf\x8ex" +
+	"o6Q\xedk\x91D\xf2:\xe2\xeb\xf0\x82\x13\xfa_" +
+	"7\xbb\x8b\x1c\xd8\xbd3\x82\x07\x8eWM}j<\xdc" +
+	"@\x08\x98WMw\x9c\xf0*~P\x16u\xc8\x0a/" +
+	"J3>\xef{b\xd4\xb3\xc7\xb1\xfd\xf7\xe9$\xa9e" +
+	")\x08\xd1\x15X\xbbNly\xe7\x1f\xf5\xca\xbe\xedx" +
+	"U\x90\xd7\x9c^Y\x01m\x03\x00\xa2\xd67\x06\xb0\xb7" +
+	"\xe2\xfa<\xbae]l\x0b7\xe2\xc3\xe2V\x00X\xde" +
+	"\xaa\xbfX)\xc9\xdf4\xc1\xba\xb4]\xdf\x87R<)" +
+	"s6vj\xaes\xc9\xb7\x13\xafa\xa7\xec\xba\x90|" +
+	"\x9a\xb8\xdb]xGr\x9bx\x03\x15\xc4\xa5\xc2\xd7\x91" +
+	"\xda~\x8d\xf0>r\xcf\xa8I\xdd\x1f\x94\x1bb\x0f\xf1" +
+	"\x05\xe2=\x98\x14\xfe!$\xf1\xdfG\xfc\xb0,|\x7f" +
+	"R\xf8CH\xe2\x7f\x90\xf8\xf3\xb2\xf0\xb9\xa4\xf0\xcf\xc9" +
+	"\xc2?O\xfcU\xe2}J\xd2\xae_\x96\xfcU\xe2?" +
+	"\"\xde\xdf\x93\xb4\xeb#r\x03\xfd\x80\xf81\xe2\xb9l" +
+	"\xd2\xae\x8f\xe23\xd45\x89\x9f\"\x9e\xbf*\xe9\xd6'" +
+	"\xf0)\x00\xeb\x14\xf1\xd3\xa8\xfc_\x12^\xdc\xcd[\x1d" +
+	"\xc9i\xbf\x12\x96\x14\xc9\x9f\x15\x81\xcb\x1b\xe9F\x08\x97" +
+	"N(\x14E\xd0\x91\xa0\xc1\xce{!\x19\x17\x87\xe5\x9a" +
+	"\xa8\xf3\xbb\x05\x94\x82\x90d\xb0}\xad\xac;\xde\xa4\xe0" +
+	"\xb6\xc0\xe0n!-\x00\xa9\xad*<\x11\xf0\xc8\xef\xb6" +
+	"\xa5\xea\xe17\x83\xb2\x98r\xb0.\xc2\x88\xd7\x1b\x90\x9e" +
+	"\xa3@4\\\xa7\xcc#t|\xcf\x12\xbb\x9a\"\xeb\x95" +
+	"Ej-/\xedTloU:!\xc5\xce\x83%\xb9" +
+	"\x1e/\xdf\x92\x9bEI\xaa5m\xc9\xc1T\x838]" +
+	"\xdd\xb734k\x9d\xab\xbb\xa0\xab\xfb4C\xd3\xed\xdc" +
+	"\x1d5\x87$\xa8\xc6\xd0\x8c\xba\xae\xee\xbb\x086\x18\x9a" +
+	"{\xd2[z\xfb\xc9r\xb1;\xfa\xffz)\xdf\x9c\xf4" +
+	"\x99\xa9V\x03e\xf8\xabdD[\xe6\xe5\x91\xbc\xe3z" +
+	"\x00T\xb4\xcf\xd3\x01e\xda\xe7\x08\xaa\xda\xcd\x01\x00f" +
+	"\xb4\xe11\x00\xec\xd1n|\x18 \x8e\x02^\xa98\xe5" +
+	"\x8d0\xc2\xdd\xba\xe3U\x8ba\xe47\xf6V\x9dY\xea" +
+	"\xcbm\xab\x05#N\xd5\xe3n\x18\xbbbV\xb8\x1b\x03" +
+	"\x1fJa\xe8x\xd5\xb8\x1c\xf8\xf2\x03\x00\xe2\xba\x1fQ" +
+	"km\xe1X\xda+\x97g{\x9cg=!_\x10+" +
+	"\xd2\\?Iy=\xc0\xd0<\xdc\xc9\xf5!\xca\xff\x13" +
+	"\x0c\xcdW\xbbr\xfd2=\x93^dh\x1e\xa3\\+" +
+	"I\xae\x8fR\xae\xdfbh\x9e&\xadg\xc93\xe9W" +
+	"3\x00\xe6/\x19\x9ag:\xe7]\xfb\xed<\x80\xf9>" +
+	"C\xf3\xac\x82\xa5\xb2\xdf\xf4\xa2\xf6e\xa5\x185\x03\xaf" +
+	"\xbd\xc1\xf3I\x0f\x1d)\xd7\xb8W\x15\xcbhG\xa21" +
+	"=\x11\xb9%\x93-\xc2\x88\x84\x12\xb2t\x0a\xda5K" +
+	"\xe9\x88\xe3{\x93]\xb7\xb3e\xc5L^\x90S\xad\x86" +
+	"H\xf4u\x93\\\xf2\xd15\xb2\x98G\xd6\xc8b\xbe6" +
+	"/\x8b\xf9\xf2\xbd\xb2\x98\xdf\xbdF\x16\xf3\xb9\x1d\xb2\x98" +
+	"OSM\xb3\xda!\xb2\xf5jO\xce\x00`\x9f\xf6\x0d" +
+	"\x82\xfd\xf2\xd5\x889\xedQ\x82ym\xff\"\x00\x0e\xc8" +
+	"\xf7%\x16\xb4\x87h\x96\xa2v?y\x0ej\xad\x1d\x00" +
+	"%?\xaa\x89\xa0Tn\x06\xb3\"\xe6\x9eS\xe7\xee\xc6" +
+	"\x00F\x92:\xd3i\xf7}\xf7^\x1f\x98'\xb2NY" +
+	"\xc4\x15\xee\xba\x8eW\x9d\x84\xa2_\xde\x19\xc6\xa1\xeb4" +
+	"\x1a\"h\x01@\xdc\xf4\xc4\xac\xf0&}`\xdc\x8e\x1b" +
+	"\x82R\x118\x90\xe5^\x18\x97[e\xd7\x09\xa3\x90\xdc" +
+	"\x02\x9f\xdb\xbb\xfd`'`(\xbf\xef\xe4A\x00Y\x7f" +
+	"w\x18\xdbT\x82\xc0ob\xb8\xb4\xa5\xd0\x8bC\xc7\x16" +
+	"[\x1d\x8f*\x90\xad\xf8\xd5\xb8\xe2\xfaKm\x09\xe2]" +
+	"M\xd1\x14\xe1\xb8\x03\xc5\x9d\xc2m\xfdk\x00\xe4\xf7\xcf" +
+	"\x87"
 
 func RegisterSchema(reg *schemas.Registry) {
 	reg.Register(&schemas.Schema{
 		String: schema_da3a0d9284ca402f,
 		Nodes: []uint64{
+			0x8b30f1f20ea044fa,
 			0x922b57c60c6a46d1,
 			0xa4b9c59286b69600,
+			0xa9fca57688807689,
+			0xc9abc5600f629aff,
 			0xcb5ff253617678e0,
+			0xe9d0d03649f7a645,
+			0xf3d7a4ae286d000b,
+			0xf5eaa9c93feb2bb5,
+			0xfc0d939c8fbfd66c,
 		},
 		Compressed: true,
 	})
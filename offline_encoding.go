@@ -0,0 +1,212 @@
+package main
+
+import (
+	"math"
+
+	"capnproto.org/go/capnp/v3"
+	"github.com/pkg/errors"
+)
+
+var COORDINATE_SCALE = float64(1e7) // fixed point units per degree of quantized coordinates
+
+// Stores the nodes of a way as latitude, longitude pairs in 1e-7 degrees. The
+// first node is relative to the area origin and every other node to the one
+// before it, so that the small values pack well.
+func SetNodeDeltas(w Way, way TmpWay, originLat float64, originLon float64) error {
+	deltas, err := w.NewNodeDeltas(int32(2 * len(way.Nodes)))
+	if err != nil {
+		return errors.Wrap(err, "could not create way node deltas")
+	}
+	lastLat := int64(math.Round(originLat * COORDINATE_SCALE))
+	lastLon := int64(math.Round(originLon * COORDINATE_SCALE))
+	for i, node := range way.Nodes {
+		lat := int64(math.Round(node.Latitude * COORDINATE_SCALE))
+		lon := int64(math.Round(node.Longitude * COORDINATE_SCALE))
+		deltas.Set(2*i, int32(lat-lastLat))
+		deltas.Set(2*i+1, int32(lon-lastLon))
+		lastLat = lat
+		lastLon = lon
+	}
+	if !way.HasElevation {
+		return nil
+	}
+	elevations, err := w.NewNodeElevations(int32(len(way.Nodes)))
+	if err != nil {
+		return errors.Wrap(err, "could not create way node elevations")
+	}
+	for i, node := range way.Nodes {
+		elevations.Set(i, node.Elevation)
+	}
+	return nil
+}
+
+// Decodes the nodes of a way stored by SetNodeDeltas and computes their bounding box
+func ReadNodeDeltas(w Way, originLat float64, originLon float64) ([]TmpNode, error) {
+	deltas, err := w.NodeDeltas()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read way node deltas")
+	}
+	elevations, err := w.NodeElevations()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read way node elevations")
+	}
+	nodes := make([]TmpNode, deltas.Len()/2)
+	lat := int64(math.Round(originLat * COORDINATE_SCALE))
+	lon := int64(math.Round(originLon * COORDINATE_SCALE))
+	for i := range nodes {
+		lat += int64(deltas.At(2 * i))
+		lon += int64(deltas.At(2*i + 1))
+		nodes[i].Latitude = float64(lat) / COORDINATE_SCALE
+		nodes[i].Longitude = float64(lon) / COORDINATE_SCALE
+		if i < elevations.Len() {
+			nodes[i].Elevation = elevations.At(i)
+		}
+	}
+	return nodes, nil
+}
+
+// Reads an offline message back into the area and speed cameras it was built from
+func ReadArea(offline Offline) (Area, []TmpSpeedCamera, error) {
+	area := Area{MinLat: offline.MinLat(), MinLon: offline.MinLon(), MaxLat: offline.MaxLat(), MaxLon: offline.MaxLon()}
+	ways, err := offline.Ways()
+	if err != nil {
+		return area, nil, errors.Wrap(err, "could not read ways")
+	}
+	area.Ways = make([]TmpWay, ways.Len())
+	for i := 0; i < ways.Len(); i++ {
+		w := ways.At(i)
+		way := &area.Ways[i]
+		way.Id = w.Id()
+		way.Name, _ = w.Name()
+		way.Ref, _ = w.Ref()
+		way.Hazard, _ = w.Hazard()
+		way.Junction, _ = w.Junction()
+		way.MaxSpeed = w.MaxSpeed()
+		way.MaxSpeedForward = w.MaxSpeedForward()
+		way.MaxSpeedBackward = w.MaxSpeedBackward()
+		way.MaxSpeedAdvisory = w.AdvisorySpeed()
+		way.MaxSpeedPractical = w.MaxSpeedPractical()
+		way.MaxSpeedPracticalForward = w.MaxSpeedPracticalForward()
+		way.MaxSpeedPracticalBackward = w.MaxSpeedPracticalBackward()
+		way.Lanes = w.Lanes()
+		way.OneWay = w.OneWay()
+		way.HasElevation = w.HasElevation()
+		way.Tunnel = w.Tunnel()
+		way.Bridge = w.Bridge()
+		way.Layer = w.Layer()
+		way.Surface, _ = w.Surface()
+		way.Smoothness, _ = w.Smoothness()
+
+		if offline.CoordinateEncoding() == CoordinateEncoding_delta1e7 {
+			way.Nodes, err = ReadNodeDeltas(w, area.MinLat, area.MinLon)
+			if err != nil {
+				return area, nil, err
+			}
+			way.MinLat, way.MinLon, way.MaxLat, way.MaxLon = 90, 180, -90, -180
+			for _, node := range way.Nodes {
+				way.MinLat = math.Min(way.MinLat, node.Latitude)
+				way.MinLon = math.Min(way.MinLon, node.Longitude)
+				way.MaxLat = math.Max(way.MaxLat, node.Latitude)
+				way.MaxLon = math.Max(way.MaxLon, node.Longitude)
+			}
+		} else {
+			way.MinLat, way.MinLon, way.MaxLat, way.MaxLon = w.MinLat(), w.MinLon(), w.MaxLat(), w.MaxLon()
+			nodes, err := w.Nodes()
+			if err != nil {
+				return area, nil, errors.Wrap(err, "could not read way nodes")
+			}
+			way.Nodes = make([]TmpNode, nodes.Len())
+			for j := 0; j < nodes.Len(); j++ {
+				n := nodes.At(j)
+				way.Nodes[j] = TmpNode{Latitude: n.Latitude(), Longitude: n.Longitude(), Elevation: n.Elevation()}
+			}
+		}
+
+		way.LanesForward, err = WayLanes(w, true)
+		if err != nil {
+			return area, nil, err
+		}
+		way.LanesBackward, err = WayLanes(w, false)
+		if err != nil {
+			return area, nil, err
+		}
+		features, err := w.Features()
+		if err != nil {
+			return area, nil, errors.Wrap(err, "could not read way features")
+		}
+		for j := 0; j < features.Len(); j++ {
+			f := features.At(j)
+			feature := TmpFeature{Type: f.Type(), NodeIndex: f.NodeIndex()}
+			feature.Value, _ = f.Value()
+			feature.Direction, _ = f.Direction()
+			way.Features = append(way.Features, feature)
+		}
+		hazards, err := w.Hazards()
+		if err != nil {
+			return area, nil, errors.Wrap(err, "could not read way hazards")
+		}
+		for j := 0; j < hazards.Len(); j++ {
+			h := hazards.At(j)
+			hazard := TmpHazard{Type: h.Type(), OnNode: h.OnNode(), NodeIndex: h.NodeIndex()}
+			hazard.Value, _ = h.Value()
+			hazard.Direction, _ = h.Direction()
+			way.Hazards = append(way.Hazards, hazard)
+		}
+	}
+
+	speedCameras, err := offline.SpeedCameras()
+	if err != nil {
+		return area, nil, errors.Wrap(err, "could not read speed cameras")
+	}
+	cameras := make([]TmpSpeedCamera, speedCameras.Len())
+	for i := range cameras {
+		c := speedCameras.At(i)
+		cameras[i] = TmpSpeedCamera{
+			Id:               c.Id(),
+			Latitude:         c.Latitude(),
+			Longitude:        c.Longitude(),
+			MaxSpeed:         c.MaxSpeed(),
+			Bearing:          c.Bearing(),
+			HasBearing:       c.HasBearing(),
+			ZoneEndLatitude:  c.ZoneEndLatitude(),
+			ZoneEndLongitude: c.ZoneEndLongitude(),
+		}
+		cameras[i].Enforcement, _ = c.Enforcement()
+	}
+	return area, cameras, nil
+}
+
+// Converts offline data with quantized coordinates to float coordinates so
+// that the rest of mapd reads every file the same way. Float data is
+// returned unchanged.
+func DecodeOfflineData(data []byte) ([]byte, error) {
+	msg, err := capnp.UnmarshalPacked(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not unmarshal offline data")
+	}
+	offline, err := ReadRootOffline(msg)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read offline message")
+	}
+	if offline.CoordinateEncoding() == CoordinateEncoding_float64 {
+		return data, nil
+	}
+
+	area, cameras, err := ReadArea(offline)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not decode quantized offline data")
+	}
+	decodedMsg, decoded := NewOfflineMessage(area, cameras, CoordinateEncoding_float64)
+	decoded.SetOverlap(offline.Overlap())
+	decoded.SetSchemaVersion(offline.SchemaVersion())
+	decoded.SetMinReaderVersion(offline.MinReaderVersion())
+	decoded.SetSourceTimestamp(offline.SourceTimestamp())
+	decoded.SetReplicationSequence(offline.ReplicationSequence())
+	generatorVersion, _ := offline.GeneratorVersion()
+	err = decoded.SetGeneratorVersion(generatorVersion)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not set generator version")
+	}
+	decodedData, err := decodedMsg.MarshalPacked()
+	return decodedData, errors.Wrap(err, "could not marshal decoded offline data")
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"capnproto.org/go/capnp/v3"
+	"github.com/bradleyjkemp/cupaloy"
+	"github.com/paulmach/osm"
+)
+
+func TestDecodeOfflineData(t *testing.T) {
+	area := Area{MinLat: 51, MinLon: 17, MaxLat: 51.25, MaxLon: 17.25, Ways: []TmpWay{{
+		Id:           1,
+		Name:         "Testowa",
+		MaxSpeed:     13.9,
+		HasElevation: true,
+		MinLat:       51.0999999,
+		MinLon:       16.9987654,
+		MaxLat:       51.1234567,
+		MaxLon:       17.1,
+		Nodes: []TmpNode{
+			{Latitude: 51.1234567, Longitude: 16.9987654, Elevation: 120.5},
+			{Latitude: 51.0999999, Longitude: 17.1, Elevation: 121},
+		},
+	}}}
+	quantized := MarshalArea(area, nil, OfflineSource{}, CoordinateEncoding_delta1e7)
+	unquantized := MarshalArea(area, nil, OfflineSource{}, CoordinateEncoding_float64)
+
+	data, err := DecodeOfflineData(quantized)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := capnp.UnmarshalPacked(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offline, err := ReadRootOffline(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, _, err := ReadArea(offline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	way := decoded.Ways[0]
+
+	cupaloy.SnapshotT(t,
+		"Should be smaller than unquantized", len(quantized) < len(unquantized),
+		"Should be float64", offline.CoordinateEncoding() == CoordinateEncoding_float64,
+		fmt.Sprintf("bounds %.7f %.7f %.7f %.7f", way.MinLat, way.MinLon, way.MaxLat, way.MaxLon),
+		fmt.Sprintf("nodes %.7f %.7f %.1f %.7f %.7f %.1f", way.Nodes[0].Latitude, way.Nodes[0].Longitude, way.Nodes[0].Elevation, way.Nodes[1].Latitude, way.Nodes[1].Longitude, way.Nodes[1].Elevation),
+	)
+}
+
+// Lists the zero fields of a value, including the fields of nested structs and slice elements
+func zeroFields(prefix string, value reflect.Value) []string {
+	switch value.Kind() {
+	case reflect.Struct:
+		zero := []string{}
+		for i := 0; i < value.NumField(); i++ {
+			zero = append(zero, zeroFields(prefix+"."+value.Type().Field(i).Name, value.Field(i))...)
+		}
+		return zero
+	case reflect.Slice:
+		if value.Len() == 0 {
+			return []string{prefix}
+		}
+		zero := []string{}
+		for i := 0; i < value.Len(); i++ {
+			zero = append(zero, zeroFields(fmt.Sprintf("%s[%d]", prefix, i), value.Index(i))...)
+		}
+		return zero
+	}
+	if value.IsZero() {
+		return []string{prefix}
+	}
+	return nil
+}
+
+func roundTripTestWay() TmpWay {
+	lanes := func(count uint8, destination string) TmpLanes {
+		return TmpLanes{
+			Count:          count,
+			Turn:           []string{"left", "through"},
+			Change:         []string{"not_right", "yes"},
+			MaxSpeeds:      []float64{22.2, 27.8},
+			Destination:    destination,
+			DestinationRef: destination + " ref",
+		}
+	}
+	return TmpWay{
+		Id:                        42,
+		Name:                      "Testowa",
+		Ref:                       "A4",
+		Hazard:                    "curves",
+		Junction:                  "circular",
+		MaxSpeed:                  13.9,
+		MaxSpeedForward:           16.7,
+		MaxSpeedBackward:          11.1,
+		MaxSpeedAdvisory:          8.3,
+		MaxSpeedPractical:         12.5,
+		MaxSpeedPracticalForward:  15.3,
+		MaxSpeedPracticalBackward: 9.7,
+		Lanes:                     3,
+		MinLat:                    51.0999999,
+		MinLon:                    16.9987654,
+		MaxLat:                    51.1234567,
+		MaxLon:                    17.1,
+		OneWay:                    true,
+		HasElevation:              true,
+		Nodes: []TmpNode{
+			{Latitude: 51.1234567, Longitude: 16.9987654, Elevation: 120.5},
+			{Latitude: 51.0999999, Longitude: 17.1, Elevation: 121},
+		},
+		Features:      []TmpFeature{{Type: FeatureType_stop, Value: "all", NodeIndex: 1, Direction: "forward"}},
+		Hazards:       []TmpHazard{{Type: HazardType_animalCrossing, Value: "barrier", OnNode: true, NodeIndex: 1, Direction: "backward"}},
+		LanesForward:  lanes(2, "Wroclaw"),
+		LanesBackward: lanes(1, "Opole"),
+		Tunnel:        true,
+		Bridge:        true,
+		Layer:         -1,
+		Surface:       "asphalt",
+		Smoothness:    "good",
+		NodeIds:       []osm.NodeID{1, 2},
+	}
+}
+
+// Fails when a capnp Way field or a TmpWay field is not carried through
+// NewOfflineMessage and ReadArea in either coordinate encoding
+func TestWayRoundTrip(t *testing.T) {
+	way := roundTripTestWay()
+	// new TmpWay fields have to be set above so that they are compared below
+	if zero := zeroFields("TmpWay", reflect.ValueOf(way)); len(zero) > 0 {
+		t.Fatalf("the test way does not set %v", zero)
+	}
+	area := Area{MinLat: 51, MinLon: 17, MaxLat: 51.25, MaxLon: 17.25, Ways: []TmpWay{way}}
+
+	written := map[string]bool{}
+	for _, encoding := range []CoordinateEncoding{CoordinateEncoding_float64, CoordinateEncoding_delta1e7} {
+		_, offline := NewOfflineMessage(area, nil, encoding)
+		ways, err := offline.Ways()
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := reflect.ValueOf(ways.At(0))
+		for i := 0; i < w.NumMethod(); i++ {
+			name := w.Type().Method(i).Name
+			if !strings.HasPrefix(name, "Set") {
+				continue
+			}
+			field := strings.TrimPrefix(name, "Set")
+			if has := w.MethodByName("Has" + field); has.IsValid() {
+				written[field] = written[field] || has.Call(nil)[0].Bool()
+			} else {
+				written[field] = written[field] || !w.MethodByName(field).Call(nil)[0].IsZero()
+			}
+		}
+
+		decoded, _, err := ReadArea(offline)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := decoded.Ways[0]
+		got.NodeIds = way.NodeIds
+		if encoding == CoordinateEncoding_delta1e7 {
+			round := func(v float64) float64 { return math.Round(v*1e7) / 1e7 }
+			got.MinLat, got.MinLon, got.MaxLat, got.MaxLon = round(got.MinLat), round(got.MinLon), round(got.MaxLat), round(got.MaxLon)
+			for i := range got.Nodes {
+				got.Nodes[i].Latitude, got.Nodes[i].Longitude = round(got.Nodes[i].Latitude), round(got.Nodes[i].Longitude)
+			}
+		}
+		wanted, decodedWay := reflect.ValueOf(way), reflect.ValueOf(got)
+		for i := 0; i < wanted.NumField(); i++ {
+			if !reflect.DeepEqual(wanted.Field(i).Interface(), decodedWay.Field(i).Interface()) {
+				t.Errorf("%s is not carried through encoding %s: wrote %+v, read %+v", wanted.Type().Field(i).Name, encoding, wanted.Field(i).Interface(), decodedWay.Field(i).Interface())
+			}
+		}
+	}
+	for field, ok := range written {
+		if !ok {
+			t.Errorf("capnp Way field %s is never written", field)
+		}
+	}
+}
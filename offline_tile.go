@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"capnproto.org/go/capnp/v3"
+	"capnproto.org/go/capnp/v3/packed"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+var UNPACKED_DIR = fmt.Sprintf("%s/unpacked", GetBaseOpPath())
+
+// An offline data file that is unpacked once to a cache file and memory
+// mapped, so that capnp reads its ways straight from the page cache
+type OfflineTile struct {
+	Path    string
+	Offline Offline
+	Cameras *SpeedCameraIndex
+	msg     *capnp.Message
+	data    []byte
+}
+
+func UnpackedTileName(path string) string {
+	return filepath.Join(UNPACKED_DIR, strings.TrimPrefix(path, BOUNDS_DIR))
+}
+
+// Writes the unpacked, float coordinate version of an offline data file. The
+// cache file gets the modification time of the offline data file so that a
+// replaced file is unpacked again.
+func UnpackTile(path string, unpackedPath string, modTime time.Time) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "could not read offline data file")
+	}
+	msg, err := capnp.UnmarshalPacked(data)
+	if err != nil {
+		return errors.Wrap(err, "could not unmarshal offline data")
+	}
+	offline, err := ReadRootOffline(msg)
+	if err != nil {
+		return errors.Wrap(err, "could not read offline message")
+	}
+	if metadata := ReadOfflineMetadata(path, offline); !metadata.Compatible {
+		return errors.New(metadata.Warning)
+	}
+	data, err = DecodeOfflineData(data)
+	if err != nil {
+		return err
+	}
+	data, err = packed.Unpack(nil, data)
+	if err != nil {
+		return errors.Wrap(err, "could not unpack offline data")
+	}
+
+	err = os.MkdirAll(filepath.Dir(unpackedPath), 0o775)
+	if err != nil {
+		return errors.Wrap(err, "could not create unpacked offline data directory")
+	}
+	tmp := unpackedPath + ".tmp"
+	err = os.WriteFile(tmp, data, 0o644)
+	if err != nil {
+		return errors.Wrap(err, "could not write unpacked offline data")
+	}
+	err = os.Chtimes(tmp, modTime, modTime)
+	if err != nil {
+		return errors.Wrap(err, "could not set unpacked offline data time")
+	}
+	return errors.Wrap(os.Rename(tmp, unpackedPath), "could not replace unpacked offline data")
+}
+
+// Opens an offline data file, unpacking it first if the cache is missing or stale
+func OpenOfflineTile(path string) (*OfflineTile, error) {
+	groupsLock.RLock()
+	defer groupsLock.RUnlock()
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not stat offline data file")
+	}
+	unpackedPath := UnpackedTileName(path)
+	unpackedInfo, err := os.Stat(unpackedPath)
+	if err != nil || !unpackedInfo.ModTime().Equal(info.ModTime()) {
+		log.Info().Str("filename", path).Msg("Unpacking offline data file")
+		err = UnpackTile(path, unpackedPath, info.ModTime())
+		if err != nil {
+			return nil, errors.Wrap(err, "could not unpack offline data file")
+		}
+	}
+
+	f, err := os.Open(unpackedPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not open unpacked offline data")
+	}
+	defer f.Close()
+	unpackedInfo, err = f.Stat()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not stat unpacked offline data")
+	}
+	data, err := mapFile(f, int(unpackedInfo.Size()), false)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not map unpacked offline data")
+	}
+	tile := &OfflineTile{Path: path, data: data}
+	tile.msg, err = capnp.Unmarshal(data)
+	if err != nil {
+		tile.Close()
+		return nil, errors.Wrap(err, "could not unmarshal unpacked offline data")
+	}
+	// the message is read every loop for as long as the tile is loaded
+	tile.msg.ResetReadLimit(math.MaxUint64)
+	tile.Offline, err = ReadRootOffline(tile.msg)
+	if err != nil {
+		tile.Close()
+		return nil, errors.Wrap(err, "could not read offline message")
+	}
+	err = CheckOfflineData(path, tile.Offline)
+	if err != nil {
+		tile.Close()
+		return nil, errors.Wrap(err, "refusing incompatible offline data file")
+	}
+	tile.Cameras, err = NewSpeedCameraIndex(tile.Offline)
+	if err != nil {
+		tile.Close()
+		return nil, err
+	}
+	return tile, nil
+}
+
+// Checks if a way was read from this tile
+func (t *OfflineTile) Contains(way Way) bool {
+	return t != nil && capnp.Struct(way).Message() == t.msg
+}
+
+// Unmaps the tile. Ways read from it must not be used afterwards.
+func (t *OfflineTile) Close() error {
+	if t.data == nil {
+		return nil
+	}
+	err := unmapFile(nil, t.data, false)
+	t.data = nil
+	return errors.Wrap(err, "could not unmap offline data")
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	OFFLINE_SCHEMA_VERSION               = uint32(4) // increment when fields are added to offline.capnp
+	OFFLINE_MIN_READER_VERSION           = uint32(1) // oldest schema version that reads the data written by this generator correctly
+	OFFLINE_QUANTIZED_MIN_READER_VERSION = uint32(2) // oldest schema version that decodes quantized coordinates
+	GENERATOR_VERSION                    = ""        // set with -ldflags "-X main.GENERATOR_VERSION=...", defaults to the vcs revision
+)
+
+// Where the data of generated offline files comes from
+type OfflineSource struct {
+	Timestamp time.Time // replication timestamp of the osm data, zero when unknown
+	Sequence  int64     // replication sequence number of the osm data, zero when unknown
+}
+
+// Metadata of a loaded offline data file as published to the MapOfflineMetadata param
+type OfflineMetadata struct {
+	File                string `json:"file"`
+	SchemaVersion       uint32 `json:"schema_version"`
+	MinReaderVersion    uint32 `json:"min_reader_version"`
+	GeneratorVersion    string `json:"generator_version"`
+	SourceTimestamp     int64  `json:"source_timestamp"`
+	ReplicationSequence int64  `json:"replication_sequence"`
+	Compatible          bool   `json:"compatible"`
+	Warning             string `json:"warning"`
+}
+
+func GeneratorVersion() string {
+	if len(GENERATOR_VERSION) > 0 {
+		return GENERATOR_VERSION
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+	}
+	return "dev"
+}
+
+func SetOfflineMetadata(offline Offline, source OfflineSource) error {
+	offline.SetSchemaVersion(OFFLINE_SCHEMA_VERSION)
+	if offline.CoordinateEncoding() == CoordinateEncoding_float64 {
+		offline.SetMinReaderVersion(OFFLINE_MIN_READER_VERSION)
+	} else {
+		offline.SetMinReaderVersion(OFFLINE_QUANTIZED_MIN_READER_VERSION)
+	}
+	if !source.Timestamp.IsZero() {
+		offline.SetSourceTimestamp(source.Timestamp.Unix())
+	}
+	offline.SetReplicationSequence(source.Sequence)
+	return errors.Wrap(offline.SetGeneratorVersion(GeneratorVersion()), "could not set generator version")
+}
+
+// Reads the metadata of an offline data file and checks if this build can
+// use it. Files that need a newer reader are incompatible, older or newer
+// files that can still be read only get a warning.
+func ReadOfflineMetadata(file string, offline Offline) OfflineMetadata {
+	metadata := OfflineMetadata{File: file}
+	metadata.SchemaVersion = offline.SchemaVersion()
+	metadata.MinReaderVersion = offline.MinReaderVersion()
+	metadata.GeneratorVersion, _ = offline.GeneratorVersion()
+	metadata.SourceTimestamp = offline.SourceTimestamp()
+	metadata.ReplicationSequence = offline.ReplicationSequence()
+
+	metadata.Compatible = metadata.MinReaderVersion <= OFFLINE_SCHEMA_VERSION
+	switch {
+	case !metadata.Compatible:
+		metadata.Warning = fmt.Sprintf("offline data needs schema version %d, this build reads version %d", metadata.MinReaderVersion, OFFLINE_SCHEMA_VERSION)
+	case metadata.SchemaVersion == 0:
+		metadata.Warning = "offline data has no version, newer map features are missing until maps are downloaded again"
+	case metadata.SchemaVersion < OFFLINE_SCHEMA_VERSION:
+		metadata.Warning = fmt.Sprintf("offline data has schema version %d, newer map features are missing until maps are downloaded again", metadata.SchemaVersion)
+	case metadata.SchemaVersion > OFFLINE_SCHEMA_VERSION:
+		metadata.Warning = fmt.Sprintf("offline data has schema version %d, map features newer than version %d are ignored", metadata.SchemaVersion, OFFLINE_SCHEMA_VERSION)
+	}
+	return metadata
+}
+
+// Checks a loaded offline data file, logs and publishes its metadata and
+// returns an error if the file can not be used
+func CheckOfflineData(file string, offline Offline) error {
+	metadata := ReadOfflineMetadata(file, offline)
+	event := log.Info()
+	if len(metadata.Warning) > 0 {
+		event = log.Warn().Str("warning", metadata.Warning)
+	}
+	event.Str("filename", file).
+		Uint32("schema_version", metadata.SchemaVersion).
+		Str("generator_version", metadata.GeneratorVersion).
+		Int64("source_timestamp", metadata.SourceTimestamp).
+		Int64("replication_sequence", metadata.ReplicationSequence).
+		Msg("Loaded offline data")
+
+	out, err := json.Marshal(metadata)
+	logde(errors.Wrap(err, "could not marshal offline metadata"))
+	if err == nil {
+		logwe(errors.Wrap(PutParam(MAP_OFFLINE_METADATA, out), "could not write offline metadata"))
+	}
+	if !metadata.Compatible {
+		return errors.New(metadata.Warning)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"capnproto.org/go/capnp/v3"
+	"github.com/bradleyjkemp/cupaloy"
+)
+
+func offlineWithVersions(t *testing.T, schemaVersion uint32, minReaderVersion uint32) Offline {
+	_, seg, err := capnp.NewMessage(capnp.MultiSegment([][]byte{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	offline, err := NewRootOffline(seg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offline.SetSchemaVersion(schemaVersion)
+	offline.SetMinReaderVersion(minReaderVersion)
+	return offline
+}
+
+func TestReadOfflineMetadata(t *testing.T) {
+	results := ""
+	for _, versions := range [][2]uint32{{0, 0}, {OFFLINE_SCHEMA_VERSION, OFFLINE_MIN_READER_VERSION}, {OFFLINE_SCHEMA_VERSION + 1, OFFLINE_SCHEMA_VERSION}, {OFFLINE_SCHEMA_VERSION + 1, OFFLINE_SCHEMA_VERSION + 1}} {
+		metadata := ReadOfflineMetadata("tile", offlineWithVersions(t, versions[0], versions[1]))
+		results += fmt.Sprintf("%d/%d compatible=%v warning=%q\n", versions[0], versions[1], metadata.Compatible, metadata.Warning)
+	}
+
+	cupaloy.SnapshotT(t, results)
+}
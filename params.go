@@ -26,13 +26,36 @@ var (
 	MAP_ADVISORY_LIMIT        = ParamPath("MapAdvisoryLimit", true)
 	NEXT_MAP_ADVISORY_LIMIT   = ParamPath("NextMapAdvisoryLimit", true)
 	NEXT_MAP_SPEED_LIMIT      = ParamPath("NextMapSpeedLimit", true)
+	MAP_ROUNDABOUT            = ParamPath("MapRoundabout", true)
+	MAP_FEATURES              = ParamPath("MapFeatures", true)
+	MAP_HAZARDS               = ParamPath("MapHazards", true)
+	MAP_LANES                 = ParamPath("MapLanes", true)
+	MAP_EXITS                 = ParamPath("MapExits", true)
+	MAP_ROAD_ATTRIBUTES       = ParamPath("MapRoadAttributes", true)
+	NEXT_SPEED_CAMERA         = ParamPath("NextSpeedCamera", true)
+	MAP_OFFLINE_METADATA      = ParamPath("MapOfflineMetadata", true)
 	LAST_GPS_POSITION         = ParamPath("LastGPSPosition", true)
 	LAST_GPS_POSITION_PERSIST = ParamPath("LastGPSPosition", false)
 	DOWNLOAD_BOUNDS           = ParamPath("OSMDownloadBounds", true)
 	DOWNLOAD_LOCATIONS        = ParamPath("OSMDownloadLocations", true)
+	DOWNLOAD_CONTROL          = ParamPath("OSMDownloadControl", true)
 	DOWNLOAD_PROGRESS         = ParamPath("OSMDownloadProgress", false)
+	DOWNLOAD_ROLLBACK         = ParamPath("OSMDownloadRollback", true)
+	DOWNLOAD_SOURCES_PERSIST  = ParamPath("OSMDownloadSources", false)
+	DOWNLOAD_PARALLEL_PERSIST = ParamPath("OSMDownloadConcurrency", false)
+	DOWNLOAD_RATE_PERSIST     = ParamPath("OSMDownloadBandwidthLimit", false)
+	UPDATE_AVAILABLE          = ParamPath("OSMUpdateAvailable", false)
+	UPDATE_CHECK              = ParamPath("OSMUpdateCheck", true)
+	AUTO_UPDATE_PERSIST       = ParamPath("OSMAutoUpdate", false)
+	NETWORK_METERED           = ParamPath("OSMNetworkMetered", true)
+	INSTALLED_GROUPS          = ParamPath("OSMInstalledGroups", false)
+	DELETE_REGIONS            = ParamPath("OSMDeleteRegions", true)
+	DELETE_RESULT             = ParamPath("OSMDeleteResult", false)
+	REQUIRE_MANIFESTS_PERSIST = ParamPath("OSMRequireManifests", false)
+	DISK_BUDGET_PERSIST       = ParamPath("OSMDiskBudget", false)
 	MAP_CURVATURES            = ParamPath("MapCurvatures", true)
 	MAP_TARGET_VELOCITIES     = ParamPath("MapTargetVelocities", true)
+	MAP_GRADES                = ParamPath("MapGrades", true)
 	MAP_TARGET_LAT_A          = ParamPath("MapTargetLatA", true)
 	MAP_TARGET_LAT_A_PERSIST  = ParamPath("MapTargetLatA", false)
 	MAPD_LOG_LEVEL            = ParamPath("MapdLogLevel", true)
@@ -82,12 +105,25 @@ func ResetParams() {
 	_ = PutParam(MAP_ADVISORY_LIMIT, empty_object)
 	_ = PutParam(NEXT_MAP_ADVISORY_LIMIT, empty_object)
 	_ = PutParam(NEXT_MAP_SPEED_LIMIT, empty_object)
+	_ = PutParam(MAP_ROUNDABOUT, empty_object)
+	_ = PutParam(MAP_FEATURES, empty_array)
+	_ = PutParam(MAP_HAZARDS, empty_array)
+	_ = PutParam(MAP_LANES, empty_object)
+	_ = PutParam(MAP_EXITS, empty_array)
+	_ = PutParam(MAP_ROAD_ATTRIBUTES, empty_object)
+	_ = PutParam(NEXT_SPEED_CAMERA, empty_object)
+	_ = PutParam(MAP_OFFLINE_METADATA, empty_object)
 	_ = PutParam(LAST_GPS_POSITION, empty_object)
 	_ = PutParam(DOWNLOAD_BOUNDS, empty_data)
 	_ = PutParam(DOWNLOAD_LOCATIONS, empty_data)
+	_ = PutParam(DOWNLOAD_CONTROL, empty_data)
 	_ = PutParam(DOWNLOAD_PROGRESS, empty_data)
+	_ = PutParam(DOWNLOAD_ROLLBACK, empty_data)
+	_ = PutParam(UPDATE_CHECK, empty_data)
+	_ = PutParam(DELETE_REGIONS, empty_data)
 	_ = PutParam(MAP_CURVATURES, empty_array)
 	_ = PutParam(MAP_TARGET_VELOCITIES, empty_array)
+	_ = PutParam(MAP_GRADES, empty_array)
 }
 
 func IsString(data []byte) bool {
@@ -144,6 +180,32 @@ func GetParam(path string) ([]byte, error) {
 	return os.ReadFile(path)
 }
 
+// Takes the lock that openpilot holds while it writes params
+func lockParamsDirectory(lock_dir string) (*flock.Flock, error) {
+	fileLock := flock.New(filepath.Join(lock_dir, ".lock"))
+
+	retries := 0
+	for {
+		locked, err := fileLock.TryLock()
+		if err != nil {
+			return nil, errors.Wrap(err, "could not try locking params directory")
+		}
+		if locked {
+			return fileLock, nil
+		}
+		retries += 1
+		if retries > 30 {
+			// try to force the lock to be removed
+			logie(os.Remove(filepath.Join(lock_dir, ".lock")))
+		}
+		if retries > 50 {
+			return nil, errors.New("could not obtain lock")
+		}
+		// if we didn't obtain the lock let's try again after a short delay
+		time.Sleep(1 * time.Millisecond)
+	}
+}
+
 func PutParam(path string, data []byte) error {
 	dir := filepath.Dir(path)
 	lock_dir := filepath.Dir(dir)
@@ -164,27 +226,9 @@ func PutParam(path string, data []byte) error {
 		return errors.Wrap(err, "could not fsync temp param file")
 	}
 
-	fileLock := flock.New(filepath.Join(lock_dir, ".lock"))
-
-	retries := 0
-	for {
-		locked, err := fileLock.TryLock()
-		if err != nil {
-			return errors.Wrap(err, "could not try locking param directory")
-		}
-		if locked {
-			break
-		}
-		retries += 1
-		if retries > 30 {
-			// try to force the lock to be removed
-			logie(os.Remove(filepath.Join(lock_dir, ".lock")))
-		}
-		if retries > 50 {
-			return errors.New("could not obtain lock")
-		}
-		// if we didn't obtain the lock let's try again after a short delay
-		time.Sleep(1 * time.Millisecond)
+	fileLock, err := lockParamsDirectory(lock_dir)
+	if err != nil {
+		return err
 	}
 	defer logwe(errors.Wrap(fileLock.Unlock(), "could not unlock params directory"))
 	defer logde(errors.Wrap(os.Remove(filepath.Join(lock_dir, ".lock")), "could not remove params lock file"))
@@ -210,27 +254,9 @@ func PutParam(path string, data []byte) error {
 func RemoveParam(path string) error {
 	dir := filepath.Dir(path)
 	lock_dir := filepath.Dir(dir)
-	fileLock := flock.New(filepath.Join(lock_dir, ".lock"))
-
-	retries := 0
-	for {
-		locked, err := fileLock.TryLock()
-		if err != nil {
-			return errors.Wrap(err, "could not try locking params directory")
-		}
-		if locked {
-			break
-		}
-		retries += 1
-		if retries > 30 {
-			// try to force the lock to be removed
-			logde(os.Remove(filepath.Join(lock_dir, ".lock")))
-		}
-		if retries > 50 {
-			return errors.New("could not obtain lock")
-		}
-		// if we didn't obtain the lock let's try again after a short delay
-		time.Sleep(1 * time.Millisecond)
+	fileLock, err := lockParamsDirectory(lock_dir)
+	if err != nil {
+		return err
 	}
 	defer logwe(errors.Wrap(fileLock.Unlock(), "could not unlock params directory"))
 	defer logde(errors.Wrap(os.Remove(filepath.Join(lock_dir, ".lock")), "could not remove params lock file"))
@@ -249,3 +275,34 @@ func RemoveParam(path string) error {
 
 	return nil
 }
+
+// Reads a param and empties it while holding the params lock, so a value
+// written right after it was read is kept for the next call instead of being
+// cleared
+func TakeParam(path string) ([]byte, error) {
+	// most of the time there is nothing to take, which needs no lock
+	data, err := GetParam(path)
+	if err != nil || len(data) == 0 {
+		return data, err
+	}
+
+	dir := filepath.Dir(path)
+	lock_dir := filepath.Dir(dir)
+	fileLock, err := lockParamsDirectory(lock_dir)
+	if err != nil {
+		return nil, err
+	}
+	// unlock only after the param was emptied
+	defer func() {
+		logde(errors.Wrap(os.Remove(filepath.Join(lock_dir, ".lock")), "could not remove params lock file"))
+		logwe(errors.Wrap(fileLock.Unlock(), "could not unlock params directory"))
+	}()
+
+	// read again, the param may have changed before the lock was taken
+	data, err = os.ReadFile(path)
+	if err != nil || len(data) == 0 {
+		return data, err
+	}
+	err = os.WriteFile(path, []byte{}, 0o644)
+	return data, errors.Wrap(err, "could not empty param")
+}
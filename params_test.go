@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bradleyjkemp/cupaloy"
+)
+
+func TestTakeParam(t *testing.T) {
+	base := t.TempDir()
+	dir := filepath.Join(base, "d")
+	err := os.MkdirAll(dir, 0o775)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "OSMDownloadLocations")
+	results := ""
+	take := func(step string) {
+		data, err := TakeParam(path)
+		left, _ := os.ReadFile(path)
+		results += fmt.Sprintf("%s: %q err=%v left=%q\n", step, data, err, left)
+	}
+
+	take("missing")
+	_ = os.WriteFile(path, []byte{}, 0o644)
+	take("empty")
+	_ = os.WriteFile(path, []byte("US"), 0o644)
+	take("set")
+	take("taken")
+
+	// a lock file that cannot be locked shows when the lock is taken
+	err = os.Mkdir(filepath.Join(base, ".lock"), 0o775)
+	if err != nil {
+		t.Fatal(err)
+	}
+	take("empty without lock")
+	_ = os.WriteFile(path, []byte("US"), 0o644)
+	take("set without lock")
+
+	cupaloy.SnapshotT(t, strings.ReplaceAll(results, base, "<base>"))
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var REGISTRY_PATH = fmt.Sprintf("%s/installed_groups.json", GetBaseOpPath()) // the record of downloaded groups
+
+// A downloaded group as recorded when it was installed
+type InstalledGroup struct {
+	Group       string          `json:"group"`
+	Source      string          `json:"source"`
+	GeneratedAt time.Time       `json:"generated_at"` // when the offline data of the group was generated
+	InstalledAt time.Time       `json:"installed_at"`
+	Fingerprint string          `json:"fingerprint"` // changes when any file of the group changes
+	Files       int             `json:"files"`
+	Previous    *InstalledGroup `json:"previous,omitempty"`  // the version a rollback returns to
+	Rejected    string          `json:"rejected,omitempty"`  // fingerprint of the release rolled back from, not offered as an update again
+	Locations   []string        `json:"locations,omitempty"` // the nations and states the group was downloaded for, such as nation/DE
+}
+
+var registryLock sync.Mutex
+
+// A hash of the names and hashes of all files in a manifest
+func ManifestFingerprint(manifest GroupManifest) string {
+	files := append([]ManifestFile{}, manifest.Files...)
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	hash := sha256.New()
+	for _, file := range files {
+		fmt.Fprintf(hash, "%s %s\n", file.Name, file.SHA256)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func readRegistry() (map[string]InstalledGroup, error) {
+	registry := map[string]InstalledGroup{}
+	data, err := os.ReadFile(REGISTRY_PATH)
+	if os.IsNotExist(err) {
+		return registry, nil
+	}
+	if err != nil {
+		return registry, errors.Wrap(err, "could not read registry")
+	}
+	err = json.Unmarshal(data, &registry)
+	return registry, errors.Wrap(err, "could not unmarshal registry")
+}
+
+func writeRegistry(registry map[string]InstalledGroup) error {
+	data, err := json.MarshalIndent(registry, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "could not marshal registry")
+	}
+	err = os.MkdirAll(filepath.Dir(REGISTRY_PATH), 0o775)
+	if err != nil {
+		return errors.Wrap(err, "could not create registry directory")
+	}
+	tmp := REGISTRY_PATH + ".tmp"
+	err = os.WriteFile(tmp, data, 0o644)
+	if err != nil {
+		return errors.Wrap(err, "could not write registry")
+	}
+	return errors.Wrap(os.Rename(tmp, REGISTRY_PATH), "could not replace registry")
+}
+
+// Changes the registry under its lock
+func updateRegistry(update func(registry map[string]InstalledGroup)) error {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	registry, err := readRegistry()
+	if err != nil {
+		return err
+	}
+	update(registry)
+	return writeRegistry(registry)
+}
+
+// The recorded groups, keyed by group name
+func ReadRegistry() (map[string]InstalledGroup, error) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	return readRegistry()
+}
+
+// Records a freshly installed group, the version it replaced becomes its
+// previous version
+func RecordInstalledGroup(group string, source string, manifest GroupManifest) error {
+	return updateRegistry(func(registry map[string]InstalledGroup) {
+		installed := InstalledGroup{
+			Group:       group,
+			Source:      source,
+			GeneratedAt: manifest.GeneratedAt,
+			InstalledAt: time.Now().UTC(),
+			Fingerprint: ManifestFingerprint(manifest),
+			Files:       len(manifest.Files),
+		}
+		if previous, ok := registry[group]; ok && len(previous.Fingerprint) > 0 {
+			installed.Locations = previous.Locations
+			previous.Previous = nil
+			previous.Rejected = ""
+			previous.Locations = nil
+			installed.Previous = &previous
+		}
+		registry[group] = installed
+	})
+}
+
+// The name a nation or state is recorded under, nation and state codes overlap
+func LocationKey(kind string, code string) string {
+	return kind + "/" + code
+}
+
+// Records that the completed groups of a location were downloaded for it
+func RecordGroupLocation(groups []GroupArea, location string, completed map[string]bool) error {
+	return updateRegistry(func(registry map[string]InstalledGroup) {
+		for _, area := range groups {
+			installed, ok := registry[area.String()]
+			if !completed[area.String()] || !ok || len(installed.Fingerprint) == 0 {
+				continue
+			}
+			found := false
+			for _, recorded := range installed.Locations {
+				found = found || recorded == location
+			}
+			if !found {
+				installed.Locations = append(installed.Locations, location)
+				sort.Strings(installed.Locations)
+				registry[area.String()] = installed
+			}
+		}
+	})
+}
+
+// Forgets that groups were downloaded for the given locations
+func forgetGroupLocations(groups []string, locations map[string]bool) error {
+	return updateRegistry(func(registry map[string]InstalledGroup) {
+		for _, group := range groups {
+			installed, ok := registry[group]
+			if !ok {
+				continue
+			}
+			kept := []string{}
+			for _, location := range installed.Locations {
+				if !locations[location] {
+					kept = append(kept, location)
+				}
+			}
+			installed.Locations = kept
+			registry[group] = installed
+		}
+	})
+}
+
+// Swaps the recorded live and previous versions of a group like RollbackGroup
+// swaps their files and rejects the release that was rolled back from
+func recordRollback(group string) error {
+	return updateRegistry(func(registry map[string]InstalledGroup) {
+		live, ok := registry[group]
+		if !ok || live.Previous == nil {
+			// the previous version was installed before it was recorded, only
+			// the rejected release is kept
+			delete(registry, group)
+			if ok && len(live.Fingerprint) > 0 {
+				registry[group] = InstalledGroup{Group: group, Rejected: live.Fingerprint}
+			}
+			return
+		}
+		previous := *live.Previous
+		live.Previous = nil
+		live.Rejected = ""
+		previous.Previous = &live
+		previous.Rejected = live.Fingerprint
+		registry[group] = previous
+	})
+}
+
+// The groups in the offline directory, whether or not they were recorded
+func InstalledGroupAreas() []GroupArea {
+	dirs, _ := filepath.Glob(filepath.Join(BOUNDS_DIR, "*", "*"))
+	groups := []GroupArea{}
+	for _, dir := range dirs {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+		name, err := filepath.Rel(BOUNDS_DIR, dir)
+		if err != nil {
+			continue
+		}
+		group, err := ParseGroupArea(filepath.ToSlash(name))
+		if err == nil {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
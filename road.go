@@ -0,0 +1,260 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	TUNNEL_HOLD_TIME    = 2 * time.Minute // how long to dead reckon through a tunnel before trusting the GPS fix again
+	MAX_SPEED_FIX_AGE   = 5 * time.Second // fixes further apart than this are not used to measure the speed
+	MAX_RECKONING_SPEED = 70.0            // m/s. measured speeds above this are GPS jumps and are ignored
+)
+
+// Fraction of the target lateral accel kept on unpaved or rough surfaces
+var SURFACE_LAT_ACCEL_SCALES = map[string]float64{
+	"paving_stones":      0.9,
+	"sett":               0.85,
+	"cobblestone":        0.8,
+	"unhewn_cobblestone": 0.7,
+	"wood":               0.85,
+	"metal":              0.85,
+	"unpaved":            0.75,
+	"compacted":          0.8,
+	"fine_gravel":        0.75,
+	"gravel":             0.7,
+	"pebblestone":        0.7,
+	"dirt":               0.7,
+	"earth":              0.7,
+	"ground":             0.7,
+	"grass":              0.6,
+	"sand":               0.6,
+	"mud":                0.5,
+	"ice":                0.5,
+	"snow":               0.5,
+}
+
+// Fraction of the target lateral accel kept on poorly maintained roads
+var SMOOTHNESS_LAT_ACCEL_SCALES = map[string]float64{
+	"intermediate":  0.9,
+	"bad":           0.8,
+	"very_bad":      0.7,
+	"horrible":      0.6,
+	"very_horrible": 0.5,
+	"impassable":    0.5,
+}
+
+type RoadAttributes struct {
+	Tunnel        bool    `json:"tunnel"`
+	Bridge        bool    `json:"bridge"`
+	Layer         int8    `json:"layer"`
+	Surface       string  `json:"surface"`
+	Smoothness    string  `json:"smoothness"`
+	LatAccelScale float64 `json:"lat_accel_scale"`
+	DeadReckoning bool    `json:"dead_reckoning"`
+}
+
+type SurfaceScale struct {
+	Latitude  float64
+	Longitude float64
+	Scale     float64
+	Index     int // point in the StatePath
+}
+
+func ParseLayer(value string) int8 {
+	layer, err := strconv.ParseInt(strings.TrimSpace(value), 10, 8)
+	if err != nil {
+		return 0
+	}
+	return int8(layer)
+}
+
+// The vertical level of a way. Tunnels and bridges without a layer tag are
+// taken to be one level below or above the ground.
+func WayLevel(way Way) int8 {
+	switch {
+	case way.Layer() != 0:
+		return way.Layer()
+	case way.Tunnel():
+		return -1
+	case way.Bridge():
+		return 1
+	}
+	return 0
+}
+
+// Checks if a way starts or ends at a node
+func wayEndsAt(way Way, node Coordinates) bool {
+	start, end := GetWayStartEnd(way, true)
+	return way.HasNodes() && (sameNode(start, node) || sameNode(end, node))
+}
+
+// Keeps the ways on the same level as the current way, if there are any, so
+// that roads crossing above or below are not matched. Ways connected to the
+// ends of the current way are kept on any level so that the road leaving a
+// bridge or tunnel is matched.
+func SameLevelWays(ways []Way, currentWay Way) []Way {
+	if !currentWay.HasNodes() {
+		return ways
+	}
+	start, end := GetWayStartEnd(currentWay, true)
+	sameLevel := []Way{}
+	for _, way := range ways {
+		if WayLevel(way) == WayLevel(currentWay) || wayEndsAt(way, start) || wayEndsAt(way, end) {
+			sameLevel = append(sameLevel, way)
+		}
+	}
+	if len(sameLevel) == 0 {
+		return ways
+	}
+	return sameLevel
+}
+
+func SurfaceLatAccelScale(surface string, smoothness string) float64 {
+	scale := 1.0
+	if s, ok := SURFACE_LAT_ACCEL_SCALES[surface]; ok {
+		scale = s
+	}
+	if s, ok := SMOOTHNESS_LAT_ACCEL_SCALES[smoothness]; ok {
+		scale = math.Min(scale, s)
+	}
+	return math.Max(MIN_LAT_ACCEL_SCALE, scale)
+}
+
+func WayLatAccelScale(way Way) float64 {
+	surface, _ := way.Surface()
+	smoothness, _ := way.Smoothness()
+	return SurfaceLatAccelScale(surface, smoothness)
+}
+
+func GetRoadAttributes(way Way, deadReckoning bool) RoadAttributes {
+	surface, _ := way.Surface()
+	smoothness, _ := way.Smoothness()
+	return RoadAttributes{
+		Tunnel:        way.Tunnel(),
+		Bridge:        way.Bridge(),
+		Layer:         way.Layer(),
+		Surface:       surface,
+		Smoothness:    smoothness,
+		LatAccelScale: SurfaceLatAccelScale(surface, smoothness),
+		DeadReckoning: deadReckoning,
+	}
+}
+
+// The lateral accel scale of the surface at each point of the path
+func GetStateSurfaceScales(state *State) []SurfaceScale {
+	path, err := GetStatePath(state)
+	if err != nil {
+		return []SurfaceScale{}
+	}
+	scales := make([]SurfaceScale, len(path.Points))
+	for i, point := range path.Points {
+		scales[i] = SurfaceScale{Latitude: point.Latitude(), Longitude: point.Longitude(), Scale: path.LatAccelScale[i], Index: i}
+	}
+	return scales
+}
+
+// Moves a distance in meters along the predicted path. The position stops at
+// the end of the path, in which case ok is false.
+func AdvanceAlongPath(pos Position, currentWay CurrentWay, nextWays []NextWayResult, distance float64) (res Position, ok bool) {
+	res = pos
+	lastLat, lastLon, lastDist := pos.Latitude, pos.Longitude, 0.0
+	WalkPathNodes(pos, currentWay, nextWays, func(way Way, index int, dist float64) {
+		if ok {
+			return
+		}
+		nodes, err := way.Nodes()
+		if err != nil {
+			return
+		}
+		node := nodes.At(index)
+		if dist > lastDist {
+			res.Bearing = math.Mod(Bearing(lastLat, lastLon, node.Latitude(), node.Longitude())*TO_DEGREES+360, 360)
+		}
+		if dist >= distance {
+			t := 0.0
+			if dist > lastDist {
+				t = (distance - lastDist) / (dist - lastDist)
+			}
+			res.Latitude = lastLat + t*(node.Latitude()-lastLat)
+			res.Longitude = lastLon + t*(node.Longitude()-lastLon)
+			ok = true
+			return
+		}
+		lastLat, lastLon, lastDist = node.Latitude(), node.Longitude(), dist
+		res.Latitude, res.Longitude = lastLat, lastLon
+	})
+	return res, ok || distance <= 0
+}
+
+// Holds the matched way through tunnels where the GPS fix drifts by moving
+// the position along the predicted path at the speed measured before the
+// tunnel. The position is not moved past the end of the tunnel.
+type DeadReckoning struct {
+	Active   bool
+	Expired  bool      // set when TUNNEL_HOLD_TIME ran out, until the tunnel is left
+	Position Position  // last GPS fix or reckoned position
+	Time     time.Time // when Position was taken
+	Start    time.Time // when dead reckoning started
+	Speed    float64   // m/s. measured from the GPS fixes before the tunnel
+}
+
+// Returns the position to match ways against. This is the GPS fix unless the
+// current way is a tunnel.
+func (d *DeadReckoning) Update(fix Position, now time.Time, currentWay CurrentWay, nextWays []NextWayResult) Position {
+	inTunnel := currentWay.Way.HasNodes() && currentWay.Way.Tunnel()
+	if !inTunnel {
+		d.Expired = false
+	}
+	if inTunnel && !d.Active && !d.Expired {
+		d.Active = true
+		d.Start = now
+	}
+	if d.Active && (now.Sub(d.Start) > TUNNEL_HOLD_TIME || !inTunnel) {
+		// the GPS fix takes over again once the reckoned position left the
+		// tunnel, the speed is measured again from the next fixes
+		d.Active = false
+		d.Expired = inTunnel
+		d.Time = time.Time{}
+	}
+
+	if !d.Active {
+		if !d.Time.IsZero() && (fix.Latitude != d.Position.Latitude || fix.Longitude != d.Position.Longitude) {
+			age := now.Sub(d.Time)
+			if age > 0 && age <= MAX_SPEED_FIX_AGE {
+				speed := DistanceToPoint(d.Position.Latitude*TO_RADIANS, d.Position.Longitude*TO_RADIANS, fix.Latitude*TO_RADIANS, fix.Longitude*TO_RADIANS) / age.Seconds()
+				if speed <= MAX_RECKONING_SPEED {
+					d.Speed = speed
+				}
+			}
+		}
+		if d.Time.IsZero() || fix.Latitude != d.Position.Latitude || fix.Longitude != d.Position.Longitude {
+			d.Position = fix
+			d.Time = now
+		}
+		return fix
+	}
+
+	// a tunnel may be split into several ways
+	tunnelWays := []NextWayResult{}
+	for _, nextWay := range nextWays {
+		if !nextWay.Way.Tunnel() {
+			break
+		}
+		tunnelWays = append(tunnelWays, nextWay)
+	}
+	distance := d.Speed * now.Sub(d.Time).Seconds()
+	position, inside := AdvanceAlongPath(d.Position, currentWay, tunnelWays, distance)
+	d.Position = position
+	d.Time = now
+	if !inside {
+		// the reckoned position reached the end of the tunnel, the GPS fix
+		// takes over from the next update
+		d.Active = false
+		d.Expired = true
+		d.Time = time.Time{}
+	}
+	return d.Position
+}
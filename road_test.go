@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/bradleyjkemp/cupaloy"
+)
+
+func roadTestWay(id int64, tunnel bool, nodes ...TmpNode) TmpWay {
+	way := TmpWay{Id: id, Tunnel: tunnel, Nodes: nodes, MinLat: 90, MinLon: 180, MaxLat: -90, MaxLon: -180}
+	for _, node := range nodes {
+		way.MinLat = math.Min(way.MinLat, node.Latitude)
+		way.MinLon = math.Min(way.MinLon, node.Longitude)
+		way.MaxLat = math.Max(way.MaxLat, node.Latitude)
+		way.MaxLon = math.Max(way.MaxLon, node.Longitude)
+	}
+	return way
+}
+
+func TestDeadReckoning(t *testing.T) {
+	// a tunnel heading east in two ways with a surface road crossing above it
+	// and the road leaving the tunnel
+	area := Area{MinLat: -0.01, MinLon: -0.01, MaxLat: 0.01, MaxLon: 0.04, Ways: []TmpWay{
+		roadTestWay(1, true, TmpNode{Latitude: 0, Longitude: 0}, TmpNode{Latitude: 0, Longitude: 0.01}),
+		roadTestWay(2, false, TmpNode{Latitude: -0.001, Longitude: 0.002}, TmpNode{Latitude: 0.001, Longitude: 0.002}),
+		roadTestWay(3, true, TmpNode{Latitude: 0, Longitude: 0.01}, TmpNode{Latitude: 0, Longitude: 0.02}),
+		roadTestWay(4, false, TmpNode{Latitude: 0, Longitude: 0.02}, TmpNode{Latitude: 0, Longitude: 0.03}),
+	}}
+	_, offline := NewOfflineMessage(area, nil, CoordinateEncoding_float64)
+
+	start := time.Unix(0, 0)
+	entry := Position{Latitude: 0, Longitude: 0.0005, Bearing: 90}
+	currentWay, err := GetCurrentWay(CurrentWay{}, nil, offline, entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nextWays, err := NextWays(entry, currentWay, nil, offline, currentWay.OnWay.IsForward)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reckoning := DeadReckoning{Position: entry, Time: start, Speed: 20}
+
+	results := ""
+	// the drifting fix lands on the road above, the position follows the
+	// tunnel instead and stops at its end although the speed would carry it
+	// further
+	for _, step := range []struct {
+		seconds int
+		fix     Position
+	}{
+		{5, Position{Latitude: 0.0008, Longitude: 0.002, Bearing: 0}},
+		{10, Position{Latitude: 0.0009, Longitude: 0.0021, Bearing: 0}},
+		{115, Position{Latitude: 0.0009, Longitude: 0.0021, Bearing: 0}},
+		{116, Position{Latitude: 0, Longitude: 0.0205, Bearing: 90}},
+	} {
+		pos := reckoning.Update(step.fix, start.Add(time.Duration(step.seconds)*time.Second), currentWay, nextWays)
+		currentWay, err = GetCurrentWay(currentWay, nextWays, offline, pos)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nextWays, err = NextWays(pos, currentWay, nextWays, offline, currentWay.OnWay.IsForward)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results += fmt.Sprintf("%ds: lat=%.6f lon=%.6f bearing=%.0f way=%d active=%v expired=%v\n", step.seconds, pos.Latitude, pos.Longitude, pos.Bearing, currentWay.Way.Id(), reckoning.Active, reckoning.Expired)
+	}
+
+	cupaloy.SnapshotT(t, results)
+}
+
+func TestSameLevelWays(t *testing.T) {
+	// a bridge heading east, the road it crosses and the roads at both of its ends
+	area := Area{MinLat: -0.01, MinLon: -0.01, MaxLat: 0.01, MaxLon: 0.03, Ways: []TmpWay{
+		roadTestWay(1, false, TmpNode{Latitude: 0, Longitude: 0.01}, TmpNode{Latitude: 0, Longitude: 0.02}),
+		roadTestWay(2, false, TmpNode{Latitude: -0.001, Longitude: 0.015}, TmpNode{Latitude: 0.001, Longitude: 0.015}),
+		roadTestWay(3, false, TmpNode{Latitude: 0, Longitude: 0.02}, TmpNode{Latitude: 0, Longitude: 0.03}),
+		roadTestWay(4, false, TmpNode{Latitude: 0, Longitude: 0}, TmpNode{Latitude: 0, Longitude: 0.01}),
+		roadTestWay(5, false, TmpNode{Latitude: 0.001, Longitude: 0.02}, TmpNode{Latitude: 0.002, Longitude: 0.02}),
+	}}
+	area.Ways[0].Bridge = true
+	_, offline := NewOfflineMessage(area, nil, CoordinateEncoding_float64)
+	ways, err := offline.Ways()
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := []Way{}
+	for i := 0; i < ways.Len(); i++ {
+		all = append(all, ways.At(i))
+	}
+
+	results := ""
+	for _, current := range []Way{ways.At(0), ways.At(1), {}} {
+		results += fmt.Sprintf("current way %d:", current.Id())
+		for _, way := range SameLevelWays(all, current) {
+			results += fmt.Sprintf(" %d", way.Id())
+		}
+		results += "\n"
+	}
+
+	cupaloy.SnapshotT(t, results)
+}
+
+func TestSurfaceLatAccelScale(t *testing.T) {
+	results := ""
+	for _, tags := range [][2]string{{"asphalt", ""}, {"gravel", ""}, {"asphalt", "bad"}, {"gravel", "very_horrible"}, {"", ""}} {
+		results += fmt.Sprintf("%s/%s=%.2f\n", tags[0], tags[1], SurfaceLatAccelScale(tags[0], tags[1]))
+	}
+
+	cupaloy.SnapshotT(t, results)
+}
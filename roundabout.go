@@ -0,0 +1,291 @@
+package main
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+var MAX_ROUNDABOUT_SEGMENTS = 16 // how many split ring ways to follow before giving up on finding an exit
+
+type Roundabout struct {
+	Latitude      float64 `json:"latitude"`
+	Longitude     float64 `json:"longitude"`
+	ExitLatitude  float64 `json:"exit_latitude"`
+	ExitLongitude float64 `json:"exit_longitude"`
+	Distance      float64 `json:"distance"`
+	ExitDistance  float64 `json:"exit_distance"`
+	Radius        float64 `json:"radius"`
+	EntrySpeed    float64 `json:"entry_speed"`
+	OnRoundabout  bool    `json:"on_roundabout"`
+	WayId         uint64  `json:"way_id"`
+}
+
+func IsRoundabout(way Way) bool {
+	junction, err := way.Junction()
+	if err != nil {
+		return false
+	}
+	return junction == "roundabout" || junction == "circular"
+}
+
+func sameNode(a Coordinates, b Coordinates) bool {
+	return a.Latitude() == b.Latitude() && a.Longitude() == b.Longitude()
+}
+
+func nodeDistance(a Coordinates, b Coordinates) float64 {
+	return DistanceToPoint(a.Latitude()*TO_RADIANS, a.Longitude()*TO_RADIANS, b.Latitude()*TO_RADIANS, b.Longitude()*TO_RADIANS)
+}
+
+// Estimates the radius of a roundabout. Closed rings use their perimeter, split
+// ring segments use the circle through their first, middle and last node.
+func RoundaboutRadius(way Way) float64 {
+	nodes, err := way.Nodes()
+	if err != nil || nodes.Len() < 3 {
+		return 0
+	}
+	first := nodes.At(0)
+	last := nodes.At(nodes.Len() - 1)
+	if sameNode(first, last) {
+		perimeter := 0.0
+		for i := 0; i < nodes.Len()-1; i++ {
+			perimeter += nodeDistance(nodes.At(i), nodes.At(i+1))
+		}
+		return perimeter / (2 * math.Pi)
+	}
+	mid := nodes.At(nodes.Len() / 2)
+	curv, _, _ := GetCurvature(first.Latitude(), first.Longitude(), mid.Latitude(), mid.Longitude(), last.Latitude(), last.Longitude())
+	if curv == 0 {
+		return 0
+	}
+	return 1 / curv
+}
+
+// Recommended speed for entering a roundabout based on its radius and the
+// target lateral acceleration, capped by the ring's speed limit.
+func RoundaboutEntrySpeed(way Way) float64 {
+	radius := RoundaboutRadius(way)
+	if radius == 0 {
+		return 0
+	}
+	speed := math.Sqrt(TARGET_LAT_ACCEL * radius)
+	maxSpeed := getDirectionalMaxSpeed(way, true)
+	if maxSpeed > 0 && maxSpeed < speed {
+		return maxSpeed
+	}
+	return speed
+}
+
+type roundaboutExitCandidate struct {
+	way       Way
+	isForward bool
+	node      Coordinates
+	distance  float64
+	bearing   float64
+}
+
+// Returns the id of the way the previous prediction expected to leave a
+// roundabout on, or 0 if there was none.
+func predictedRoundaboutExit(nextWays []NextWayResult) int64 {
+	for i, nextWay := range nextWays {
+		if IsRoundabout(nextWay.Way) {
+			for _, exit := range nextWays[i+1:] {
+				if !IsRoundabout(exit.Way) {
+					return exit.Way.Id()
+				}
+			}
+			return 0
+		}
+	}
+	if len(nextWays) > 0 {
+		return nextWays[0].Way.Id()
+	}
+	return 0
+}
+
+// Walks the ring from the entry node in the direction of travel and picks the
+// way that is expected to be used to leave the roundabout. The returned
+// distance is measured along the ring from the entry node to the exit node.
+func RoundaboutExit(ring Way, entry Coordinates, from Way, fromForward bool, preferredExit int64, offline Offline) (NextWayResult, float64, error) {
+	nodes, err := ring.Nodes()
+	if err != nil {
+		return NextWayResult{}, 0, errors.Wrap(err, "could not read roundabout nodes")
+	}
+
+	index := -1
+	for i := 0; i < nodes.Len(); i++ {
+		if sameNode(nodes.At(i), entry) {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return NextWayResult{}, 0, errors.New("entry node is not part of the roundabout")
+	}
+
+	entryBearing := math.NaN()
+	fromNodes, err := from.Nodes()
+	if err == nil && fromNodes.Len() > 1 {
+		if fromForward {
+			entryBearing = Bearing(fromNodes.At(fromNodes.Len()-2).Latitude(), fromNodes.At(fromNodes.Len()-2).Longitude(), entry.Latitude(), entry.Longitude())
+		} else {
+			entryBearing = Bearing(fromNodes.At(1).Latitude(), fromNodes.At(1).Longitude(), entry.Latitude(), entry.Longitude())
+		}
+	}
+
+	candidates := []roundaboutExitCandidate{}
+	segment := ring
+	dist := 0.0
+	prev := entry
+	for segments := 0; segments < MAX_ROUNDABOUT_SEGMENTS; {
+		index++
+		if index >= nodes.Len() {
+			last := nodes.At(nodes.Len() - 1)
+			if sameNode(nodes.At(0), last) {
+				index = 1
+			} else {
+				// continue onto the next part of a split ring
+				matchingWays, err := MatchingWays(segment, offline, last)
+				if err != nil {
+					return NextWayResult{}, 0, errors.Wrap(err, "could not find next roundabout segment")
+				}
+				found := false
+				for _, mWay := range matchingWays {
+					mNodes, err := mWay.Nodes()
+					if err != nil || !IsRoundabout(mWay) || !sameNode(mNodes.At(0), last) {
+						continue
+					}
+					segment = mWay
+					nodes = mNodes
+					index = 1
+					found = true
+					break
+				}
+				if !found {
+					break
+				}
+				segments++
+			}
+			if index >= nodes.Len() {
+				break
+			}
+		}
+
+		node := nodes.At(index)
+		dist += nodeDistance(prev, node)
+		prev = node
+		if sameNode(node, entry) {
+			break
+		}
+
+		matchingWays, err := MatchingWays(segment, offline, node)
+		if err != nil {
+			return NextWayResult{}, 0, errors.Wrap(err, "could not find roundabout exits")
+		}
+		for _, mWay := range matchingWays {
+			if IsRoundabout(mWay) || mWay.Id() == from.Id() {
+				continue
+			}
+			isForward := NextIsForward(mWay, node)
+			if !isForward && mWay.OneWay() {
+				continue
+			}
+			mNodes, err := mWay.Nodes()
+			if err != nil {
+				continue
+			}
+			bearingNode := mNodes.At(1)
+			if !isForward {
+				bearingNode = mNodes.At(mNodes.Len() - 2)
+			}
+			candidates = append(candidates, roundaboutExitCandidate{
+				way:       mWay,
+				isForward: isForward,
+				node:      node,
+				distance:  dist,
+				bearing:   Bearing(node.Latitude(), node.Longitude(), bearingNode.Latitude(), bearingNode.Longitude()),
+			})
+		}
+	}
+
+	if len(candidates) == 0 {
+		return NextWayResult{}, dist, nil
+	}
+
+	exit := candidates[0]
+	name, _ := from.Name()
+	ref, _ := from.Ref()
+	matched := false
+	bestDelta := math.MaxFloat64
+	for _, candidate := range candidates {
+		if preferredExit != 0 && candidate.way.Id() == preferredExit {
+			exit = candidate
+			break
+		}
+		if matched {
+			continue
+		}
+		cName, _ := candidate.way.Name()
+		cRef, _ := candidate.way.Ref()
+		if (len(name) > 0 && cName == name) || (len(ref) > 0 && cRef == ref) {
+			exit = candidate
+			matched = true
+			continue
+		}
+		if math.IsNaN(entryBearing) {
+			continue
+		}
+		// otherwise prefer the exit that continues closest to straight through
+		delta := math.Abs(math.Atan2(math.Sin(candidate.bearing-entryBearing), math.Cos(candidate.bearing-entryBearing)))
+		if delta < bestDelta {
+			bestDelta = delta
+			exit = candidate
+		}
+	}
+
+	start, end := GetWayStartEnd(exit.way, exit.isForward)
+	return NextWayResult{
+		Way:           exit.way,
+		IsForward:     exit.isForward,
+		StartPosition: start,
+		EndPosition:   end,
+	}, exit.distance, nil
+}
+
+func GetRoundabout(currentWay CurrentWay, nextWays []NextWayResult) Roundabout {
+	if IsRoundabout(currentWay.Way) {
+		res := Roundabout{
+			OnRoundabout: true,
+			Radius:       RoundaboutRadius(currentWay.Way),
+			EntrySpeed:   RoundaboutEntrySpeed(currentWay.Way),
+			WayId:        uint64(currentWay.Way.Id()),
+		}
+		if len(nextWays) > 0 && !IsRoundabout(nextWays[0].Way) {
+			res.ExitLatitude = nextWays[0].StartPosition.Latitude()
+			res.ExitLongitude = nextWays[0].StartPosition.Longitude()
+			res.ExitDistance = nextWays[0].Distance
+		}
+		return res
+	}
+
+	for i, nextWay := range nextWays {
+		if !IsRoundabout(nextWay.Way) {
+			continue
+		}
+		res := Roundabout{
+			Latitude:   nextWay.StartPosition.Latitude(),
+			Longitude:  nextWay.StartPosition.Longitude(),
+			Distance:   nextWay.Distance,
+			Radius:     RoundaboutRadius(nextWay.Way),
+			EntrySpeed: RoundaboutEntrySpeed(nextWay.Way),
+			WayId:      uint64(nextWay.Way.Id()),
+		}
+		if i+1 < len(nextWays) {
+			res.ExitLatitude = nextWays[i+1].StartPosition.Latitude()
+			res.ExitLongitude = nextWays[i+1].StartPosition.Longitude()
+			res.ExitDistance = nextWays[i+1].Distance
+		}
+		return res
+	}
+	return Roundabout{}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/bradleyjkemp/cupaloy"
+)
+
+// A roundabout of about 33 meters radius at 0, 0.005 with Main St entering
+// from the west and leaving to the east and Side St leaving to the north
+func roundaboutTestOffline() Offline {
+	center, radius := TmpNode{Latitude: 0, Longitude: 0.005}, 0.0003
+	ring := []TmpNode{}
+	// counterclockwise from the west node like traffic on the right drives
+	for i := 0; i <= 8; i++ {
+		angle := math.Pi + float64(i%8)*math.Pi/4
+		ring = append(ring, TmpNode{Latitude: center.Latitude + radius*math.Sin(angle), Longitude: center.Longitude + radius*math.Cos(angle)})
+	}
+	ring[0].Latitude, ring[4].Latitude, ring[8].Latitude = 0, 0, 0
+	west, east, north := ring[0], ring[4], ring[6]
+	ringWay := roadTestWay(1, false, ring...)
+	ringWay.Junction = "roundabout"
+	ringWay.OneWay = true
+	ringWay.MaxSpeed = 5
+	entry := roadTestWay(2, false, TmpNode{Latitude: 0.001, Longitude: 0}, TmpNode{Latitude: 0, Longitude: 0.002}, west)
+	entry.Name = "Main St"
+	exit := roadTestWay(3, false, east, TmpNode{Latitude: 0, Longitude: 0.006}, TmpNode{Latitude: 0, Longitude: 0.007},
+		TmpNode{Latitude: 0.0005, Longitude: 0.008}, TmpNode{Latitude: 0.001, Longitude: 0.009}, TmpNode{Latitude: 0.002, Longitude: 0.01})
+	exit.Name = "Main St"
+	side := roadTestWay(4, false, north, TmpNode{Latitude: 0.003, Longitude: 0.005})
+	side.Name = "Side St"
+
+	area := Area{MinLat: -0.01, MinLon: -0.01, MaxLat: 0.01, MaxLon: 0.02, Ways: []TmpWay{ringWay, entry, exit, side}}
+	_, offline := NewOfflineMessage(area, nil, CoordinateEncoding_float64)
+	return offline
+}
+
+func roundaboutTestState(t *testing.T, offline Offline, pos Position) *State {
+	currentWay, err := GetCurrentWay(CurrentWay{}, nil, offline, pos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nextWays, err := NextWays(pos, currentWay, nil, offline, currentWay.OnWay.IsForward)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &State{CurrentWay: currentWay, NextWays: nextWays, Position: pos}
+}
+
+func TestRoundaboutExit(t *testing.T) {
+	offline := roundaboutTestOffline()
+	offlineWays, err := offline.Ways()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ways := map[int64]Way{}
+	for i := 0; i < offlineWays.Len(); i++ {
+		way := offlineWays.At(i)
+		ways[way.Id()] = way
+	}
+	ring, entry := ways[1], ways[2]
+	entryNodes, _ := entry.Nodes()
+	entryNode := entryNodes.At(entryNodes.Len() - 1)
+
+	results := fmt.Sprintf("radius=%.1f entry speed=%.2f\n", RoundaboutRadius(ring), RoundaboutEntrySpeed(ring))
+	for _, test := range []struct {
+		name      string
+		from      Way
+		preferred int64
+	}{
+		{"same name", entry, 0},
+		{"preferred", entry, 4},
+		{"no entry way", Way{}, 0},
+	} {
+		exit, dist, err := RoundaboutExit(ring, entryNode, test.from, true, test.preferred, offline)
+		results += fmt.Sprintf("%s: way=%d forward=%v ring distance=%.1f err=%v\n", test.name, exit.Way.Id(), exit.IsForward, dist, err)
+	}
+
+	cupaloy.SnapshotT(t, results)
+}
+
+func TestGetRoundabout(t *testing.T) {
+	offline := roundaboutTestOffline()
+
+	results := ""
+	for _, test := range []struct {
+		name string
+		pos  Position
+	}{
+		{"approaching", Position{Latitude: 0.0002, Longitude: 0.0016, Bearing: 96}},
+		{"on ring", Position{Latitude: -0.00021, Longitude: 0.00479, Bearing: 135}},
+	} {
+		state := roundaboutTestState(t, offline, test.pos)
+		roundabout := GetRoundabout(state.CurrentWay, state.NextWays)
+		results += fmt.Sprintf("%s: on=%v way=%d distance=%.1f exit=%.5f,%.5f exit distance=%.1f radius=%.1f entry speed=%.2f\n",
+			test.name, roundabout.OnRoundabout, roundabout.WayId, roundabout.Distance, roundabout.ExitLatitude, roundabout.ExitLongitude,
+			roundabout.ExitDistance, roundabout.Radius, roundabout.EntrySpeed)
+
+		// the curvatures continue past the ring onto the exit road
+		curvatures, err := GetStateCurvatures(state)
+		last := Curvature{}
+		if len(curvatures) > 0 {
+			last = curvatures[len(curvatures)-1]
+		}
+		results += fmt.Sprintf("  curvatures=%d last=%.5f,%.5f err=%v\n", len(curvatures), last.Latitude, last.Longitude, err)
+	}
+
+	cupaloy.SnapshotT(t, results)
+}
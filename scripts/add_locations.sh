@@ -1,2 +0,0 @@
-#!/bin/bash
-osmium add-locations-to-ways box.osm.pbf -o map.osm.pbf --overwrite
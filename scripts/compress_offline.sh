@@ -2,3 +2,4 @@
 for line in `find offline/*/* -type d`;
 do tar -czvf ${line}.tar.gz $line;
 done
+./mapd --write-manifests
@@ -1,2 +1,2 @@
 #!/bin/bash
-osmium tags-filter planet-daily.osm.pbf "nw/highway=motorway,trunk,primary,secondary,tertiary,unclassified,residential,motorway_link,trunk_link,primary_link,secondary_link,tertiary_link" -o filtered.osm.pbf --overwrite
+osmium tags-filter planet-daily.osm.pbf "nw/highway=motorway,trunk,primary,secondary,tertiary,unclassified,residential,motorway_link,trunk_link,primary_link,secondary_link,tertiary_link" "n/highway=speed_camera" "r/type=enforcement" -o filtered.osm.pbf --overwrite
@@ -14,9 +14,7 @@ do
     max_lon=$(($i+20))
     max_lat=$(($j+20))
     echo "$i $j $max_lon $max_lat"
-    ./extract_box.sh $i $j $max_lon $max_lat
-    ./add_locations.sh
-    ./mapd --generate --minlat $j --minlon $i --maxlat $max_lat --maxlon $max_lon
+    ./mapd --generate --input filtered.osm.pbf --bbox $(($i-1)),$(($j-1)),$(($max_lon+1)),$(($max_lat+1)) --minlat $j --minlon $i --maxlat $max_lat --maxlon $max_lon --report report_${i}_${j}.json
     #./compress_offline.sh
     ./upload_small_offline_comma.sh
     rm -r offline
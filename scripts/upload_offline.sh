@@ -1,3 +1,3 @@
 #!/bin/bash
 
-rclone copy offline r2:osm-map-data/offline/ --progress --include **/*.tar.gz
+rclone copy offline r2:osm-map-data/offline/ --progress --include **/*.tar.gz --include **/*.manifest.json
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	DEFAULT_DOWNLOAD_SOURCES = []string{"https://map-data.pfeifer.dev"}
+	DOWNLOAD_SOURCES         = []string{} // set by the -download-sources flag, takes precedence over the OSMDownloadSources param
+)
+
+// Fetches map data over http(s). A redirect may not change the scheme, so a
+// remote source can not send mapd to another protocol such as file://.
+var downloadClient = &http.Client{CheckRedirect: checkRedirect}
+
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	if req.URL.Scheme != via[0].URL.Scheme {
+		return errors.Errorf("redirect from %s to %s changes the scheme", via[0].URL.Redacted(), req.URL.Redacted())
+	}
+	return nil
+}
+
+// Serves the files below the directory of a local source
+type fileSourceTransport struct {
+	root  string
+	files http.RoundTripper
+}
+
+func (t fileSourceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !strings.HasPrefix(req.URL.Path, t.root+"/") {
+		return nil, errors.Errorf("%s is outside of the map data source %s", req.URL.Redacted(), t.root)
+	}
+	req = req.Clone(req.Context())
+	req.URL.Path = strings.TrimPrefix(req.URL.Path, t.root)
+	return t.files.RoundTrip(req)
+}
+
+// The client to fetch a map data url with. A file:// url gets a client that
+// only reads below the source directory it was built from, so local sources
+// resume and fail the same way as remote ones.
+func sourceClient(rawURL string) (*http.Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not parse map data url")
+	}
+	if u.Scheme != "file" {
+		return downloadClient, nil
+	}
+	i := strings.LastIndex(u.Path, "/offline/")
+	if i < 0 {
+		return nil, errors.Errorf("%s is not in the offline directory of a map data source", rawURL)
+	}
+	root := u.Path[:i]
+	dir := filepath.FromSlash(root)
+	if len(root) == 0 {
+		dir = "/"
+	}
+	transport := &http.Transport{}
+	transport.RegisterProtocol("file", fileSourceTransport{root: root, files: http.NewFileTransport(http.Dir(dir))})
+	return &http.Client{Transport: transport}, nil
+}
+
+// Turns a source into the base url that the offline directory is found in. A
+// source is an http(s) or file:// url or a local directory.
+func NormalizeSource(source string) (string, error) {
+	source = strings.TrimSpace(source)
+	if len(source) == 0 {
+		return "", errors.New("empty map data source")
+	}
+	if !strings.Contains(source, "://") {
+		dir, err := filepath.Abs(source)
+		if err != nil {
+			return "", errors.Wrap(err, "could not get absolute path of map data source")
+		}
+		return strings.TrimSuffix((&url.URL{Scheme: "file", Path: filepath.ToSlash(dir)}).String(), "/"), nil
+	}
+	u, err := url.Parse(source)
+	if err != nil {
+		return "", errors.Wrap(err, "could not parse map data source")
+	}
+	switch u.Scheme {
+	case "http", "https":
+		if len(u.Host) == 0 {
+			return "", errors.Errorf("map data source %s has no host", source)
+		}
+	case "file":
+		if len(u.Host) > 0 && u.Host != "localhost" {
+			return "", errors.Errorf("map data source %s is on another host", source)
+		}
+	default:
+		return "", errors.Errorf("map data source %s has unsupported scheme %s", source, u.Scheme)
+	}
+	return strings.TrimSuffix(source, "/"), nil
+}
+
+// Reads a list of sources written either as a json array or separated by
+// commas or new lines
+func ParseSources(data []byte) ([]string, error) {
+	sources := []string{}
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+		err := json.Unmarshal(data, &sources)
+		return sources, errors.Wrap(err, "could not unmarshal map data sources")
+	}
+	for _, source := range strings.FieldsFunc(string(data), func(r rune) bool { return r == ',' || r == '\n' }) {
+		source = strings.TrimSpace(source)
+		if len(source) > 0 {
+			sources = append(sources, source)
+		}
+	}
+	return sources, nil
+}
+
+// The sources to download map data from in the order they are tried: the
+// -download-sources flag, else the persistent OSMDownloadSources param, else
+// the default server. Invalid sources are skipped.
+func DownloadSources() []string {
+	sources := DOWNLOAD_SOURCES
+	if len(sources) == 0 {
+		b, err := GetParam(DOWNLOAD_SOURCES_PERSIST)
+		if err == nil && len(b) > 0 {
+			sources, err = ParseSources(b)
+			logwe(errors.Wrap(err, "could not read map data sources"))
+		}
+	}
+	normalized := []string{}
+	for _, source := range sources {
+		base, err := NormalizeSource(source)
+		if err != nil {
+			logwe(errors.Wrap(err, "skipping map data source"))
+			continue
+		}
+		normalized = append(normalized, base)
+	}
+	if len(normalized) == 0 {
+		return DEFAULT_DOWNLOAD_SOURCES
+	}
+	log.Info().Strs("sources", normalized).Msg("Using map data sources")
+	return normalized
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bradleyjkemp/cupaloy"
+)
+
+// Points the download, install and offline directories into a temp dir for one test
+func useTestDirs(t *testing.T) string {
+	base := t.TempDir()
+	boundsDir, stagingDir, previousDir, downloadDir, registryPath := BOUNDS_DIR, STAGING_DIR, PREVIOUS_DIR, DOWNLOAD_DIR, REGISTRY_PATH
+	t.Cleanup(func() {
+		BOUNDS_DIR, STAGING_DIR, PREVIOUS_DIR, DOWNLOAD_DIR, REGISTRY_PATH = boundsDir, stagingDir, previousDir, downloadDir, registryPath
+	})
+	BOUNDS_DIR = filepath.Join(base, "offline")
+	STAGING_DIR = filepath.Join(base, "staging")
+	PREVIOUS_DIR = filepath.Join(base, "previous")
+	DOWNLOAD_DIR = filepath.Join(base, "tmp")
+	REGISTRY_PATH = filepath.Join(base, "installed_groups.json")
+	return base
+}
+
+func TestDownloadGroupSources(t *testing.T) {
+	base := useTestDirs(t)
+	tileName := "offline/38/-76/38.000000_-76.000000_38.250000_-75.750000"
+
+	results := ""
+	for _, source := range []string{"https://maps.example.com/", "file:///media/usb", "/media/usb/", "ftp://maps.example.com", "file://nas/maps", ""} {
+		normalized, err := NormalizeSource(source)
+		results += fmt.Sprintf("source %q: %q %v\n", source, normalized, err)
+	}
+	parsed, _ := ParseSources([]byte("https://a.example.com, /media/usb\nfile:///mnt"))
+	results += fmt.Sprintf("parsed list: %q\n", parsed)
+	parsed, _ = ParseSources([]byte(`["https://a.example.com", "/media/usb"]`))
+	results += fmt.Sprintf("parsed json: %q\n", parsed)
+
+	// a group on a usb drive, served by a mirror and missing from another
+	usb := t.TempDir()
+	writeTestGroup(t, usb, map[string]string{tileName: "usb release"})
+	err := WriteGroupManifests(usb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mirror := t.TempDir()
+	writeTestGroup(t, mirror, map[string]string{tileName: "mirror release"})
+	err = WriteGroupManifests(mirror)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.FileServer(http.Dir(mirror)))
+	defer server.Close()
+	missing, err := NormalizeSource(filepath.Join(t.TempDir(), "missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, err := NormalizeSource(usb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sources := range [][]string{{missing, local, server.URL}, {missing, server.URL, local}, {missing}} {
+		downloaded, err := DownloadGroup(context.Background(), sources, 38, -76)
+		data, _ := os.ReadFile(filepath.Join(base, tileName))
+		names := []string{}
+		for _, source := range sources {
+			names = append(names, map[string]string{missing: "missing", local: "usb", server.URL: "mirror"}[source])
+		}
+		results += fmt.Sprintf("%s: downloaded=%v failed=%v tile=%q\n", strings.Join(names, ","), downloaded, err != nil, data)
+	}
+	_, err = os.Stat(filepath.Join(usb, "offline", "38", "-76.tar.gz"))
+	results += fmt.Sprintf("usb archive kept: %v\n", err == nil)
+
+	// the staging directory can not be created below a file
+	blocker := filepath.Join(base, "blocker")
+	err = os.WriteFile(blocker, nil, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	STAGING_DIR = filepath.Join(blocker, "staging")
+	downloaded, err := DownloadGroup(context.Background(), []string{local}, 38, -76)
+	results += fmt.Sprintf("install failed: downloaded=%v failed=%v\n", downloaded, err != nil)
+
+	cupaloy.SnapshotT(t, results)
+}
+
+func TestSourceClient(t *testing.T) {
+	base := t.TempDir()
+	source := filepath.Join(base, "mirror")
+	for name, content := range map[string]string{
+		filepath.Join(source, "offline", "38", "-76.manifest"): "{}",
+		filepath.Join(base, "secret.manifest"):                 "{}",
+	} {
+		err := os.MkdirAll(filepath.Dir(name), 0o775)
+		if err == nil {
+			err = os.WriteFile(name, []byte(content), 0o644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	sourceURL, err := NormalizeSource(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a remote source that redirects to a local file
+	server := httptest.NewServer(http.RedirectHandler("file://"+filepath.ToSlash(filepath.Join(base, "secret.manifest")), http.StatusFound))
+	defer server.Close()
+
+	results := ""
+	for _, url := range []string{
+		sourceURL + "/offline/38/-76.manifest",
+		sourceURL + "/offline/../../secret.manifest",
+		"file://" + filepath.ToSlash(filepath.Join(base, "secret.manifest")),
+		server.URL + "/offline/38/-76.manifest",
+	} {
+		_, err := FetchManifest(context.Background(), url)
+		results += fmt.Sprintf("%s: %v\n", url, err)
+	}
+
+	results = strings.ReplaceAll(results, server.URL, "<server>")
+	cupaloy.SnapshotT(t, strings.ReplaceAll(results, filepath.ToSlash(base), "<base>"))
+}
+
+func TestDownloadGroupWithoutManifest(t *testing.T) {
+	base := useTestDirs(t)
+	requireManifests := REQUIRE_MANIFESTS_PERSIST
+	defer func() { REQUIRE_MANIFESTS_PERSIST = requireManifests }()
+	REQUIRE_MANIFESTS_PERSIST = filepath.Join(base, "params", "d", "OSMRequireManifests")
+	err := os.MkdirAll(filepath.Dir(REQUIRE_MANIFESTS_PERSIST), 0o775)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tileName := "offline/38/-76/38.000000_-76.000000_38.250000_-75.750000"
+	// a source that does not publish manifests yet
+	mirror := t.TempDir()
+	writeTestGroup(t, mirror, map[string]string{tileName: "unverified release"})
+	source, err := NormalizeSource(mirror)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := ""
+	download := func(step string) {
+		downloaded, err := DownloadGroup(context.Background(), []string{source}, 38, -76)
+		data, _ := os.ReadFile(filepath.Join(base, tileName))
+		registry, _ := ReadRegistry()
+		installed := registry["38/-76"]
+		results += fmt.Sprintf("%s: downloaded=%v tile=%q files=%d fingerprint=%v err=%v\n", step, downloaded, data, installed.Files, len(installed.Fingerprint) > 0, err)
+	}
+	err = PutParam(REQUIRE_MANIFESTS_PERSIST, []byte("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	download("required")
+	err = PutParam(REQUIRE_MANIFESTS_PERSIST, []byte("0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	download("unverified")
+
+	cupaloy.SnapshotT(t, strings.ReplaceAll(results, source, "<source>"))
+}
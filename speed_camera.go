@@ -0,0 +1,347 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/paulmach/osm"
+	"github.com/pkg/errors"
+)
+
+var (
+	SPEED_CAMERA_MATCH_DISTANCE    = 30.0 // meters. how far a camera may be from the path and still be considered on it
+	SPEED_CAMERA_BEARING_TOLERANCE = 60.0 // degrees. how far the travel bearing may differ from the enforced bearing
+)
+
+var cardinalBearings = map[string]float64{
+	"N": 0, "NNE": 22.5, "NE": 45, "ENE": 67.5,
+	"E": 90, "ESE": 112.5, "SE": 135, "SSE": 157.5,
+	"S": 180, "SSW": 202.5, "SW": 225, "WSW": 247.5,
+	"W": 270, "WNW": 292.5, "NW": 315, "NNW": 337.5,
+}
+
+type TmpSpeedCamera struct {
+	Id               int64
+	Latitude         float64
+	Longitude        float64
+	MaxSpeed         float64
+	Bearing          float64
+	HasBearing       bool
+	HasLocation      bool
+	WayBearing       float64 // degrees. the bearing of a way through the camera node in the direction the way is drawn
+	HasWayBearing    bool
+	Direction        string
+	Enforcement      string
+	ZoneEndLatitude  float64
+	ZoneEndLongitude float64
+	FromNode         osm.NodeID
+	ToNode           osm.NodeID
+	Relation         osm.RelationID // the enforcement relation applied to the camera, 0 if none
+	Tagged           bool           // the node itself is tagged highway=speed_camera
+	TaggedMaxSpeed   float64        // the maxspeed of the node tags, restored when the relation is removed
+	TaggedDirection  string
+}
+
+type NextSpeedCamera struct {
+	Latitude         float64 `json:"latitude"`
+	Longitude        float64 `json:"longitude"`
+	Distance         float64 `json:"distance"`
+	Speedlimit       float64 `json:"speedlimit"`
+	Bearing          float64 `json:"bearing"`
+	Bidirectional    bool    `json:"bidirectional"`
+	Enforcement      string  `json:"enforcement"`
+	ZoneEndLatitude  float64 `json:"zone_end_latitude"`
+	ZoneEndLongitude float64 `json:"zone_end_longitude"`
+	Id               uint64  `json:"id"`
+}
+
+// Parses an OSM direction given in degrees or as a cardinal direction into a bearing in degrees
+func ParseBearing(direction string) (float64, bool) {
+	if bearing, err := strconv.ParseFloat(direction, 64); err == nil {
+		return math.Mod(bearing+360, 360), true
+	}
+	bearing, ok := cardinalBearings[strings.ToUpper(direction)]
+	return bearing, ok
+}
+
+func bearingDegrees(latA float64, lonA float64, latB float64, lonB float64) float64 {
+	return math.Mod(Bearing(latA, lonA, latB, lonB)*TO_DEGREES+360, 360)
+}
+
+func SpeedCameraFromNode(node *osm.Node) TmpSpeedCamera {
+	camera := TmpSpeedCamera{
+		Id:          int64(node.ID),
+		Latitude:    node.Lat,
+		Longitude:   node.Lon,
+		HasLocation: true,
+		MaxSpeed:    ParseMaxSpeed(node.Tags.Find("maxspeed")),
+		Direction:   node.Tags.Find("direction"),
+		Enforcement: "maxspeed",
+		Tagged:      true,
+	}
+	camera.TaggedMaxSpeed = camera.MaxSpeed
+	camera.TaggedDirection = camera.Direction
+	camera.Bearing, camera.HasBearing = ParseBearing(camera.Direction)
+	return camera
+}
+
+// Records the bearing of the way through a camera node, forward and backward
+// camera directions are resolved against it once the relations are applied
+func SetCameraWayBearing(camera *TmpSpeedCamera, nodes []TmpNode, index int) {
+	if camera.HasWayBearing || len(nodes) < 2 {
+		return
+	}
+	from, to := index, index+1
+	if to >= len(nodes) {
+		from, to = index-1, index
+	}
+	camera.WayBearing = bearingDegrees(nodes[from].Latitude, nodes[from].Longitude, nodes[to].Latitude, nodes[to].Longitude)
+	camera.HasWayBearing = true
+}
+
+// Applies a type=enforcement relation to its device nodes and returns the ids of
+// the nodes whose locations are needed to resolve it
+func ApplyEnforcement(cameras map[osm.NodeID]*TmpSpeedCamera, relation *osm.Relation) []osm.NodeID {
+	enforcement := relation.Tags.Find("enforcement")
+	if relation.Tags.Find("type") != "enforcement" || (enforcement != "maxspeed" && enforcement != "average_speed") {
+		return nil
+	}
+	var from, to osm.NodeID
+	devices := []osm.NodeID{}
+	for _, member := range relation.Members {
+		if member.Type != osm.TypeNode {
+			continue
+		}
+		switch member.Role {
+		case "device":
+			devices = append(devices, osm.NodeID(member.Ref))
+		case "from":
+			from = osm.NodeID(member.Ref)
+		case "to":
+			to = osm.NodeID(member.Ref)
+		}
+	}
+
+	needed := []osm.NodeID{}
+	maxSpeed := ParseMaxSpeed(relation.Tags.Find("maxspeed"))
+	for _, id := range devices {
+		camera, ok := cameras[id]
+		if !ok {
+			camera = &TmpSpeedCamera{Id: int64(id)}
+			cameras[id] = camera
+			needed = append(needed, id)
+		}
+		camera.Enforcement = enforcement
+		camera.Relation = relation.ID
+		if maxSpeed > 0 {
+			camera.MaxSpeed = maxSpeed
+		}
+		if direction := relation.Tags.Find("direction"); len(direction) > 0 {
+			camera.Direction = direction
+		}
+		camera.FromNode = from
+		camera.ToNode = to
+	}
+	if len(devices) > 0 {
+		if from != 0 {
+			needed = append(needed, from)
+		}
+		if to != 0 {
+			needed = append(needed, to)
+		}
+	}
+	return needed
+}
+
+// Removes what an enforcement relation applied to its devices, for example
+// when the relation was deleted. Deleted relations in osmChange files only
+// carry their id, so the cameras remember which relation enforced them.
+// Devices that are not tagged as speed cameras themselves are dropped. Returns
+// the ids of the changed cameras.
+func ClearEnforcement(cameras map[osm.NodeID]*TmpSpeedCamera, relation osm.RelationID) []osm.NodeID {
+	cleared := []osm.NodeID{}
+	for id, camera := range cameras {
+		if camera.Relation != relation {
+			continue
+		}
+		cleared = append(cleared, id)
+		if !camera.Tagged {
+			delete(cameras, id)
+			continue
+		}
+		camera.Relation = 0
+		camera.Enforcement = "maxspeed"
+		camera.MaxSpeed = camera.TaggedMaxSpeed
+		camera.Direction = camera.TaggedDirection
+		camera.FromNode = 0
+		camera.ToNode = 0
+	}
+	return cleared
+}
+
+// Fills in the locations and enforced bearings of the cameras. The cameras in
+// the map are left as they are, so that they can be resolved again after
+// their nodes, ways or relations change.
+func ResolveSpeedCameras(cameras map[osm.NodeID]*TmpSpeedCamera, locations map[osm.NodeID]TmpNode) []TmpSpeedCamera {
+	resolved := []TmpSpeedCamera{}
+	for id, c := range cameras {
+		camera := *c
+		if !camera.HasLocation {
+			location, ok := locations[id]
+			if !ok {
+				continue
+			}
+			camera.Latitude = location.Latitude
+			camera.Longitude = location.Longitude
+			camera.HasLocation = true
+		}
+		if !camera.HasBearing {
+			camera.Bearing, camera.HasBearing = ParseBearing(camera.Direction)
+		}
+		if !camera.HasBearing && camera.HasWayBearing && (camera.Direction == "forward" || camera.Direction == "backward") {
+			camera.Bearing = camera.WayBearing
+			if camera.Direction == "backward" {
+				camera.Bearing = math.Mod(camera.Bearing+180, 360)
+			}
+			camera.HasBearing = true
+		}
+		if to, ok := locations[camera.ToNode]; ok && camera.ToNode != 0 {
+			camera.ZoneEndLatitude = to.Latitude
+			camera.ZoneEndLongitude = to.Longitude
+			from, ok := locations[camera.FromNode]
+			if !ok || camera.FromNode == 0 {
+				from = TmpNode{Latitude: camera.Latitude, Longitude: camera.Longitude}
+			}
+			if camera.Direction != "both" && (from.Latitude != to.Latitude || from.Longitude != to.Longitude) {
+				camera.Bearing = bearingDegrees(from.Latitude, from.Longitude, to.Latitude, to.Longitude)
+				camera.HasBearing = true
+			}
+		}
+		resolved = append(resolved, camera)
+	}
+	return resolved
+}
+
+// Checks if a camera enforcing the given bearing applies to travel along the given bearing in radians
+func SpeedCameraApplies(camera SpeedCamera, travelBearing float64) bool {
+	if !camera.HasBearing() {
+		return true
+	}
+	delta := camera.Bearing()*TO_RADIANS - travelBearing
+	return math.Cos(delta) >= math.Cos(SPEED_CAMERA_BEARING_TOLERANCE*TO_RADIANS)
+}
+
+func legalMaxSpeed(way Way, isForward bool) float64 {
+	if isForward && way.MaxSpeedForward() > 0 {
+		return way.MaxSpeedForward()
+	}
+	if !isForward && way.MaxSpeedBackward() > 0 {
+		return way.MaxSpeedBackward()
+	}
+	return way.MaxSpeed()
+}
+
+// The speed cameras of a tile sorted by latitude, so that only the cameras
+// next to a stretch of the path are checked against it
+type SpeedCameraIndex struct {
+	cameras []SpeedCamera
+}
+
+func NewSpeedCameraIndex(offline Offline) (*SpeedCameraIndex, error) {
+	index := &SpeedCameraIndex{}
+	if !offline.HasSpeedCameras() {
+		return index, nil
+	}
+	cameras, err := offline.SpeedCameras()
+	if err != nil {
+		return index, errors.Wrap(err, "could not read speed cameras")
+	}
+	index.cameras = make([]SpeedCamera, cameras.Len())
+	for i := range index.cameras {
+		index.cameras[i] = cameras.At(i)
+	}
+	sort.Slice(index.cameras, func(i, j int) bool { return index.cameras[i].Latitude() < index.cameras[j].Latitude() })
+	return index, nil
+}
+
+// The cameras between two latitudes
+func (idx *SpeedCameraIndex) Between(minLat float64, maxLat float64) []SpeedCamera {
+	if idx == nil {
+		return nil
+	}
+	start := sort.Search(len(idx.cameras), func(i int) bool { return idx.cameras[i].Latitude() >= minLat })
+	end := sort.Search(len(idx.cameras), func(i int) bool { return idx.cameras[i].Latitude() > maxLat })
+	return idx.cameras[start:end]
+}
+
+// Finds the nearest speed camera along the predicted path that enforces the direction of travel
+func GetNextSpeedCamera(pos Position, currentWay CurrentWay, nextWays []NextWayResult, cameras *SpeedCameraIndex) (NextSpeedCamera, error) {
+	if cameras == nil || len(cameras.cameras) == 0 {
+		return NextSpeedCamera{}, nil
+	}
+	margin := SPEED_CAMERA_MATCH_DISTANCE / R * TO_DEGREES
+	var err error
+
+	directions := map[int64]bool{currentWay.Way.Id(): currentWay.OnWay.IsForward}
+	for _, nextWay := range nextWays {
+		directions[nextWay.Way.Id()] = nextWay.IsForward
+	}
+
+	res := NextSpeedCamera{}
+	found := false
+	prevLat := pos.Latitude
+	prevLon := pos.Longitude
+	prevDist := 0.0
+	first := true
+	WalkPathNodes(pos, currentWay, nextWays, func(way Way, index int, distance float64) {
+		nodes, e := way.Nodes()
+		if e != nil {
+			err = errors.Wrap(e, "could not read way nodes")
+			return
+		}
+		node := nodes.At(index)
+		lat := node.Latitude()
+		lon := node.Longitude()
+		travelBearing := Bearing(prevLat, prevLon, lat, lon)
+		for _, camera := range cameras.Between(math.Min(prevLat, lat)-margin, math.Max(prevLat, lat)+margin) {
+			pLat, pLon := PointOnLine(prevLat, prevLon, lat, lon, camera.Latitude(), camera.Longitude())
+			if first && pLat == prevLat && pLon == prevLon {
+				// the camera is behind the current position
+				continue
+			}
+			offset := DistanceToPoint(pLat*TO_RADIANS, pLon*TO_RADIANS, camera.Latitude()*TO_RADIANS, camera.Longitude()*TO_RADIANS)
+			if offset > SPEED_CAMERA_MATCH_DISTANCE || !SpeedCameraApplies(camera, travelBearing) {
+				continue
+			}
+			dist := prevDist + DistanceToPoint(prevLat*TO_RADIANS, prevLon*TO_RADIANS, pLat*TO_RADIANS, pLon*TO_RADIANS)
+			if found && dist >= res.Distance {
+				continue
+			}
+			enforcement, _ := camera.Enforcement()
+			speedLimit := camera.MaxSpeed()
+			if speedLimit == 0 {
+				speedLimit = legalMaxSpeed(way, directions[way.Id()])
+			}
+			found = true
+			res = NextSpeedCamera{
+				Latitude:         camera.Latitude(),
+				Longitude:        camera.Longitude(),
+				Distance:         dist,
+				Speedlimit:       speedLimit,
+				Bearing:          camera.Bearing(),
+				Bidirectional:    !camera.HasBearing(),
+				Enforcement:      enforcement,
+				ZoneEndLatitude:  camera.ZoneEndLatitude(),
+				ZoneEndLongitude: camera.ZoneEndLongitude(),
+				Id:               uint64(camera.Id()),
+			}
+		}
+		prevLat = lat
+		prevLon = lon
+		prevDist = distance
+		first = false
+	})
+	return res, err
+}
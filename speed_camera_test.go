@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/bradleyjkemp/cupaloy"
+	"github.com/paulmach/osm"
+)
+
+func TestResolveSpeedCameras(t *testing.T) {
+	// a way heading east through nodes 1 to 4
+	wayNodes := []TmpNode{{Latitude: 0, Longitude: 0}, {Latitude: 0, Longitude: 0.001}, {Latitude: 0, Longitude: 0.002}, {Latitude: 0, Longitude: 0.003}}
+	locations := map[osm.NodeID]TmpNode{1: wayNodes[0], 2: wayNodes[1], 3: wayNodes[2], 4: wayNodes[3], 5: {Latitude: 0.001, Longitude: 0.001}}
+	cameras := map[osm.NodeID]*TmpSpeedCamera{}
+	for _, node := range []*osm.Node{
+		{ID: 2, Lat: 0, Lon: 0.001, Tags: osm.Tags{{Key: "highway", Value: "speed_camera"}, {Key: "direction", Value: "forward"}}},
+		{ID: 4, Lat: 0, Lon: 0.003, Tags: osm.Tags{{Key: "highway", Value: "speed_camera"}, {Key: "direction", Value: "NE"}}},
+	} {
+		camera := SpeedCameraFromNode(node)
+		cameras[node.ID] = &camera
+	}
+
+	results := ""
+	// the relation is applied before the way, like the generator does
+	needed := ApplyEnforcement(cameras, &osm.Relation{
+		Tags:    osm.Tags{{Key: "type", Value: "enforcement"}, {Key: "enforcement", Value: "maxspeed"}, {Key: "direction", Value: "backward"}, {Key: "maxspeed", Value: "50"}},
+		Members: osm.Members{{Type: osm.TypeNode, Ref: 3, Role: "device"}},
+	})
+	needed = append(needed, ApplyEnforcement(cameras, &osm.Relation{
+		Tags:    osm.Tags{{Key: "type", Value: "enforcement"}, {Key: "enforcement", Value: "average_speed"}},
+		Members: osm.Members{{Type: osm.TypeNode, Ref: 5, Role: "device"}, {Type: osm.TypeNode, Ref: 5, Role: "from"}, {Type: osm.TypeNode, Ref: 1, Role: "to"}},
+	})...)
+	results += fmt.Sprintf("needed nodes: %v\n", needed)
+	for i, id := range []osm.NodeID{1, 2, 3, 4} {
+		if camera, ok := cameras[id]; ok {
+			SetCameraWayBearing(camera, wayNodes, i)
+		}
+	}
+
+	for run := 0; run < 2; run++ {
+		resolved := ResolveSpeedCameras(cameras, locations)
+		sort.Slice(resolved, func(i, j int) bool { return resolved[i].Id < resolved[j].Id })
+		results += fmt.Sprintf("run %d\n", run)
+		for _, camera := range resolved {
+			results += fmt.Sprintf("  %d: direction=%q bearing=%.1f has bearing=%v enforcement=%s maxspeed=%.2f zone end=%.3f,%.3f\n",
+				camera.Id, camera.Direction, camera.Bearing, camera.HasBearing, camera.Enforcement, camera.MaxSpeed, camera.ZoneEndLatitude, camera.ZoneEndLongitude)
+		}
+	}
+
+	cupaloy.SnapshotT(t, results)
+}
+
+func TestGetNextSpeedCamera(t *testing.T) {
+	way := roadTestWay(1, false, TmpNode{Latitude: 0, Longitude: 0}, TmpNode{Latitude: 0, Longitude: 0.002}, TmpNode{Latitude: 0, Longitude: 0.004})
+	way.MaxSpeed = 20
+	area := Area{MinLat: -0.01, MinLon: -0.01, MaxLat: 0.01, MaxLon: 0.02, Ways: []TmpWay{way}}
+	cameras := []TmpSpeedCamera{
+		{Id: 1, Latitude: 0, Longitude: 0.0005, HasBearing: true, Bearing: 90, Enforcement: "maxspeed"},                    // behind
+		{Id: 2, Latitude: 0.0001, Longitude: 0.003, HasBearing: true, Bearing: 90, MaxSpeed: 25, Enforcement: "maxspeed"},  // ahead beside the road
+		{Id: 3, Latitude: 0, Longitude: 0.0025, HasBearing: true, Bearing: 270, Enforcement: "maxspeed"},                   // ahead for the other direction
+		{Id: 4, Latitude: 0.005, Longitude: 0.002, Enforcement: "maxspeed"},                                                // off the road
+		{Id: 5, Latitude: 0, Longitude: 0.0035, Enforcement: "average_speed", ZoneEndLatitude: 0, ZoneEndLongitude: 0.004}, // ahead in both directions
+	}
+	_, offline := NewOfflineMessage(area, cameras, CoordinateEncoding_float64)
+	index, err := NewSpeedCameraIndex(offline)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := ""
+	for _, pos := range []Position{{Latitude: 0, Longitude: 0.001, Bearing: 90}, {Latitude: 0, Longitude: 0.0032, Bearing: 90}, {Latitude: 0, Longitude: 0.0038, Bearing: 90}} {
+		currentWay, err := GetCurrentWay(CurrentWay{}, nil, offline, pos)
+		if err != nil {
+			t.Fatal(err)
+		}
+		camera, err := GetNextSpeedCamera(pos, currentWay, nil, index)
+		results += fmt.Sprintf("at %.4f: id=%d distance=%.1f speedlimit=%.1f bidirectional=%v enforcement=%q err=%v\n",
+			pos.Longitude, camera.Id, camera.Distance, camera.Speedlimit, camera.Bidirectional, camera.Enforcement, err)
+	}
+	none, err := GetNextSpeedCamera(Position{}, CurrentWay{}, nil, nil)
+	results += fmt.Sprintf("no tile: id=%d err=%v\n", none.Id, err)
+
+	cupaloy.SnapshotT(t, results)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+var SPILL_BUFFER_NODES = 4000000 // how many way nodes to buffer in memory before spilling ways to disk
+
+var (
+	AREA_ROWS    = int(180 / AREA_BOX_DEGREES)
+	AREA_COLUMNS = int(360 / AREA_BOX_DEGREES)
+)
+
+// Returns the indexes into AREAS of every area whose overlap box intersects the bounding box
+func OverlappingAreaIndexes(minLat float64, minLon float64, maxLat float64, maxLon float64) []int {
+	clamp := func(v int, max int) int {
+		if v < 0 {
+			return 0
+		}
+		if v > max {
+			return max
+		}
+		return v
+	}
+	minRow := clamp(int(math.Floor((minLat-OVERLAP_BOX_DEGREES+90)/AREA_BOX_DEGREES)), AREA_ROWS-1)
+	maxRow := clamp(int(math.Floor((maxLat+OVERLAP_BOX_DEGREES+90)/AREA_BOX_DEGREES)), AREA_ROWS-1)
+	minCol := clamp(int(math.Floor((minLon-OVERLAP_BOX_DEGREES+180)/AREA_BOX_DEGREES)), AREA_COLUMNS-1)
+	maxCol := clamp(int(math.Floor((maxLon+OVERLAP_BOX_DEGREES+180)/AREA_BOX_DEGREES)), AREA_COLUMNS-1)
+	indexes := make([]int, 0, (maxRow-minRow+1)*(maxCol-minCol+1))
+	for row := minRow; row <= maxRow; row++ {
+		for col := minCol; col <= maxCol; col++ {
+			indexes = append(indexes, row*AREA_COLUMNS+col)
+		}
+	}
+	return indexes
+}
+
+// Buckets ways by area on disk so that generation does not have to keep every
+// way in memory. Each spill file is a sequence of length prefixed gob chunks.
+type AreaSpill struct {
+	dir     string
+	pending map[int][]TmpWay
+	nodes   int
+	counts  map[int]int
+}
+
+func NewAreaSpill(dir string) *AreaSpill {
+	return &AreaSpill{
+		dir:     dir,
+		pending: map[int][]TmpWay{},
+		counts:  map[int]int{},
+	}
+}
+
+func (s *AreaSpill) fileName(index int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%d.spill", index))
+}
+
+func (s *AreaSpill) Add(index int, way TmpWay) error {
+	s.pending[index] = append(s.pending[index], way)
+	s.counts[index]++
+	s.nodes += len(way.Nodes)
+	if s.nodes > SPILL_BUFFER_NODES {
+		return s.Flush()
+	}
+	return nil
+}
+
+// Writes all buffered ways to their spill files
+func (s *AreaSpill) Flush() error {
+	var buf bytes.Buffer
+	for index, ways := range s.pending {
+		buf.Reset()
+		err := gob.NewEncoder(&buf).Encode(ways)
+		if err != nil {
+			return errors.Wrap(err, "could not encode spilled ways")
+		}
+		f, err := os.OpenFile(s.fileName(index), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return errors.Wrap(err, "could not open spill file")
+		}
+		w := bufio.NewWriter(f)
+		err = binary.Write(w, binary.LittleEndian, uint64(buf.Len()))
+		if err == nil {
+			_, err = w.Write(buf.Bytes())
+		}
+		if err == nil {
+			err = w.Flush()
+		}
+		if err != nil {
+			f.Close()
+			return errors.Wrap(err, "could not write spill file")
+		}
+		err = f.Close()
+		if err != nil {
+			return errors.Wrap(err, "could not close spill file")
+		}
+	}
+	s.pending = map[int][]TmpWay{}
+	s.nodes = 0
+	return nil
+}
+
+// Indexes of all areas that have ways, in ascending order
+func (s *AreaSpill) Areas() []int {
+	indexes := make([]int, 0, len(s.counts))
+	for index := range s.counts {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+func (s *AreaSpill) Count(index int) int {
+	return s.counts[index]
+}
+
+// Reads back all spilled ways of an area
+func (s *AreaSpill) Read(index int) ([]TmpWay, error) {
+	ways := []TmpWay{}
+	f, err := os.Open(s.fileName(index))
+	if os.IsNotExist(err) {
+		return ways, nil
+	}
+	if err != nil {
+		return ways, errors.Wrap(err, "could not open spill file")
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	for {
+		var size uint64
+		err := binary.Read(r, binary.LittleEndian, &size)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return ways, errors.Wrap(err, "could not read spill chunk size")
+		}
+		data := make([]byte, size)
+		_, err = io.ReadFull(r, data)
+		if err != nil {
+			return ways, errors.Wrap(err, "could not read spill chunk")
+		}
+		chunk := []TmpWay{}
+		err = gob.NewDecoder(bytes.NewReader(data)).Decode(&chunk)
+		if err != nil {
+			return ways, errors.Wrap(err, "could not decode spilled ways")
+		}
+		ways = append(ways, chunk...)
+	}
+	return ways, nil
+}
+
+// Replaces the spilled ways of an area
+func (s *AreaSpill) Replace(index int, ways []TmpWay) error {
+	err := s.Remove(index)
+	if err != nil {
+		return err
+	}
+	delete(s.pending, index)
+	s.counts[index] = 0
+	for _, way := range ways {
+		s.pending[index] = append(s.pending[index], way)
+		s.counts[index]++
+	}
+	return s.Flush()
+}
+
+func (s *AreaSpill) Remove(index int) error {
+	err := os.Remove(s.fileName(index))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return errors.Wrap(err, "could not remove spill file")
+}
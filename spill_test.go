@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bradleyjkemp/cupaloy"
+)
+
+func TestOverlappingAreaIndexes(t *testing.T) {
+	results := ""
+	for _, box := range [][4]float64{
+		{38.1, -75.9, 38.2, -75.8},     // inside one area
+		{38.245, -75.9, 38.255, -75.8}, // across an area border
+		{38.005, -75.995, 38.1, -75.8}, // within the overlap of the areas to the south west
+		{-90, -180, -89.9, -179.9},     // clamped at the corner of the world
+	} {
+		results += fmt.Sprintf("%v:", box)
+		for _, i := range OverlappingAreaIndexes(box[0], box[1], box[2], box[3]) {
+			area := AREAS[i]
+			results += fmt.Sprintf(" %d(%.2f,%.2f)", i, area.MinLat, area.MinLon)
+		}
+		results += "\n"
+	}
+
+	cupaloy.SnapshotT(t, results)
+}
+
+func TestAreaSpill(t *testing.T) {
+	bufferNodes := SPILL_BUFFER_NODES
+	defer func() { SPILL_BUFFER_NODES = bufferNodes }()
+	// spill after every third way so that areas are read back from several chunks
+	SPILL_BUFFER_NODES = 5
+	spill := NewAreaSpill(t.TempDir())
+	for id := int64(1); id <= 7; id++ {
+		way := roadTestWay(id, false, TmpNode{Latitude: 0, Longitude: 0}, TmpNode{Latitude: 0, Longitude: 0.001})
+		way.Name = fmt.Sprintf("way %d", id)
+		err := spill.Add(int(id%2), way)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results := ""
+	read := func(step string) {
+		results += fmt.Sprintf("%s: areas=%v\n", step, spill.Areas())
+		for _, index := range spill.Areas() {
+			ways, err := spill.Read(index)
+			results += fmt.Sprintf("  area %d count=%d err=%v:", index, spill.Count(index), err)
+			for _, way := range ways {
+				results += fmt.Sprintf(" %d/%q/%d nodes", way.Id, way.Name, len(way.Nodes))
+			}
+			results += "\n"
+		}
+	}
+	err := spill.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	read("spilled")
+	err = spill.Replace(1, []TmpWay{{Id: 9, Name: "replaced"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	read("replaced")
+	err = spill.Remove(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ways, err := spill.Read(0)
+	results += fmt.Sprintf("removed: %d ways err=%v\n", len(ways), err)
+
+	cupaloy.SnapshotT(t, results)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	UPDATE_CHECK_INTERVAL       = 24 * time.Hour   // how often installed groups are compared with the map data source
+	UPDATE_CHECK_RETRY_INTERVAL = time.Hour        // how soon a check that could not reach the source is repeated
+	UPDATE_CHECK_TIMEOUT        = 10 * time.Minute // how long a whole check may take
+	PARKED_TIME                 = 2 * time.Minute  // how long the car has to stand still before updates are checked
+	PARKED_DISTANCE             = 10.0             // meters. moving less than this counts as standing still
+)
+
+// A group with a newer release at the map data source
+type GroupUpdate struct {
+	Group                string     `json:"group"`
+	InstalledGeneratedAt *time.Time `json:"installed_generated_at"` // null when the group was installed before it was recorded
+	AvailableGeneratedAt time.Time  `json:"available_generated_at"`
+}
+
+type UpdateStatus struct {
+	Available   bool          `json:"available"`
+	CheckedAt   time.Time     `json:"checked_at"`
+	Groups      []GroupUpdate `json:"groups"`
+	Errors      []string      `json:"errors"`        // groups that could not be checked
+	UpdateJobID int           `json:"update_job_id"` // the download job queued by an automatic update, 0 if none
+}
+
+// Fetches the manifest of a group from the first source that has it
+func fetchGroupManifest(ctx context.Context, sources []string, group GroupArea) (GroupManifest, error) {
+	err := errors.New("no map data sources")
+	for _, source := range sources {
+		manifest, fetchErr := FetchManifest(ctx, manifestName(downloadURL(source, group.Lat, group.Lon)))
+		if fetchErr == nil {
+			return manifest, nil
+		}
+		err = errors.Wrapf(fetchErr, "could not download manifest from %s", source)
+	}
+	return GroupManifest{}, err
+}
+
+// Compares the installed groups with the manifests of the map data sources
+func CheckForUpdates(ctx context.Context) UpdateStatus {
+	status := UpdateStatus{CheckedAt: time.Now().UTC(), Groups: []GroupUpdate{}, Errors: []string{}}
+	registry, err := ReadRegistry()
+	if err != nil {
+		status.Errors = append(status.Errors, err.Error())
+	}
+	sources := DownloadSources()
+	for _, group := range InstalledGroupAreas() {
+		if ctx.Err() != nil {
+			status.Errors = append(status.Errors, fmt.Sprintf("%s: %v", group, ctx.Err()))
+			continue
+		}
+		manifest, err := fetchGroupManifest(ctx, sources, group)
+		if err != nil {
+			status.Errors = append(status.Errors, fmt.Sprintf("%s: %v", group, err))
+			continue
+		}
+		installed, ok := registry[group.String()]
+		fingerprint := ManifestFingerprint(manifest)
+		if fingerprint == installed.Rejected {
+			// the release was rolled back from, wait for a different one
+			continue
+		}
+		ok = ok && len(installed.Fingerprint) > 0
+		if ok && (installed.Fingerprint == fingerprint || manifest.GeneratedAt.Before(installed.GeneratedAt)) {
+			continue
+		}
+		update := GroupUpdate{Group: group.String(), AvailableGeneratedAt: manifest.GeneratedAt}
+		if ok {
+			update.InstalledGeneratedAt = &installed.GeneratedAt
+		}
+		status.Groups = append(status.Groups, update)
+	}
+	status.Available = len(status.Groups) > 0
+	return status
+}
+
+// Whether automatic updates are turned on and the network is not metered
+func autoUpdateAllowed() bool {
+	enabled, err := GetParam(AUTO_UPDATE_PERSIST)
+	if err != nil || strings.TrimSpace(string(enabled)) != "1" {
+		return false
+	}
+	// openpilot writes 0 while it is on wifi, anything else counts as metered
+	metered, err := GetParam(NETWORK_METERED)
+	return err == nil && strings.TrimSpace(string(metered)) == "0"
+}
+
+var updateCheckRunning atomic.Bool
+var updateCheckFailed atomic.Bool
+
+// Checks for updates in the background unless a check is already running,
+// publishes the result and queues the updates when automatic updates are
+// allowed. Returns whether a check was started.
+func StartUpdateCheck() bool {
+	if !updateCheckRunning.CompareAndSwap(false, true) {
+		return false
+	}
+	go func() {
+		defer updateCheckRunning.Store(false)
+		ctx, cancel := context.WithTimeout(context.Background(), UPDATE_CHECK_TIMEOUT)
+		defer cancel()
+		status := CheckForUpdates(ctx)
+		// nothing could be checked, probably because the car is offline
+		updateCheckFailed.Store(len(status.Errors) > 0 && len(status.Groups) == 0)
+
+		if status.Available && autoUpdateAllowed() && downloadQueue.Idle() {
+			groups := []string{}
+			for _, update := range status.Groups {
+				groups = append(groups, update.Group)
+			}
+			status.UpdateJobID = downloadQueue.Add(DownloadJob{Groups: groups})
+		}
+		log.Info().Bool("available", status.Available).Int("groups", len(status.Groups)).Int("errors", len(status.Errors)).Msg("Checked for map updates")
+
+		data, err := json.Marshal(status)
+		logde(errors.Wrap(err, "could not marshal update status"))
+		err = PutParam(UPDATE_AVAILABLE, data)
+		logwe(errors.Wrap(err, "could not write update status"))
+	}()
+	return true
+}
+
+// Starts update checks when the car has been parked for a while and the last
+// check is old enough, or when one is requested through OSMUpdateCheck
+type UpdateScheduler struct {
+	Position  Position
+	MovedAt   time.Time
+	LastCheck time.Time
+}
+
+func (u *UpdateScheduler) Update(pos Position, now time.Time) {
+	requested, err := TakeParam(UPDATE_CHECK)
+	logde(err)
+	if u.Due(pos, now, len(requested) > 0) && StartUpdateCheck() {
+		u.LastCheck = now
+	}
+}
+
+// Whether a check should start now
+func (u *UpdateScheduler) Due(pos Position, now time.Time, requested bool) bool {
+	moved := DistanceToPoint(u.Position.Latitude*TO_RADIANS, u.Position.Longitude*TO_RADIANS, pos.Latitude*TO_RADIANS, pos.Longitude*TO_RADIANS)
+	if u.MovedAt.IsZero() || moved > PARKED_DISTANCE {
+		u.Position = pos
+		u.MovedAt = now
+	}
+	interval := UPDATE_CHECK_INTERVAL
+	if updateCheckFailed.Load() {
+		interval = UPDATE_CHECK_RETRY_INTERVAL
+	}
+	parked := now.Sub(u.MovedAt) >= PARKED_TIME
+	due := u.LastCheck.IsZero() || now.Sub(u.LastCheck) >= interval
+	return requested || (parked && due)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bradleyjkemp/cupaloy"
+)
+
+func TestCheckForUpdates(t *testing.T) {
+	base := useTestDirs(t)
+	sources := DOWNLOAD_SOURCES
+	defer func() { DOWNLOAD_SOURCES = sources }()
+	mirror := t.TempDir()
+	source, err := NormalizeSource(mirror)
+	if err != nil {
+		t.Fatal(err)
+	}
+	DOWNLOAD_SOURCES = []string{source}
+	tileName := "offline/38/-76/38.000000_-76.000000_38.250000_-75.750000"
+	release := func(name string, content string, generatedAt time.Time) {
+		writeTestGroup(t, mirror, map[string]string{name: content})
+		err := os.Chtimes(filepath.Join(mirror, name), generatedAt, generatedAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = WriteGroupManifests(mirror)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results := ""
+	check := func(step string) {
+		status := CheckForUpdates(context.Background())
+		results += fmt.Sprintf("%s: available=%v errors=%d\n", step, status.Available, len(status.Errors))
+		for _, update := range status.Groups {
+			installed := "unrecorded"
+			if update.InstalledGeneratedAt != nil {
+				installed = update.InstalledGeneratedAt.Format(time.RFC3339)
+			}
+			results += fmt.Sprintf("  %s installed=%s available=%s\n", update.Group, installed, update.AvailableGeneratedAt.Format(time.RFC3339))
+		}
+	}
+	registry := func(step string) {
+		registry, err := ReadRegistry()
+		results += fmt.Sprintf("%s: err=%v", step, err)
+		for _, name := range []string{"38/-76", "40/-76"} {
+			group, ok := registry[name]
+			if !ok {
+				continue
+			}
+			results += fmt.Sprintf(" %s generated=%s files=%d previous=%v rejected=%v", group.Group, group.GeneratedAt.Format(time.RFC3339), group.Files, group.Previous != nil, len(group.Rejected) > 0)
+		}
+		results += "\n"
+	}
+
+	// a group installed before the registry existed
+	err = os.MkdirAll(filepath.Join(base, "offline", "40", "-76"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release("offline/40/-76/40.000000_-76.000000_40.250000_-75.750000", "other group", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	release(tileName, "release 1", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	check("unrecorded")
+	_, err = DownloadGroup(context.Background(), DOWNLOAD_SOURCES, 40, -76)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = DownloadGroup(context.Background(), DOWNLOAD_SOURCES, 38, -76)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry("installed")
+	check("up to date")
+
+	release(tileName, "release 2", time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC))
+	check("new release")
+	_, err = DownloadGroup(context.Background(), DOWNLOAD_SOURCES, 38, -76)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry("updated")
+	err = RollbackGroup("38/-76")
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry("rolled back")
+	check("rolled back release")
+
+	release(tileName, "release 3", time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC))
+	check("release after rollback")
+
+	// a mirror that still serves an older release is no update
+	release(tileName, "release 0", time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC))
+	check("older release")
+
+	cupaloy.SnapshotT(t, results)
+}
+
+func TestUpdateSchedulerDue(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	home := Position{Latitude: 38.5, Longitude: -75.5}
+	driving := Position{Latitude: 38.6, Longitude: -75.5}
+	scheduler := UpdateScheduler{}
+	results := ""
+	for _, step := range []struct {
+		name      string
+		pos       Position
+		after     time.Duration
+		requested bool
+	}{
+		{"start", home, 0, false},
+		{"standing", home, time.Minute, false},
+		{"parked", home, 3 * time.Minute, false},
+		{"checked recently", home, 4 * time.Minute, false},
+		{"driving", driving, 5 * time.Minute, false},
+		{"requested while driving", driving, 6 * time.Minute, true},
+		{"parked a day later", driving, 25 * time.Hour, false},
+	} {
+		due := scheduler.Due(step.pos, start.Add(step.after), step.requested)
+		if due {
+			scheduler.LastCheck = start.Add(step.after)
+		}
+		results += fmt.Sprintf("%s: %v\n", step.name, due)
+	}
+
+	cupaloy.SnapshotT(t, results)
+}
@@ -152,6 +152,7 @@ func GetCurrentWay(currentWay CurrentWay, nextWays []NextWayResult, offline Offl
 
 	possibleWays, err := getPossibleWays(offline, pos)
 	logde(errors.Wrap(err, "Failed to get possible ways"))
+	possibleWays = SameLevelWays(possibleWays, currentWay.Way)
 	if len(possibleWays) > 0 {
 		preferredWay := possibleWays[0]
 		preferredOnWay, err := OnWay(preferredWay, pos, false)
@@ -258,6 +259,17 @@ func MatchingWays(currentWay Way, offline Offline, matchNode Coordinates) ([]Way
 		lNode := wNodes.At(wNodes.Len() - 1)
 		if (fNode.Latitude() == matchNode.Latitude() && fNode.Longitude() == matchNode.Longitude()) || (lNode.Latitude() == matchNode.Latitude() && lNode.Longitude() == matchNode.Longitude()) {
 			matchingWays = append(matchingWays, w)
+			continue
+		}
+
+		// roundabouts are entered from any node on the ring
+		if IsRoundabout(w) {
+			for j := 1; j < wNodes.Len()-1; j++ {
+				if sameNode(wNodes.At(j), matchNode) {
+					matchingWays = append(matchingWays, w)
+					break
+				}
+			}
 		}
 	}
 
@@ -269,6 +281,7 @@ type NextWayResult struct {
 	IsForward     bool
 	StartPosition Coordinates
 	EndPosition   Coordinates
+	Distance      float64 // meters from the current position to StartPosition
 }
 
 func NextIsForward(nextWay Way, matchNode Coordinates) bool {
@@ -321,6 +334,20 @@ func NextWay(way Way, offline Offline, isForward bool) (NextWayResult, error) {
 		return NextWayResult{StartPosition: matchNode}, nil
 	}
 
+	// a roundabout has to be entered once it is reached
+	if !IsRoundabout(way) {
+		for _, mWay := range matchingWays {
+			if IsRoundabout(mWay) {
+				return NextWayResult{
+					Way:           mWay,
+					StartPosition: matchNode,
+					EndPosition:   matchNode,
+					IsForward:     true,
+				}, nil
+			}
+		}
+	}
+
 	// first return if one of the next connecting ways has the same name
 	name, _ := way.Name()
 	if len(name) > 0 {
@@ -558,12 +585,31 @@ func DistanceToEndOfWay(pos Position, way Way, isForward bool) (float64, error)
 	return dist, nil
 }
 
-func NextWays(pos Position, currentWay CurrentWay, offline Offline, isForward bool) ([]NextWayResult, error) {
+func NextWays(pos Position, currentWay CurrentWay, prevNextWays []NextWayResult, offline Offline, isForward bool) ([]NextWayResult, error) {
 	nextWays := []NextWayResult{}
 	dist := 0.0
 	wayIdx := currentWay.Way
 	forward := isForward
 	startPos := pos
+
+	// when already on a roundabout skip ahead to the exit that was predicted before entering
+	if IsRoundabout(currentWay.Way) {
+		lineEnd := currentWay.OnWay.Distance.LineEnd
+		exit, ringDist, err := RoundaboutExit(currentWay.Way, lineEnd, Way{}, true, predictedRoundaboutExit(prevNextWays), offline)
+		logde(errors.Wrap(err, "could not find roundabout exit"))
+		if err == nil && exit.Way.HasNodes() {
+			dist = DistanceToPoint(pos.Latitude*TO_RADIANS, pos.Longitude*TO_RADIANS, lineEnd.Latitude()*TO_RADIANS, lineEnd.Longitude()*TO_RADIANS) + ringDist
+			exit.Distance = dist
+			nextWays = append(nextWays, exit)
+			wayIdx = exit.Way
+			startPos = Position{
+				Latitude:  exit.StartPosition.Latitude(),
+				Longitude: exit.StartPosition.Longitude(),
+			}
+			forward = exit.IsForward
+		}
+	}
+
 	for dist < float64(MIN_WAY_DIST) {
 		d, err := DistanceToEndOfWay(startPos, wayIdx, forward)
 		if err != nil || d <= 0 {
@@ -574,7 +620,23 @@ func NextWays(pos Position, currentWay CurrentWay, offline Offline, isForward bo
 		if err != nil {
 			break
 		}
+		nw.Distance = dist
 		nextWays = append(nextWays, nw)
+
+		// predict the exit instead of following the ring
+		if IsRoundabout(nw.Way) && !IsRoundabout(wayIdx) {
+			exit, ringDist, err := RoundaboutExit(nw.Way, nw.StartPosition, wayIdx, forward, 0, offline)
+			logde(errors.Wrap(err, "could not find roundabout exit"))
+			if err != nil || !exit.Way.HasNodes() {
+				break
+			}
+			nextWays[len(nextWays)-1].EndPosition = exit.StartPosition
+			dist += ringDist
+			exit.Distance = dist
+			nextWays = append(nextWays, exit)
+			nw = exit
+		}
+
 		wayIdx = nw.Way
 		startPos = Position{
 			Latitude:  nw.StartPosition.Latitude(),
@@ -588,8 +650,69 @@ func NextWays(pos Position, currentWay CurrentWay, offline Offline, isForward bo
 		if err != nil {
 			return []NextWayResult{}, err
 		}
+		nextWay.Distance, _ = DistanceToEndOfWay(pos, currentWay.Way, isForward)
 		nextWays = append(nextWays, nextWay)
 	}
 
 	return nextWays, nil
 }
+
+// Calls fn for every node ahead on the predicted path, in the order they will be
+// passed, with the distance in meters from the current position to the node.
+func WalkPathNodes(pos Position, currentWay CurrentWay, nextWays []NextWayResult, fn func(way Way, index int, distance float64)) {
+	nodes, err := currentWay.Way.Nodes()
+	if err == nil && nodes.Len() > 1 {
+		lineStart := currentWay.OnWay.Distance.LineStart
+		lineEnd := currentWay.OnWay.Distance.LineEnd
+		for i := 0; i < nodes.Len()-1; i++ {
+			if !sameNode(nodes.At(i), lineStart) || !sameNode(nodes.At(i+1), lineEnd) {
+				continue
+			}
+			index := i + 1
+			step := 1
+			if !currentWay.OnWay.IsForward {
+				index = i
+				step = -1
+			}
+			node := nodes.At(index)
+			dist := DistanceToPoint(pos.Latitude*TO_RADIANS, pos.Longitude*TO_RADIANS, node.Latitude()*TO_RADIANS, node.Longitude()*TO_RADIANS)
+			for ; index >= 0 && index < nodes.Len(); index += step {
+				if index != i+1 && index != i {
+					dist += nodeDistance(nodes.At(index-step), nodes.At(index))
+				}
+				fn(currentWay.Way, index, dist)
+			}
+			break
+		}
+	}
+
+	for _, nextWay := range nextWays {
+		nodes, err := nextWay.Way.Nodes()
+		if err != nil || nodes.Len() < 2 {
+			continue
+		}
+		step := 1
+		if !nextWay.IsForward {
+			step = -1
+		}
+		start := -1
+		for i := 0; i < nodes.Len(); i++ {
+			if sameNode(nodes.At(i), nextWay.StartPosition) {
+				start = i
+				break
+			}
+		}
+		if start < 0 {
+			continue
+		}
+		// the start node was already passed as the end of the previous way
+		dist := nextWay.Distance
+		for index := start + step; index >= 0 && index < nodes.Len(); index += step {
+			dist += nodeDistance(nodes.At(index-step), nodes.At(index))
+			fn(nextWay.Way, index, dist)
+			if sameNode(nodes.At(index), nextWay.EndPosition) {
+				break
+			}
+		}
+	}
+}